@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -21,6 +23,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	// Initialize server
 	server := handlers.NewServer(cfg)
@@ -28,7 +33,8 @@ func main() {
 	// Start server in a goroutine
 	go func() {
 		log.Printf("Starting server on port %s", cfg.Server.Port)
-		if err := server.Start(); err != nil {
+		// Shutdown makes Start return ErrServerClosed; exiting then would skip the graceful stop
+		if err := server.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Server failed to start: %v", err)
 		}
 	}()
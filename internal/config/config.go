@@ -1,9 +1,16 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"net/mail"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,6 +25,8 @@ type Config struct {
 	Analytics    AnalyticsConfig    `yaml:"analytics"`
 	Admin        AdminConfig        `yaml:"admin"`
 	Feedback     FeedbackConfig     `yaml:"feedback"`
+	Captcha      CaptchaConfig      `yaml:"captcha"`
+	Jobs         JobsConfig         `yaml:"jobs"`
 }
 
 type ServerConfig struct {
@@ -26,6 +35,8 @@ type ServerConfig struct {
 	Debug        bool   `yaml:"debug" env:"DEBUG"`
 	CORSOrigins  []string `yaml:"cors_origins" env:"CORS_ORIGINS"`
 	RateLimiting RateLimitConfig `yaml:"rate_limiting"`
+	SecretKey    string `yaml:"secret_key" env:"SECRET_KEY"`
+	PublicURL    string `yaml:"public_url" env:"PUBLIC_URL"` // Base URL that links sent to people and devices point at
 }
 
 type RateLimitConfig struct {
@@ -47,6 +58,19 @@ type EmailConfig struct {
 	Provider string     `yaml:"provider" env:"EMAIL_PROVIDER"`
 	SMTP     SMTPConfig `yaml:"smtp"`
 	SendGrid SendGridConfig `yaml:"sendgrid"`
+	TemplatesDir string `yaml:"templates_dir" env:"EMAIL_TEMPLATES_DIR"` // Overrides and additions to the built-in templates
+	ReplyTo      string `yaml:"reply_to" env:"EMAIL_REPLY_TO"`
+	// mailto: address or https URL for the List-Unsubscribe header of forms that set
+	// email.list_unsubscribe. An https URL must accept the RFC 8058 one-click POST.
+	ListUnsubscribe string `yaml:"list_unsubscribe" env:"EMAIL_LIST_UNSUBSCRIBE"`
+	Retry           EmailRetryConfig `yaml:"retry"`
+}
+
+// EmailRetryConfig controls redelivery of emails from the email outbox
+type EmailRetryConfig struct {
+	MaxAttempts int    `yaml:"max_attempts"` // Attempts before an email is marked failed
+	BaseBackoff string `yaml:"base_backoff"` // Delay before the first retry, doubled for every further attempt
+	MaxBackoff  string `yaml:"max_backoff"`
 }
 
 type SMTPConfig struct {
@@ -55,15 +79,65 @@ type SMTPConfig struct {
 	Username string `yaml:"username" env:"SMTP_USERNAME"`
 	Password string `yaml:"password" env:"SMTP_PASSWORD"`
 	From     string `yaml:"from" env:"SMTP_FROM"`
+	// TLS is "none", "starttls" (required) or "implicit" (port 465). Empty uses implicit TLS on
+	// port 465 and STARTTLS whenever the server offers it on other ports.
+	TLS                string `yaml:"tls" env:"SMTP_TLS"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env:"SMTP_INSECURE_SKIP_VERIFY"` // For local relays with self-signed certificates
+	Auth               string `yaml:"auth" env:"SMTP_AUTH"` // plain (default), login, cram-md5 or none
+	DialTimeout        string `yaml:"dial_timeout"`
+	SendTimeout        string `yaml:"send_timeout"`      // Limit for delivering one message, including the handshake
+	PoolSize           int    `yaml:"pool_size"`         // Idle connections kept open for reuse, 0 disables reuse
+	PoolIdleTimeout    string `yaml:"pool_idle_timeout"` // How long an idle connection is kept
+	RateLimit          int    `yaml:"rate_limit"`        // Emails per minute, 0 for no limit
 }
 
 type SendGridConfig struct {
-	APIKey string `yaml:"api_key" env:"SENDGRID_API_KEY"`
-	From   string `yaml:"from" env:"SENDGRID_FROM"`
+	APIKey  string `yaml:"api_key" env:"SENDGRID_API_KEY"`
+	From    string `yaml:"from" env:"SENDGRID_FROM"`
+	BaseURL string `yaml:"base_url" env:"SENDGRID_BASE_URL"`
+	RateLimit int  `yaml:"rate_limit"` // Emails per minute, 0 for no limit
 }
 
+// NotificationConfig configures the channels admins are notified on. Every enabled channel is
+// notified unless a form lists its own channels.
 type NotificationConfig struct {
-	Ntfy NtfyConfig `yaml:"ntfy"`
+	Ntfy    NtfyConfig                `yaml:"ntfy"`
+	Discord DiscordConfig             `yaml:"discord"`
+	Slack   SlackConfig               `yaml:"slack"`
+	Matrix  MatrixConfig              `yaml:"matrix"`
+	Gotify  GotifyConfig              `yaml:"gotify"`
+	Webhook NotificationWebhookConfig `yaml:"webhook"`
+	
+	Digest     DigestConfig     `yaml:"digest"`
+	QuietHours QuietHoursConfig `yaml:"quiet_hours"`
+	// Notifications at or above this priority skip digests and quiet hours. Failures are sent at
+	// priority 4.
+	UrgentPriority int `yaml:"urgent_priority"`
+	
+	Retry NotificationRetryConfig `yaml:"retry"`
+}
+
+// NotificationRetryConfig controls redelivery of notifications a channel failed to accept
+type NotificationRetryConfig struct {
+	MaxAttempts int    `yaml:"max_attempts"` // Attempts before a notification is marked failed
+	BaseBackoff string `yaml:"base_backoff"` // Delay before the first retry, doubled for every further attempt
+	MaxBackoff  string `yaml:"max_backoff"`
+}
+
+// DigestConfig batches submission notifications into one summary per interval
+type DigestConfig struct {
+	Enabled    bool     `yaml:"enabled"`
+	Interval   string   `yaml:"interval"`    // e.g. "1h" or "24h"; digests go out on multiples of it (UTC)
+	TopEntries int      `yaml:"top_entries"` // Entries listed per form
+	Forms      []string `yaml:"forms"`       // Forms to batch; empty batches every form
+}
+
+// QuietHoursConfig holds back non-urgent notifications during a daily window
+type QuietHoursConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Start    string `yaml:"start"`    // "22:00"
+	End      string `yaml:"end"`      // "07:00"
+	Timezone string `yaml:"timezone"` // IANA name, e.g. "Europe/Berlin"; defaults to the server's
 }
 
 type NtfyConfig struct {
@@ -71,6 +145,40 @@ type NtfyConfig struct {
 	URL     string `yaml:"url" env:"NTFY_URL"`
 	Topic   string `yaml:"topic" env:"NTFY_TOPIC"`
 	Token   string `yaml:"token" env:"NTFY_TOKEN"`
+	// How long action buttons, such as "Approve & Send Welcome Email", stay usable
+	ActionTokenTTL string `yaml:"action_token_ttl"`
+}
+
+type DiscordConfig struct {
+	Enabled    bool   `yaml:"enabled" env:"DISCORD_ENABLED"`
+	WebhookURL string `yaml:"webhook_url" env:"DISCORD_WEBHOOK_URL"`
+	Username   string `yaml:"username"`
+}
+
+type SlackConfig struct {
+	Enabled    bool   `yaml:"enabled" env:"SLACK_ENABLED"`
+	WebhookURL string `yaml:"webhook_url" env:"SLACK_WEBHOOK_URL"`
+}
+
+type MatrixConfig struct {
+	Enabled       bool   `yaml:"enabled" env:"MATRIX_ENABLED"`
+	HomeserverURL string `yaml:"homeserver_url" env:"MATRIX_HOMESERVER_URL"`
+	AccessToken   string `yaml:"access_token" env:"MATRIX_ACCESS_TOKEN"`
+	RoomID        string `yaml:"room_id" env:"MATRIX_ROOM_ID"`
+}
+
+type GotifyConfig struct {
+	Enabled bool   `yaml:"enabled" env:"GOTIFY_ENABLED"`
+	URL     string `yaml:"url" env:"GOTIFY_URL"`
+	Token   string `yaml:"token" env:"GOTIFY_TOKEN"` // Application token
+}
+
+// NotificationWebhookConfig posts notifications as JSON to any HTTP endpoint
+type NotificationWebhookConfig struct {
+	Enabled bool              `yaml:"enabled" env:"NOTIFY_WEBHOOK_ENABLED"`
+	URL     string            `yaml:"url" env:"NOTIFY_WEBHOOK_URL"`
+	Secret  string            `yaml:"secret" env:"NOTIFY_WEBHOOK_SECRET"` // Signs the body with HMAC-SHA256 when set
+	Headers map[string]string `yaml:"headers"`
 }
 
 type FormsConfig struct {
@@ -85,25 +193,75 @@ type FormConfig struct {
 	Actions     []ActionConfig      `yaml:"actions"`
 	Validation  ValidationConfig    `yaml:"validation"`
 	Email       FormEmailConfig     `yaml:"email"`
+	Spam        SpamConfig          `yaml:"spam"`
+	Approval    ApprovalConfig      `yaml:"approval"`
+	Notifications FormNotificationConfig `yaml:"notifications"`
+}
+
+// FormNotificationConfig routes a form's notifications and shapes their content. Title, body
+// and click values are templates rendered against the submission and its processing result.
+type FormNotificationConfig struct {
+	Channels []string                  `yaml:"channels"` // e.g. ["ntfy", "discord"]; empty notifies every enabled channel
+	Topic    string                    `yaml:"topic"`    // ntfy topic, defaults to notifications.ntfy.topic
+	Priority int                       `yaml:"priority"` // 1 (min) to 5 (max)
+	Tags     []string                  `yaml:"tags"`
+	Click    string                    `yaml:"click"`    // Defaults to the admin dashboard
+	Success  NotificationMessageConfig `yaml:"success"`
+	Failure  NotificationMessageConfig `yaml:"failure"`
+}
+
+// NotificationMessageConfig overrides a notification for one outcome. Empty values fall back to
+// the form's settings, then to the built-in message.
+type NotificationMessageConfig struct {
+	Title    string   `yaml:"title"`
+	Body     string   `yaml:"body"`
+	Priority int      `yaml:"priority"`
+	Tags     []string `yaml:"tags"`
+}
+
+// ApprovalConfig holds submissions for an admin to approve before the approval actions run
+type ApprovalConfig struct {
+	Enabled bool           `yaml:"enabled"`
+	When    string         `yaml:"when"`    // Optional condition selecting which submissions need approval
+	Actions []ActionConfig `yaml:"actions"` // Run once a submission is approved
 }
 
 type FieldConfig struct {
-	Name        string `yaml:"name"`
-	Type        string `yaml:"type"`
-	Required    bool   `yaml:"required"`
-	Validation  string `yaml:"validation"`
-	Label       string `yaml:"label"`
-	Placeholder string `yaml:"placeholder"`
+	Name        string   `yaml:"name"`
+	Type        string   `yaml:"type"`
+	Required    bool     `yaml:"required"`
+	Validation  string   `yaml:"validation"`
+	Label       string   `yaml:"label"`
+	Placeholder string   `yaml:"placeholder"`
+	MinLength   int      `yaml:"min_length"`
+	MaxLength   int      `yaml:"max_length"`
+	Min         *float64 `yaml:"min"`
+	Max         *float64 `yaml:"max"`
+	Options     []string `yaml:"options"`
 }
 
 type ActionConfig struct {
 	Type   string                 `yaml:"type"`
+	When   string                 `yaml:"when"` // Optional condition on the submission data, e.g. platform == "ios"
 	Config map[string]interface{} `yaml:"config"`
 }
 
 type ValidationConfig struct {
-	MaxSubmissionsPerHour int `yaml:"max_submissions_per_hour"`
-	RequireCaptcha        bool `yaml:"require_captcha"`
+	MaxSubmissionsPerHour         int  `yaml:"max_submissions_per_hour"`
+	MaxSubmissionsPerHourPerEmail int  `yaml:"max_submissions_per_hour_per_email"`
+	RequireCaptcha                bool `yaml:"require_captcha"`
+}
+
+// SpamConfig controls spam scoring for a form. Each signal adds to the submission's score and
+// submissions scoring at or above Threshold are stored as spam without running actions.
+type SpamConfig struct {
+	Enabled          bool     `yaml:"enabled"`
+	Threshold        float64  `yaml:"threshold"`
+	HoneypotFields   []string `yaml:"honeypot_fields"`
+	MinSubmitSeconds int      `yaml:"min_submit_seconds"`
+	MaxLinks         int      `yaml:"max_links"`
+	BlockedKeywords  []string `yaml:"blocked_keywords"`
+	RepeatWindow     string   `yaml:"repeat_window"`
 }
 
 type FormEmailConfig struct {
@@ -111,11 +269,27 @@ type FormEmailConfig struct {
 	Template        string `yaml:"template"`
 	Subject         string `yaml:"subject"`
 	SendConfirmation bool  `yaml:"send_confirmation"`
+	ReplyTo         string   `yaml:"reply_to"`    // Overrides email.reply_to
+	Attachments     []string `yaml:"attachments"` // Files attached to the confirmation email
+	ListUnsubscribe bool     `yaml:"list_unsubscribe"` // Adds the List-Unsubscribe header to emails sent to submitters
+	Admin           AdminEmailConfig `yaml:"admin"`
+}
+
+// AdminEmailConfig emails the form's admins a summary of each processed submission
+type AdminEmailConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	Recipients    []string `yaml:"recipients"`
+	OnlyOnFailure bool     `yaml:"only_on_failure"` // Skip submissions whose actions all succeeded
+	Template      string   `yaml:"template"`        // Defaults to "admin-notification"
+	Subject       string   `yaml:"subject"`         // A template, like notification titles
 }
 
 type GooglePlayConfig struct {
 	ServiceAccountFile string `yaml:"service_account_file" env:"GOOGLE_SERVICE_ACCOUNT_FILE"`
 	PackageName        string `yaml:"package_name" env:"GOOGLE_PACKAGE_NAME"`
+	APIBaseURL         string `yaml:"api_base_url" env:"GOOGLE_PLAY_API_URL"`
+	TokenURL           string `yaml:"token_url" env:"GOOGLE_TOKEN_URL"` // Overrides the token_uri of the service account
+	GoogleGroup        string `yaml:"google_group" env:"GOOGLE_PLAY_GROUP"` // Group listed on test tracks, which testers join
 }
 
 type AnalyticsConfig struct {
@@ -132,6 +306,27 @@ type FeedbackConfig struct {
 	RecipientEmail string `yaml:"recipient_email" env:"FEEDBACK_EMAIL"`
 }
 
+// JobsConfig controls the background worker pool that runs form actions
+type JobsConfig struct {
+	Workers      int    `yaml:"workers" env:"JOB_WORKERS"`
+	MaxAttempts  int    `yaml:"max_attempts" env:"JOB_MAX_ATTEMPTS"`
+	BaseBackoff  string `yaml:"base_backoff"`
+	MaxBackoff   string `yaml:"max_backoff"`
+	PollInterval string `yaml:"poll_interval"`
+}
+
+// CaptchaConfig selects the verifier used for forms with require_captcha set.
+// Provider is one of "hcaptcha", "turnstile", "recaptcha" or "pow" (built-in proof-of-work).
+type CaptchaConfig struct {
+	Provider      string  `yaml:"provider" env:"CAPTCHA_PROVIDER"`
+	SiteKey       string  `yaml:"site_key" env:"CAPTCHA_SITE_KEY"`
+	SecretKey     string  `yaml:"secret_key" env:"CAPTCHA_SECRET_KEY"`
+	VerifyURL     string  `yaml:"verify_url" env:"CAPTCHA_VERIFY_URL"`
+	MinScore      float64 `yaml:"min_score"`
+	PowDifficulty int     `yaml:"pow_difficulty"`
+	PowTTL        string  `yaml:"pow_ttl"`
+}
+
 // Load reads configuration from file and environment variables
 func Load(configPath string) (*Config, error) {
 	config := &Config{}
@@ -153,6 +348,17 @@ func Load(configPath string) (*Config, error) {
 	
 	// Override with environment variables
 	config.loadFromEnv()
+	config.Server.PublicURL = strings.TrimRight(config.Server.PublicURL, "/")
+	
+	// Signed tokens need a key; fall back to a random one that only lives for this process
+	if config.Server.SecretKey == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate secret key: %w", err)
+		}
+		config.Server.SecretKey = hex.EncodeToString(key)
+		fmt.Println("Warning: server.secret_key is not set, using a random key; signed tokens will not survive a restart")
+	}
 	
 	return config, nil
 }
@@ -171,11 +377,42 @@ func (c *Config) setDefaults() {
 	
 	c.Email.Provider = "smtp"
 	c.Email.SMTP.Port = 587
+	c.Email.SMTP.DialTimeout = "10s"
+	c.Email.SMTP.SendTimeout = "30s"
+	c.Email.SMTP.PoolSize = 2
+	c.Email.SMTP.PoolIdleTimeout = "30s"
+	c.Email.SMTP.RateLimit = 60
+	c.Email.SendGrid.BaseURL = "https://api.sendgrid.com"
+	c.Email.SendGrid.RateLimit = 600
+	c.Email.Retry.MaxAttempts = 5
+	c.Email.Retry.BaseBackoff = "1m"
+	c.Email.Retry.MaxBackoff = "1h"
+	c.Email.TemplatesDir = "email_templates"
+	
+	c.GooglePlay.APIBaseURL = "https://androidpublisher.googleapis.com"
 	
 	c.Forms.StorageDir = "./submissions"
 	
 	c.Analytics.Enabled = true
 	c.Analytics.SecretKey = "change-me-in-production"
+	
+	c.Notifications.Ntfy.ActionTokenTTL = "72h"
+	c.Notifications.Discord.Username = "PinePods Forms"
+	c.Notifications.UrgentPriority = 4
+	c.Notifications.Digest.Interval = "1h"
+	c.Notifications.Digest.TopEntries = 5
+	c.Notifications.Retry.MaxAttempts = 5
+	c.Notifications.Retry.BaseBackoff = "30s"
+	c.Notifications.Retry.MaxBackoff = "30m"
+	
+	c.Captcha.PowDifficulty = 18
+	c.Captcha.PowTTL = "10m"
+	
+	c.Jobs.Workers = 2
+	c.Jobs.MaxAttempts = 5
+	c.Jobs.BaseBackoff = "30s"
+	c.Jobs.MaxBackoff = "1h"
+	c.Jobs.PollInterval = "2s"
 }
 
 func (c *Config) loadFromEnv() {
@@ -188,6 +425,12 @@ func (c *Config) loadFromEnv() {
 	if debug := os.Getenv("DEBUG"); debug == "true" {
 		c.Server.Debug = true
 	}
+	if secretKey := os.Getenv("SECRET_KEY"); secretKey != "" {
+		c.Server.SecretKey = secretKey
+	}
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		c.Server.PublicURL = publicURL
+	}
 	
 	// Database env vars
 	if dbType := os.Getenv("DB_TYPE"); dbType != "" {
@@ -230,6 +473,33 @@ func (c *Config) loadFromEnv() {
 	if smtpFrom := os.Getenv("SMTP_FROM"); smtpFrom != "" {
 		c.Email.SMTP.From = smtpFrom
 	}
+	if smtpTLS := os.Getenv("SMTP_TLS"); smtpTLS != "" {
+		c.Email.SMTP.TLS = smtpTLS
+	}
+	if skipVerify := os.Getenv("SMTP_INSECURE_SKIP_VERIFY"); skipVerify == "true" {
+		c.Email.SMTP.InsecureSkipVerify = true
+	}
+	if smtpAuth := os.Getenv("SMTP_AUTH"); smtpAuth != "" {
+		c.Email.SMTP.Auth = smtpAuth
+	}
+	if sendgridKey := os.Getenv("SENDGRID_API_KEY"); sendgridKey != "" {
+		c.Email.SendGrid.APIKey = sendgridKey
+	}
+	if sendgridFrom := os.Getenv("SENDGRID_FROM"); sendgridFrom != "" {
+		c.Email.SendGrid.From = sendgridFrom
+	}
+	if sendgridURL := os.Getenv("SENDGRID_BASE_URL"); sendgridURL != "" {
+		c.Email.SendGrid.BaseURL = sendgridURL
+	}
+	if templatesDir := os.Getenv("EMAIL_TEMPLATES_DIR"); templatesDir != "" {
+		c.Email.TemplatesDir = templatesDir
+	}
+	if replyTo := os.Getenv("EMAIL_REPLY_TO"); replyTo != "" {
+		c.Email.ReplyTo = replyTo
+	}
+	if listUnsubscribe := os.Getenv("EMAIL_LIST_UNSUBSCRIBE"); listUnsubscribe != "" {
+		c.Email.ListUnsubscribe = listUnsubscribe
+	}
 	
 	// Ntfy env vars
 	if ntfyEnabled := os.Getenv("NTFY_ENABLED"); ntfyEnabled == "true" {
@@ -245,6 +515,50 @@ func (c *Config) loadFromEnv() {
 		c.Notifications.Ntfy.Token = ntfyToken
 	}
 	
+	// Other notification channel env vars
+	if discordEnabled := os.Getenv("DISCORD_ENABLED"); discordEnabled == "true" {
+		c.Notifications.Discord.Enabled = true
+	}
+	if discordURL := os.Getenv("DISCORD_WEBHOOK_URL"); discordURL != "" {
+		c.Notifications.Discord.WebhookURL = discordURL
+	}
+	if slackEnabled := os.Getenv("SLACK_ENABLED"); slackEnabled == "true" {
+		c.Notifications.Slack.Enabled = true
+	}
+	if slackURL := os.Getenv("SLACK_WEBHOOK_URL"); slackURL != "" {
+		c.Notifications.Slack.WebhookURL = slackURL
+	}
+	if matrixEnabled := os.Getenv("MATRIX_ENABLED"); matrixEnabled == "true" {
+		c.Notifications.Matrix.Enabled = true
+	}
+	if matrixURL := os.Getenv("MATRIX_HOMESERVER_URL"); matrixURL != "" {
+		c.Notifications.Matrix.HomeserverURL = matrixURL
+	}
+	if matrixToken := os.Getenv("MATRIX_ACCESS_TOKEN"); matrixToken != "" {
+		c.Notifications.Matrix.AccessToken = matrixToken
+	}
+	if matrixRoom := os.Getenv("MATRIX_ROOM_ID"); matrixRoom != "" {
+		c.Notifications.Matrix.RoomID = matrixRoom
+	}
+	if gotifyEnabled := os.Getenv("GOTIFY_ENABLED"); gotifyEnabled == "true" {
+		c.Notifications.Gotify.Enabled = true
+	}
+	if gotifyURL := os.Getenv("GOTIFY_URL"); gotifyURL != "" {
+		c.Notifications.Gotify.URL = gotifyURL
+	}
+	if gotifyToken := os.Getenv("GOTIFY_TOKEN"); gotifyToken != "" {
+		c.Notifications.Gotify.Token = gotifyToken
+	}
+	if webhookEnabled := os.Getenv("NOTIFY_WEBHOOK_ENABLED"); webhookEnabled == "true" {
+		c.Notifications.Webhook.Enabled = true
+	}
+	if webhookURL := os.Getenv("NOTIFY_WEBHOOK_URL"); webhookURL != "" {
+		c.Notifications.Webhook.URL = webhookURL
+	}
+	if webhookSecret := os.Getenv("NOTIFY_WEBHOOK_SECRET"); webhookSecret != "" {
+		c.Notifications.Webhook.Secret = webhookSecret
+	}
+	
 	// Google Play env vars
 	if serviceAccount := os.Getenv("GOOGLE_SERVICE_ACCOUNT_FILE"); serviceAccount != "" {
 		c.GooglePlay.ServiceAccountFile = serviceAccount
@@ -252,6 +566,15 @@ func (c *Config) loadFromEnv() {
 	if packageName := os.Getenv("GOOGLE_PACKAGE_NAME"); packageName != "" {
 		c.GooglePlay.PackageName = packageName
 	}
+	if apiURL := os.Getenv("GOOGLE_PLAY_API_URL"); apiURL != "" {
+		c.GooglePlay.APIBaseURL = apiURL
+	}
+	if tokenURL := os.Getenv("GOOGLE_TOKEN_URL"); tokenURL != "" {
+		c.GooglePlay.TokenURL = tokenURL
+	}
+	if group := os.Getenv("GOOGLE_PLAY_GROUP"); group != "" {
+		c.GooglePlay.GoogleGroup = group
+	}
 	
 	// Analytics env vars
 	if analyticsEnabled := os.Getenv("ANALYTICS_ENABLED"); analyticsEnabled == "false" {
@@ -273,4 +596,216 @@ func (c *Config) loadFromEnv() {
 	if feedbackEmail := os.Getenv("FEEDBACK_EMAIL"); feedbackEmail != "" {
 		c.Feedback.RecipientEmail = feedbackEmail
 	}
-}
\ No newline at end of file
+	
+	// Job queue env vars
+	if jobWorkers := os.Getenv("JOB_WORKERS"); jobWorkers != "" {
+		if workers, err := strconv.Atoi(jobWorkers); err == nil {
+			c.Jobs.Workers = workers
+		}
+	}
+	if jobAttempts := os.Getenv("JOB_MAX_ATTEMPTS"); jobAttempts != "" {
+		if attempts, err := strconv.Atoi(jobAttempts); err == nil {
+			c.Jobs.MaxAttempts = attempts
+		}
+	}
+	
+	// Captcha env vars
+	if captchaProvider := os.Getenv("CAPTCHA_PROVIDER"); captchaProvider != "" {
+		c.Captcha.Provider = captchaProvider
+	}
+	if captchaSiteKey := os.Getenv("CAPTCHA_SITE_KEY"); captchaSiteKey != "" {
+		c.Captcha.SiteKey = captchaSiteKey
+	}
+	if captchaSecret := os.Getenv("CAPTCHA_SECRET_KEY"); captchaSecret != "" {
+		c.Captcha.SecretKey = captchaSecret
+	}
+	if captchaVerifyURL := os.Getenv("CAPTCHA_VERIFY_URL"); captchaVerifyURL != "" {
+		c.Captcha.VerifyURL = captchaVerifyURL
+	}
+}
+
+// Validate checks settings that depend on each other. It is called once the configuration has
+// been loaded, before any service starts.
+func (c *Config) Validate() error {
+	if c.Server.PublicURL != "" {
+		parsed, err := url.Parse(c.Server.PublicURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("server.public_url must be an absolute http(s) URL, got '%s'", c.Server.PublicURL)
+		}
+		if parsed.RawQuery != "" || parsed.Fragment != "" {
+			return fmt.Errorf("server.public_url must not contain a query or fragment")
+		}
+	}
+	
+	switch c.Email.SMTP.TLS {
+	case "", "none", "starttls", "implicit":
+	default:
+		return fmt.Errorf("email.smtp.tls must be none, starttls or implicit, got '%s'", c.Email.SMTP.TLS)
+	}
+	switch strings.ToLower(c.Email.SMTP.Auth) {
+	case "", "plain", "login", "cram-md5", "none":
+	default:
+		return fmt.Errorf("email.smtp.auth must be plain, login, cram-md5 or none, got '%s'", c.Email.SMTP.Auth)
+	}
+	for name, value := range map[string]string{
+		"dial_timeout":      c.Email.SMTP.DialTimeout,
+		"send_timeout":      c.Email.SMTP.SendTimeout,
+		"pool_idle_timeout": c.Email.SMTP.PoolIdleTimeout,
+	} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+			return fmt.Errorf("email.smtp.%s must be a positive duration, got '%s'", name, value)
+		}
+	}
+	if c.Email.SMTP.PoolSize < 0 {
+		return fmt.Errorf("email.smtp.pool_size must not be negative")
+	}
+	if c.Email.SMTP.RateLimit < 0 || c.Email.SendGrid.RateLimit < 0 {
+		return fmt.Errorf("email rate_limit must not be negative")
+	}
+	
+	if c.Email.ReplyTo != "" {
+		if _, err := mail.ParseAddress(c.Email.ReplyTo); err != nil {
+			return fmt.Errorf("email.reply_to: invalid address '%s'", c.Email.ReplyTo)
+		}
+	}
+	if unsubscribe := c.Email.ListUnsubscribe; unsubscribe != "" {
+		if !strings.HasPrefix(unsubscribe, "mailto:") && !strings.HasPrefix(unsubscribe, "https://") {
+			return fmt.Errorf("email.list_unsubscribe must be a mailto: address or an https URL, got '%s'", unsubscribe)
+		}
+	}
+	
+	for formID, form := range c.Forms.Forms {
+		if form.Email.ReplyTo != "" {
+			if _, err := mail.ParseAddress(form.Email.ReplyTo); err != nil {
+				return fmt.Errorf("form '%s' email.reply_to: invalid address '%s'", formID, form.Email.ReplyTo)
+			}
+		}
+		for _, attachment := range form.Email.Attachments {
+			if info, err := os.Stat(attachment); err != nil || info.IsDir() {
+				return fmt.Errorf("form '%s' email.attachments: '%s' is not a readable file", formID, attachment)
+			}
+		}
+		if form.Email.ListUnsubscribe && c.Email.ListUnsubscribe == "" {
+			return fmt.Errorf("form '%s' sets email.list_unsubscribe but email.list_unsubscribe (EMAIL_LIST_UNSUBSCRIBE) is empty", formID)
+		}
+		if window := form.Spam.RepeatWindow; window != "" {
+			if d, err := time.ParseDuration(window); err != nil || d <= 0 {
+				return fmt.Errorf("form '%s' spam.repeat_window must be a positive duration, got '%s'", formID, window)
+			}
+		}
+	
+		admin := form.Email.Admin
+		if !admin.Enabled {
+			continue
+		}
+		if len(admin.Recipients) == 0 {
+			return fmt.Errorf("form '%s' email.admin.recipients must list at least one address", formID)
+		}
+		for _, recipient := range admin.Recipients {
+			if _, err := mail.ParseAddress(recipient); err != nil {
+				return fmt.Errorf("form '%s' email.admin.recipients: invalid address '%s'", formID, recipient)
+			}
+		}
+	}
+	
+	if c.GooglePlay.GoogleGroup != "" {
+		if _, err := mail.ParseAddress(c.GooglePlay.GoogleGroup); err != nil {
+			return fmt.Errorf("google_play.google_group must be the group's email address, got '%s'", c.GooglePlay.GoogleGroup)
+		}
+	} else if c.GooglePlay.ServiceAccountFile != "" && c.GooglePlay.PackageName != "" {
+		// Play test tracks list Google Groups, so the API can't add a tester's own address
+		if formID := c.formUsingAction("google_play_add_tester"); formID != "" {
+			return fmt.Errorf("google_play.google_group (GOOGLE_PLAY_GROUP) is required: form '%s' adds Google Play testers, and test tracks only accept Google Groups", formID)
+		}
+	}
+	
+	if c.Server.PublicURL == "" {
+		if reason := c.publicURLRequiredBy(); reason != "" {
+			return fmt.Errorf("server.public_url (PUBLIC_URL) is required: %s", reason)
+		}
+	}
+	
+	return nil
+}
+
+// publicURLRequiredBy names the first enabled feature that sends out links back to this server,
+// or returns "" when nothing does
+func (c *Config) publicURLRequiredBy() string {
+	formIDs := make([]string, 0, len(c.Forms.Forms))
+	for formID := range c.Forms.Forms {
+		formIDs = append(formIDs, formID)
+	}
+	sort.Strings(formIDs)
+	
+	for _, formID := range formIDs {
+		form := c.Forms.Forms[formID]
+		// Approval notifications on ntfy and webhooks carry a button that calls back into this server
+		if form.Approval.Enabled && (c.Notifications.Ntfy.Enabled || c.Notifications.Webhook.Enabled) {
+			return fmt.Sprintf("form '%s' uses approval and notifications link back to the server", formID)
+		}
+		if form.Email.Enabled && form.Email.Admin.Enabled {
+			return fmt.Sprintf("form '%s' sends admin emails, which link to the admin dashboard", formID)
+		}
+		for _, action := range form.Actions {
+			if mentionsPublicURL(action.Config) {
+				return fmt.Sprintf("a %s action of form '%s' uses {{.PublicURL}}", action.Type, formID)
+			}
+		}
+		for _, action := range form.Approval.Actions {
+			if mentionsPublicURL(action.Config) {
+				return fmt.Sprintf("a %s approval action of form '%s' uses {{.PublicURL}}", action.Type, formID)
+			}
+		}
+	}
+	return ""
+}
+
+// formUsingAction returns the first form, by ID, that runs an action of the given type at any
+// stage, or "" when none does
+func (c *Config) formUsingAction(actionType string) string {
+	formIDs := make([]string, 0, len(c.Forms.Forms))
+	for formID := range c.Forms.Forms {
+		formIDs = append(formIDs, formID)
+	}
+	sort.Strings(formIDs)
+	
+	for _, formID := range formIDs {
+		form := c.Forms.Forms[formID]
+		for _, action := range append(append([]ActionConfig{}, form.Actions...), form.Approval.Actions...) {
+			if action.Type == actionType {
+				return formID
+			}
+		}
+	}
+	return ""
+}
+
+// mentionsPublicURL reports whether an action config template refers to .PublicURL
+func mentionsPublicURL(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return strings.Contains(v, ".PublicURL")
+	case map[string]interface{}:
+		for _, item := range v {
+			if mentionsPublicURL(item) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if mentionsPublicURL(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PublicLink returns the absolute URL of path on the public server, e.g.
+// PublicLink("/api/admin/send-welcome-email")
+func (c *Config) PublicLink(path string) string {
+	return c.Server.PublicURL + "/" + strings.TrimLeft(path, "/")
+}
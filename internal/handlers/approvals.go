@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/services"
+)
+
+// approvalStatuses are the statuses the approvals list can be filtered by
+var approvalStatuses = map[string]bool{
+	models.SubmissionStatusPending:  true,
+	models.SubmissionStatusApproved: true,
+	models.SubmissionStatusRejected: true,
+	models.SubmissionStatusInvited:  true,
+}
+
+func (s *Server) getApprovals(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "50")
+	offsetStr := c.DefaultQuery("offset", "0")
+	status := c.DefaultQuery("status", models.SubmissionStatusPending)
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 50
+	}
+
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil {
+		offset = 0
+	}
+
+	if !approvalStatuses[status] {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid status, expected pending, approved, rejected or invited",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	submissions, err := s.formService.GetSubmissionsByStatus(status, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve submissions: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+	if submissions == nil {
+		submissions = []models.FormSubmission{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"submissions": submissions,
+		"count":       len(submissions),
+		"status":      status,
+	})
+}
+
+func (s *Server) approveSubmission(c *gin.Context) {
+	s.decideSubmission(c, true)
+}
+
+func (s *Server) rejectSubmission(c *gin.Context) {
+	s.decideSubmission(c, false)
+}
+
+func (s *Server) decideSubmission(c *gin.Context, approve bool) {
+	result, code := s.applyApprovalDecision(c.Param("id"), approve)
+	if !result.Success {
+		c.JSON(code, models.ErrorResponse{
+			Success: false,
+			Error:   result.Error,
+			Code:    code,
+		})
+		return
+	}
+
+	message := "Submission rejected"
+	if approve {
+		message = "Submission approved"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"result":  result,
+	})
+}
+
+func (s *Server) bulkApprove(c *gin.Context) {
+	s.bulkDecide(c, true)
+}
+
+func (s *Server) bulkReject(c *gin.Context) {
+	s.bulkDecide(c, false)
+}
+
+func (s *Server) bulkDecide(c *gin.Context, approve bool) {
+	var req struct {
+		SubmissionIDs []string `json:"submission_ids" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	results := make([]models.ApprovalResult, 0, len(req.SubmissionIDs))
+	succeeded := 0
+	for _, submissionID := range req.SubmissionIDs {
+		result, _ := s.applyApprovalDecision(submissionID, approve)
+		if result.Success {
+			succeeded++
+		}
+		results = append(results, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":   succeeded == len(results),
+		"results":   results,
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
+
+// applyApprovalDecision approves or rejects one submission, returning the outcome and the HTTP
+// status that describes it
+func (s *Server) applyApprovalDecision(submissionID string, approve bool) (models.ApprovalResult, int) {
+	result := models.ApprovalResult{SubmissionID: submissionID}
+
+	submission, err := s.formService.GetSubmission(submissionID)
+	if err != nil {
+		result.Error = "Submission not found"
+		return result, http.StatusNotFound
+	}
+
+	if approve {
+		err = s.formService.ApproveSubmission(submission)
+	} else {
+		err = s.formService.RejectSubmission(submission)
+	}
+	result.Status = submission.Status
+	if err != nil {
+		result.Error = err.Error()
+		if errors.Is(err, services.ErrInvalidApproval) {
+			return result, http.StatusConflict
+		}
+		return result, http.StatusInternalServerError
+	}
+
+	result.Success = true
+	return result, http.StatusOK
+}
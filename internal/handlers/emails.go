@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/services"
+)
+
+// emailStatuses are the statuses the email list can be filtered by
+var emailStatuses = map[string]bool{
+	models.EmailStatusPending: true,
+	models.EmailStatusSending: true,
+	models.EmailStatusSent:    true,
+	models.EmailStatusFailed:  true,
+}
+
+func (s *Server) getEmails(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "50")
+	offsetStr := c.DefaultQuery("offset", "0")
+	status := c.DefaultQuery("status", models.EmailStatusFailed)
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 50
+	}
+
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil {
+		offset = 0
+	}
+
+	filter := status
+	if status == "all" {
+		filter = ""
+	} else if !emailStatuses[status] {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid status, expected pending, sending, sent, failed or all",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	emails, err := s.emailService.GetEmailDeliveries(filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve emails: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"emails":  emails,
+		"count":   len(emails),
+		"status":  status,
+	})
+}
+
+func (s *Server) getEmail(c *gin.Context) {
+	email, err := s.emailService.GetEmailDelivery(c.Param("id"))
+	if err != nil {
+		code := http.StatusInternalServerError
+		message := "Failed to retrieve email: " + err.Error()
+		if errors.Is(err, sql.ErrNoRows) {
+			code = http.StatusNotFound
+			message = "Email not found"
+		}
+
+		c.JSON(code, models.ErrorResponse{
+			Success: false,
+			Error:   message,
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"email":   email,
+	})
+}
+
+func (s *Server) resendEmail(c *gin.Context) {
+	email, err := s.emailService.ResendEmail(c.Param("id"))
+	if err != nil {
+		code := http.StatusInternalServerError
+		message := "Failed to resend email: " + err.Error()
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			code = http.StatusNotFound
+			message = "Email not found"
+		case errors.Is(err, services.ErrEmailNotResendable):
+			code = http.StatusConflict
+			message = err.Error()
+		}
+
+		c.JSON(code, models.ErrorResponse{
+			Success: false,
+			Error:   message,
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Email queued for delivery",
+		"email":   email,
+	})
+}
+
+// emailPreviewRequest chooses what an email is rendered for: a stored submission, or sample data
+// for a form. Fields of the form missing from data get an example value.
+type emailPreviewRequest struct {
+	Template     string                   `json:"template"` // Defaults to the form's email.template
+	Subject      string                   `json:"subject"`
+	FormID       string                   `json:"form_id"`
+	SubmissionID string                   `json:"submission_id"`
+	Data         map[string]interface{}   `json:"data"`
+	Result       *models.ProcessingResult `json:"result"` // Action results for admin templates
+}
+
+func (s *Server) previewEmail(c *gin.Context) {
+	var req emailPreviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	submission, formConfig, ok := s.emailPreviewSubmission(c, req)
+	if !ok {
+		return
+	}
+
+	preview, err := s.emailService.PreviewEmail(req.Template, req.Subject, submission, formConfig, req.Result)
+	if err != nil {
+		s.emailRenderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"email":      preview,
+		"submission": submission,
+	})
+}
+
+func (s *Server) sendTestEmail(c *gin.Context) {
+	var req struct {
+		emailPreviewRequest
+		To string `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid request format: " + err.Error(),
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+	if _, err := mail.ParseAddress(req.To); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid email address: " + req.To,
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	var id string
+	var err error
+	if req.Template == "" && req.FormID == "" && req.SubmissionID == "" {
+		// Nothing to render, so just check the provider settings
+		id, err = s.emailService.SendTestEmail(req.To)
+	} else {
+		submission, formConfig, ok := s.emailPreviewSubmission(c, req.emailPreviewRequest)
+		if !ok {
+			return
+		}
+		id, err = s.emailService.SendPreviewEmail(req.To, req.Template, req.Subject, submission, formConfig, req.Result)
+	}
+	if err != nil {
+		s.emailRenderError(c, err)
+		return
+	}
+
+	email, err := s.emailService.GetEmailDelivery(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve queued email: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("Test email queued for %s", req.To),
+		"email":   email,
+	})
+}
+
+// emailPreviewSubmission loads the submission an email preview is rendered for, or builds a
+// sample one for the form. It writes the error response and returns false when neither exists.
+func (s *Server) emailPreviewSubmission(c *gin.Context, req emailPreviewRequest) (*models.FormSubmission, config.FormConfig, bool) {
+	if req.SubmissionID != "" {
+		submission, err := s.formService.GetSubmission(req.SubmissionID)
+		if err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Success: false,
+				Error:   "Submission not found",
+				Code:    http.StatusNotFound,
+			})
+			return nil, config.FormConfig{}, false
+		}
+		formConfig, _ := s.formService.GetFormConfig(submission.FormID)
+		return submission, formConfig, true
+	}
+
+	if req.FormID == "" {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Either submission_id or form_id is required",
+			Code:    http.StatusBadRequest,
+		})
+		return nil, config.FormConfig{}, false
+	}
+	formConfig, exists := s.formService.GetFormConfig(req.FormID)
+	if !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Form not found",
+			Code:    http.StatusNotFound,
+		})
+		return nil, config.FormConfig{}, false
+	}
+	return services.SampleSubmission(req.FormID, formConfig, req.Data), formConfig, true
+}
+
+// emailRenderError responds to a template that is unknown or fails to render
+func (s *Server) emailRenderError(c *gin.Context, err error) {
+	code := http.StatusInternalServerError
+	message := "Failed to render email: " + err.Error()
+	if errors.Is(err, services.ErrUnknownEmailTemplate) {
+		code = http.StatusNotFound
+		message = err.Error()
+	}
+
+	c.JSON(code, models.ErrorResponse{
+		Success: false,
+		Error:   message,
+		Code:    code,
+	})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -36,6 +37,29 @@ func (s *Server) submitForm(c *gin.Context) {
 		return
 	}
 
+	// Verify captcha for forms that require one
+	if formConfig, exists := s.formService.GetFormConfig(req.FormID); exists && formConfig.Validation.RequireCaptcha {
+		if err := s.captchaVerifier.Verify(c.Request.Context(), req.CaptchaToken, c.ClientIP()); err != nil {
+			status := http.StatusForbidden
+			message := "Captcha verification failed: " + err.Error()
+			switch {
+			case errors.Is(err, services.ErrCaptchaRequired):
+				status = http.StatusBadRequest
+			case errors.Is(err, services.ErrCaptchaUnavailable):
+				// Our outage, not the visitor's fault, and the details are for the logs only
+				fmt.Printf("[ERROR] Captcha verification for form %s failed: %v\n", req.FormID, err)
+				status = http.StatusServiceUnavailable
+				message = "Captcha verification is temporarily unavailable, please try again later"
+			}
+			c.JSON(status, models.ErrorResponse{
+				Success: false,
+				Error:   message,
+				Code:    status,
+			})
+			return
+		}
+	}
+
 	// Get client info
 	submission := &models.FormSubmission{
 		FormID:      req.FormID,
@@ -43,10 +67,31 @@ func (s *Server) submitForm(c *gin.Context) {
 		IPAddress:   c.ClientIP(),
 		UserAgent:   c.GetHeader("User-Agent"),
 		SubmittedAt: time.Now().UTC(),
+		RenderToken: req.RenderToken,
 	}
 
 	// Process the submission
 	result, err := s.formService.ProcessSubmission(submission)
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusUnprocessableEntity, models.ValidationErrorResponse{
+			Success: false,
+			Error:   "Validation failed",
+			Code:    http.StatusUnprocessableEntity,
+			Fields:  validationErr.Fields,
+		})
+		return
+	}
+	var quotaErr *services.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		c.Header("Retry-After", strconv.Itoa(quotaErr.RetryAfterSeconds()))
+		c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+			Success: false,
+			Error:   "Too many submissions for this form, please try again later",
+			Code:    http.StatusTooManyRequests,
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
@@ -56,9 +101,10 @@ func (s *Server) submitForm(c *gin.Context) {
 		return
 	}
 
-	// Send notification if enabled
-	if s.config.Notifications.Ntfy.Enabled {
-		go s.notificationService.SendSubmissionNotification(submission, result)
+	// Actions run in the background and the notification is sent once they have finished,
+	// so spam held for review stays quiet until an admin releases it
+	if result.Spam {
+		fmt.Printf("[SPAM] Submission %s held for review\n", submission.ID)
 	}
 
 	c.JSON(http.StatusOK, models.SubmissionResponse{
@@ -69,6 +115,39 @@ func (s *Server) submitForm(c *gin.Context) {
 	})
 }
 
+func (s *Server) getCaptcha(c *gin.Context) {
+	if s.captchaVerifier == nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Captcha is not configured",
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	response := gin.H{
+		"success":  true,
+		"provider": s.captchaVerifier.Name(),
+		"site_key": s.config.Captcha.SiteKey,
+	}
+
+	// The built-in proof-of-work captcha hands out a fresh challenge with every request
+	if pow, ok := s.captchaVerifier.(*services.ProofOfWorkVerifier); ok {
+		challenge, err := pow.NewChallenge()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Success: false,
+				Error:   "Failed to create captcha challenge: " + err.Error(),
+				Code:    http.StatusInternalServerError,
+			})
+			return
+		}
+		response["challenge"] = challenge
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
 func (s *Server) listForms(c *gin.Context) {
 	forms := s.formService.GetAvailableForms()
 	c.JSON(http.StatusOK, gin.H{
@@ -95,6 +174,23 @@ func (s *Server) getForm(c *gin.Context) {
 	})
 }
 
+func (s *Server) getRenderToken(c *gin.Context) {
+	formID := c.Param("id")
+	if _, exists := s.formService.GetFormConfig(formID); !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Form not found",
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"render_token": s.formService.NewRenderToken(formID),
+	})
+}
+
 func (s *Server) getFormSubmissions(c *gin.Context) {
 	formID := c.Param("id")
 	
@@ -173,9 +269,71 @@ func (s *Server) getSubmission(c *gin.Context) {
 		return
 	}
 
+	jobs, err := s.formService.GetSubmissionJobs(submissionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve action jobs: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	executions, err := s.formService.GetSubmissionExecutions(submissionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve action history: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	emails, err := s.emailService.GetSubmissionEmails(submissionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve emails: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success":    true,
 		"submission": submission,
+		"jobs":       jobs,
+		"executions": executions,
+		"emails":     emails,
+	})
+}
+
+func (s *Server) getSubmissionExecutions(c *gin.Context) {
+	submissionID := c.Param("id")
+	
+	if _, err := s.formService.GetSubmission(submissionID); err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Submission not found",
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	executions, err := s.formService.GetSubmissionExecutions(submissionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve action history: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"executions": executions,
+		"count":      len(executions),
 	})
 }
 
@@ -213,17 +371,129 @@ func (s *Server) reprocessSubmission(c *gin.Context) {
 
 	result, err := s.formService.ReprocessSubmission(submission)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrActionsPending) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{
 			Success: false,
 			Error:   "Failed to reprocess submission: " + err.Error(),
+			Code:    status,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Submission queued for reprocessing",
+		"result":  result,
+	})
+}
+
+func (s *Server) getSpamSubmissions(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "50")
+	offsetStr := c.DefaultQuery("offset", "0")
+	
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 50
+	}
+	
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil {
+		offset = 0
+	}
+
+	submissions, err := s.formService.GetSubmissionsByStatus(models.SubmissionStatusSpam, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve spam submissions: " + err.Error(),
 			Code:    http.StatusInternalServerError,
 		})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"submissions": submissions,
+		"count":       len(submissions),
+	})
+}
+
+func (s *Server) getPlayTesters(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "50")
+	offsetStr := c.DefaultQuery("offset", "0")
+	status := c.Query("status")
+	
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 50
+	}
+	
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil {
+		offset = 0
+	}
+
+	testers, err := s.formService.GetPlayTesters(status, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve Google Play testers: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"testers": testers,
+		"count":   len(testers),
+	})
+}
+
+func (s *Server) releaseSubmission(c *gin.Context) {
+	submissionID := c.Param("id")
+	
+	submission, err := s.formService.GetSubmission(submissionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Success: false,
+			Error:   "Submission not found",
+			Code:    http.StatusNotFound,
+		})
+		return
+	}
+
+	if submission.Status != models.SubmissionStatusSpam {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Success: false,
+			Error:   "Submission is not marked as spam",
+			Code:    http.StatusConflict,
+		})
+		return
+	}
+
+	// The notifications were suppressed when the submission arrived, they are sent once the
+	// released submission's actions have finished
+	result, err := s.formService.ReleaseSubmission(submission)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrNotSpam) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to release submission: " + err.Error(),
+			Code:    status,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Submission reprocessed successfully",
+		"message": "Submission released and queued for processing",
 		"result":  result,
 	})
 }
@@ -232,6 +502,7 @@ func (s *Server) sendWelcomeEmail(c *gin.Context) {
 	var req struct {
 		SubmissionID string `json:"submission_id" binding:"required"`
 		Email        string `json:"email" binding:"required"`
+		Token        string `json:"token" binding:"required"`
 	}
 	
 	fmt.Printf("[DEBUG] Received welcome email request: %+v\n", c.Request.Body)
@@ -275,26 +546,71 @@ func (s *Server) sendWelcomeEmail(c *gin.Context) {
 	}
 
 	fmt.Printf("[DEBUG] Found form config: %+v\n", formConfig)
+
+	// This endpoint is called by ntfy buttons without an admin session, so it needs the
+	// single-use token issued for this submission and email address. The token is given back
+	// if the approval or the welcome email fails, straight away or once the email or the
+	// approval actions have failed for good, so the button can be pressed again.
+	releaseToken, err := s.formService.RedeemActionToken(req.Token, services.ActionTokenWelcomeEmail, submission, req.Email)
+	if err != nil {
+		fmt.Printf("[ERROR] Rejected welcome email request for submission %s: %v\n", submission.ID, err)
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrInvalidActionToken) {
+			status = http.StatusForbidden
+		}
+		c.JSON(status, models.ErrorResponse{
+			Success: false,
+			Error:   "Action not allowed: " + err.Error(),
+			Code:    status,
+		})
+		return
+	}
+
+	// Forms with an approval workflow send the welcome email as one of their approval actions
+	if formConfig.Approval.Enabled {
+		if err := s.formService.ApproveSubmission(submission); err != nil {
+			releaseToken()
+			status := http.StatusInternalServerError
+			if errors.Is(err, services.ErrInvalidApproval) {
+				status = http.StatusConflict
+			}
+			c.JSON(status, models.ErrorResponse{
+				Success: false,
+				Error:   "Failed to approve submission: " + err.Error(),
+				Code:    status,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": fmt.Sprintf("Submission approved, welcome email queued for %s", req.Email),
+		})
+		return
+	}
 	fmt.Printf("[DEBUG] SMTP Config: Host=%s, Port=%d, From=%s\n", 
 		s.config.Email.SMTP.Host, s.config.Email.SMTP.Port, s.config.Email.SMTP.From)
 
 	// Send welcome email
-	emailService := services.NewEmailService(s.config)
-	err = emailService.SendWelcomeEmail(submission, formConfig, req.Email)
+	err = s.emailService.SendWelcomeEmail(submission, formConfig, req.Email)
 	if err != nil {
+		releaseToken()
 		fmt.Printf("[ERROR] Failed to send welcome email: %v\n", err)
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Success: false,
-			Error:   "Failed to send welcome email: " + err.Error(),
+			Error:   "Failed to queue welcome email: " + err.Error(),
 			Code:    http.StatusInternalServerError,
 		})
 		return
 	}
 
-	fmt.Printf("[SUCCESS] Welcome email sent to %s\n", req.Email)
+	fmt.Printf("[SUCCESS] Welcome email queued for %s\n", req.Email)
+	if err := s.formService.MarkSubmissionInvited(submission); err != nil {
+		fmt.Printf("[ERROR] Failed to mark submission %s as invited: %v\n", submission.ID, err)
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": fmt.Sprintf("Welcome email sent to %s", req.Email),
+		"message": fmt.Sprintf("Welcome email queued for %s", req.Email),
 	})
 }
 
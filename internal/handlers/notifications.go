@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/services"
+)
+
+// notificationStatuses are the statuses the notification list can be filtered by
+var notificationStatuses = map[string]bool{
+	models.NotificationStatusPending:  true,
+	models.NotificationStatusSending:  true,
+	models.NotificationStatusSent:     true,
+	models.NotificationStatusFailed:   true,
+	models.NotificationStatusHeld:     true,
+	models.NotificationStatusDigest:   true,
+	models.NotificationStatusDigested: true,
+}
+
+func (s *Server) getNotifications(c *gin.Context) {
+	limitStr := c.DefaultQuery("limit", "50")
+	offsetStr := c.DefaultQuery("offset", "0")
+	status := c.DefaultQuery("status", models.NotificationStatusFailed)
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil {
+		limit = 50
+	}
+
+	offset, err := strconv.Atoi(offsetStr)
+	if err != nil {
+		offset = 0
+	}
+
+	filter := status
+	if status == "all" {
+		filter = ""
+	} else if !notificationStatuses[status] {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Success: false,
+			Error:   "Invalid status, expected pending, sending, sent, failed or all",
+			Code:    http.StatusBadRequest,
+		})
+		return
+	}
+
+	notifications, err := s.notificationService.GetNotificationDeliveries(filter, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Success: false,
+			Error:   "Failed to retrieve notifications: " + err.Error(),
+			Code:    http.StatusInternalServerError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":       true,
+		"notifications": notifications,
+		"count":         len(notifications),
+		"status":        status,
+	})
+}
+
+func (s *Server) resendNotification(c *gin.Context) {
+	notification, err := s.notificationService.ResendNotification(c.Param("id"))
+	if err != nil {
+		code := http.StatusInternalServerError
+		message := "Failed to resend notification: " + err.Error()
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			code = http.StatusNotFound
+			message = "Notification not found"
+		case errors.Is(err, services.ErrNotificationNotResendable):
+			code = http.StatusConflict
+			message = err.Error()
+		}
+
+		c.JSON(code, models.ErrorResponse{
+			Success: false,
+			Error:   message,
+			Code:    code,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":      true,
+		"message":      "Notification queued for delivery",
+		"notification": notification,
+	})
+}
@@ -3,12 +3,14 @@ package handlers
 import (
 	"context"
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
 	"github.com/madeofpendletonwool/pinepods-admin/internal/services"
 )
 
@@ -17,9 +19,10 @@ type Server struct {
 	router              *gin.Engine
 	httpServer          *http.Server
 	formService         *services.FormService
-	actionService       *services.ActionService
 	notificationService *services.NotificationService
+	emailService        *services.EmailService
 	analyticsService    *services.AnalyticsService
+	captchaVerifier     services.CaptchaVerifier
 }
 
 func NewServer(cfg *config.Config) *Server {
@@ -31,19 +34,34 @@ func NewServer(cfg *config.Config) *Server {
 	
 	// Initialize services
 	formService := services.NewFormService(cfg)
-	actionService := services.NewActionService(cfg)
-	notificationService := services.NewNotificationService(cfg)
+	notificationService, err := services.NewNotificationService(cfg, formService.GetDB())
+	if err != nil {
+		log.Fatalf("Failed to initialize notifications: %v", err)
+	}
 	analyticsService := services.NewAnalyticsService(cfg, formService.GetDB()) // We need to expose the DB
+	captchaVerifier, err := services.NewCaptchaVerifier(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize captcha verifier: %v", err)
+	}
+	for formID, form := range cfg.Forms.Forms {
+		if form.Validation.RequireCaptcha && captchaVerifier == nil {
+			log.Fatalf("Form '%s' requires a captcha but no captcha provider is configured", formID)
+		}
+	}
 
 	server := &Server{
 		config:              cfg,
 		router:              router,
 		formService:         formService,
-		actionService:       actionService,
 		notificationService: notificationService,
+		emailService:        formService.EmailService(),
 		analyticsService:    analyticsService,
+		captchaVerifier:     captchaVerifier,
 	}
 
+	// Notify once the background workers have finished a submission's actions
+	formService.OnSubmissionProcessed(server.notifySubmissionProcessed)
+
 	server.setupMiddleware()
 	server.setupRoutes()
 
@@ -58,6 +76,20 @@ func NewServer(cfg *config.Config) *Server {
 	return server
 }
 
+// notifySubmissionProcessed sends the notification and the admin email for a processed submission
+func (s *Server) notifySubmissionProcessed(submission *models.FormSubmission, result *models.ProcessingResult) {
+	if s.notificationService.Enabled() {
+		if err := s.notificationService.SendSubmissionNotification(submission, result); err != nil {
+			log.Printf("Failed to send notification for submission %s: %v", submission.ID, err)
+		}
+	}
+	if formConfig, exists := s.config.Forms.Forms[submission.FormID]; exists {
+		if err := s.emailService.SendNotificationEmail(submission, formConfig, result); err != nil {
+			log.Printf("Failed to send admin email for submission %s: %v", submission.ID, err)
+		}
+	}
+}
+
 func (s *Server) setupMiddleware() {
 	// CORS
 	corsConfig := cors.Config{
@@ -103,6 +135,7 @@ func (s *Server) setupRoutes() {
 	{
 		// Form submission
 		api.POST("/forms/submit", s.submitForm)
+		api.GET("/captcha", s.getCaptcha)
 		
 		// Form management
 		forms := api.Group("/forms")
@@ -110,6 +143,7 @@ func (s *Server) setupRoutes() {
 			forms.GET("/", s.listForms)
 			forms.GET("/:id", s.getForm)
 			forms.GET("/:id/submissions", s.getFormSubmissions)
+			forms.GET("/:id/render-token", s.getRenderToken)
 		}
 		
 		// Analytics routes
@@ -131,8 +165,24 @@ func (s *Server) setupRoutes() {
 		{
 			admin.GET("/submissions", s.getAllSubmissions)
 			admin.GET("/submissions/:id", s.getSubmission)
+			admin.GET("/submissions/:id/executions", s.getSubmissionExecutions)
 			admin.DELETE("/submissions/:id", s.deleteSubmission)
 			admin.POST("/submissions/:id/reprocess", s.reprocessSubmission)
+			admin.POST("/submissions/:id/release", s.releaseSubmission)
+			admin.POST("/submissions/:id/approve", s.approveSubmission)
+			admin.POST("/submissions/:id/reject", s.rejectSubmission)
+			admin.GET("/approvals", s.getApprovals)
+			admin.POST("/approvals/approve", s.bulkApprove)
+			admin.POST("/approvals/reject", s.bulkReject)
+			admin.GET("/spam", s.getSpamSubmissions)
+			admin.GET("/play-testers", s.getPlayTesters)
+			admin.GET("/notifications", s.getNotifications)
+			admin.POST("/notifications/:id/resend", s.resendNotification)
+			admin.GET("/emails", s.getEmails)
+			admin.GET("/emails/:id", s.getEmail)
+			admin.POST("/emails/:id/resend", s.resendEmail)
+			admin.POST("/emails/preview", s.previewEmail)
+			admin.POST("/emails/test", s.sendTestEmail)
 			admin.POST("/analytics/cleanup", s.cleanupAnalytics)
 			
 			// Feedback specific routes
@@ -149,13 +199,18 @@ func (s *Server) setupRoutes() {
 }
 
 func (s *Server) Start() error {
+	s.formService.StartWorkers()
+	s.notificationService.Start()
 	return s.httpServer.ListenAndServe()
 }
 
 func (s *Server) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	return s.httpServer.Shutdown(ctx)
+	err := s.httpServer.Shutdown(ctx)
+	s.formService.StopWorkers()
+	s.notificationService.Stop()
+	return err
 }
 
 func rateLimitMiddleware(requestsPerMinute int) gin.HandlerFunc {
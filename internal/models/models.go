@@ -4,6 +4,16 @@ import (
 	"time"
 )
 
+// Submission statuses
+const (
+	SubmissionStatusReceived = "received"
+	SubmissionStatusSpam     = "spam"
+	SubmissionStatusPending  = "pending"  // Waiting for an admin to approve or reject it
+	SubmissionStatusApproved = "approved" // Approved, approval actions queued or failed
+	SubmissionStatusRejected = "rejected"
+	SubmissionStatusInvited  = "invited" // Approved and every approval action succeeded
+)
+
 // FormSubmission represents a form submission stored in the database
 type FormSubmission struct {
 	ID          string                 `json:"id" db:"id"`
@@ -15,12 +25,19 @@ type FormSubmission struct {
 	Processed   bool                   `json:"processed" db:"processed"`
 	ProcessedAt *time.Time             `json:"processed_at,omitempty" db:"processed_at"`
 	Error       string                 `json:"error,omitempty" db:"error"`
+	Status      string                 `json:"status" db:"status"`
+	SpamScore   float64                `json:"spam_score" db:"spam_score"`
+	SpamReasons []string               `json:"spam_reasons,omitempty" db:"spam_reasons"`
+	ContentHash string                 `json:"-" db:"content_hash"`
+	RenderToken string                 `json:"-" db:"-"` // Signed form render timestamp, only present on incoming submissions
 }
 
 // SubmissionRequest represents the incoming form submission request
 type SubmissionRequest struct {
-	FormID string                 `json:"form_id" binding:"required"`
-	Data   map[string]interface{} `json:"data" binding:"required"`
+	FormID       string                 `json:"form_id" binding:"required"`
+	Data         map[string]interface{} `json:"data" binding:"required"`
+	CaptchaToken string                 `json:"captcha_token,omitempty"`
+	RenderToken  string                 `json:"render_token,omitempty"`
 }
 
 // SubmissionResponse represents the response sent back after form submission
@@ -38,6 +55,20 @@ type ErrorResponse struct {
 	Code    int    `json:"code"`
 }
 
+// FieldError describes why a single submitted field failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse is returned when submission data fails field validation
+type ValidationErrorResponse struct {
+	Success bool         `json:"success"`
+	Error   string       `json:"error"`
+	Code    int          `json:"code"`
+	Fields  []FieldError `json:"fields"`
+}
+
 // FormInfo represents basic information about a form
 type FormInfo struct {
 	ID          string `json:"id"`
@@ -48,10 +79,23 @@ type FormInfo struct {
 
 // ActionResult represents the result of executing an action
 type ActionResult struct {
-	ActionType string `json:"action_type"`
+	ActionType string          `json:"action_type"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Error      string          `json:"error,omitempty"`
+	Skipped    bool            `json:"skipped,omitempty"`
+	Permanent  bool            `json:"permanent,omitempty"` // retrying cannot fix the failure, e.g. a 4xx response
+	EmailID    string          `json:"email_id,omitempty"`  // Outbox email queued by the action
+	Attempts   []ActionAttempt `json:"attempts,omitempty"`
+}
+
+// ActionAttempt represents a single delivery attempt made by an action (e.g. a webhook call)
+type ActionAttempt struct {
+	Attempt    int    `json:"attempt"`
 	Success    bool   `json:"success"`
-	Message    string `json:"message"`
+	StatusCode int    `json:"status_code,omitempty"`
 	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
 }
 
 // ProcessingResult represents the overall result of processing a submission
@@ -59,10 +103,161 @@ type ProcessingResult struct {
 	SubmissionID string         `json:"submission_id"`
 	FormID       string         `json:"form_id"`
 	Success      bool           `json:"success"`
+	Spam         bool           `json:"spam,omitempty"`
 	Actions      []ActionResult `json:"actions"`
 	ProcessedAt  time.Time      `json:"processed_at"`
 }
 
+// Action job statuses
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusDead      = "dead"
+	// JobStatusBlocked is an approval job waiting for the approval action before it to succeed
+	JobStatusBlocked = "blocked"
+	// JobStatusWaiting is a job whose action queued an email; it finishes once the email is sent
+	// or fails
+	JobStatusWaiting = "waiting"
+)
+
+// Action stages: submission actions run when a form is submitted, approval actions when an
+// admin approves the submission
+const (
+	ActionStageSubmission = "submission"
+	ActionStageApproval   = "approval"
+)
+
+// ActionJob represents one form action queued for background execution
+type ActionJob struct {
+	ID           string    `json:"id" db:"id"`
+	SubmissionID string    `json:"submission_id" db:"submission_id"`
+	FormID       string    `json:"form_id" db:"form_id"`
+	Stage        string    `json:"stage" db:"stage"`
+	ActionIndex  int       `json:"action_index" db:"action_index"`
+	ActionType   string    `json:"action_type" db:"action_type"`
+	Status       string    `json:"status" db:"status"`
+	Attempts     int       `json:"attempts" db:"attempts"`
+	MaxAttempts  int       `json:"max_attempts" db:"max_attempts"`
+	NextRunAt    time.Time `json:"next_run_at" db:"next_run_at"`
+	LastMessage  string    `json:"last_message,omitempty" db:"last_message"`
+	LastError    string    `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// ActionExecution records a single run of a form action, whether from the job queue,
+// a reprocess or a spam release
+type ActionExecution struct {
+	ID           string                 `json:"id" db:"id"`
+	SubmissionID string                 `json:"submission_id" db:"submission_id"`
+	JobID        string                 `json:"job_id,omitempty" db:"job_id"`
+	Stage        string                 `json:"stage" db:"stage"`
+	ActionIndex  int                    `json:"action_index" db:"action_index"`
+	ActionType   string                 `json:"action_type" db:"action_type"`
+	Config       map[string]interface{} `json:"config" db:"config"`
+	Success      bool                   `json:"success" db:"success"`
+	Message      string                 `json:"message,omitempty" db:"message"`
+	Error        string                 `json:"error,omitempty" db:"error"`
+	DurationMs   int64                  `json:"duration_ms" db:"duration_ms"`
+	Attempt      int                    `json:"attempt" db:"attempt"`
+	ExecutedAt   time.Time              `json:"executed_at" db:"executed_at"`
+}
+
+// Play tester statuses. Test tracks list Google Groups rather than people, so a tester is never
+// added directly: either the track lists the configured group and the tester has to join it, or
+// an admin adds the tester in the Play Console by hand.
+const (
+	PlayTesterStatusPending     = "pending"      // Waiting to be added by hand in the Play Console
+	PlayTesterStatusJoinPending = "join_pending" // The track lists the group, the tester still has to join it
+	PlayTesterStatusFailed      = "failed"
+)
+
+// PlayTester tracks an email address being added to a Google Play testing track
+type PlayTester struct {
+	ID           string    `json:"id" db:"id"`
+	Email        string    `json:"email" db:"email"`
+	PackageName  string    `json:"package_name" db:"package_name"`
+	Track        string    `json:"track" db:"track"`
+	Status       string    `json:"status" db:"status"`
+	SubmissionID string    `json:"submission_id,omitempty" db:"submission_id"`
+	Error        string    `json:"error,omitempty" db:"error"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Notification delivery statuses
+const (
+	NotificationStatusPending = "pending"
+	NotificationStatusSending = "sending"
+	NotificationStatusSent    = "sent"
+	NotificationStatusFailed  = "failed"
+	// Buffered until next_attempt_at: held for quiet hours, or waiting for a digest
+	NotificationStatusHeld   = "held"
+	NotificationStatusDigest = "digest"
+	// Included in a digest that was queued in its place
+	NotificationStatusDigested = "digested"
+)
+
+// NotificationDelivery is one notification queued for one channel in the notification outbox
+type NotificationDelivery struct {
+	ID            string                 `json:"id" db:"id"`
+	Channel       string                 `json:"channel" db:"channel"`
+	FormID        string                 `json:"form_id,omitempty" db:"form_id"`
+	SubmissionID  string                 `json:"submission_id,omitempty" db:"submission_id"`
+	Title         string                 `json:"title" db:"title"`
+	Payload       map[string]interface{} `json:"payload" db:"payload"`
+	Status        string                 `json:"status" db:"status"`
+	Attempts      int                    `json:"attempts" db:"attempts"`
+	MaxAttempts   int                    `json:"max_attempts" db:"max_attempts"`
+	NextAttemptAt time.Time              `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     string                 `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time              `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time              `json:"updated_at" db:"updated_at"`
+	SentAt        *time.Time             `json:"sent_at,omitempty" db:"sent_at"`
+}
+
+// Email outbox statuses
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSending = "sending"
+	EmailStatusSent    = "sent"
+	EmailStatusFailed  = "failed"
+)
+
+// EmailDelivery is one email in the email outbox. The bodies and attachments are only filled in
+// when a single email is fetched.
+type EmailDelivery struct {
+	ID            string     `json:"id" db:"id"`
+	Template      string     `json:"template,omitempty" db:"template"`
+	FormID        string     `json:"form_id,omitempty" db:"form_id"`
+	SubmissionID  string     `json:"submission_id,omitempty" db:"submission_id"`
+	JobID         string     `json:"job_id,omitempty" db:"job_id"` // Action job waiting for the delivery
+	MessageID     string     `json:"message_id,omitempty" db:"message_id"`
+	To            string     `json:"to" db:"recipient"`
+	Subject       string     `json:"subject" db:"subject"`
+	ReplyTo       string     `json:"reply_to,omitempty" db:"reply_to"`
+	Status        string     `json:"status" db:"status"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	MaxAttempts   int        `json:"max_attempts" db:"max_attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty" db:"sent_at"`
+	HTMLBody      string     `json:"html_body,omitempty" db:"html_body"`
+	TextBody      string     `json:"text_body,omitempty" db:"text_body"`
+	Attachments   []string   `json:"attachments,omitempty"` // File names
+}
+
+// ApprovalResult reports the outcome of approving or rejecting one submission
+type ApprovalResult struct {
+	SubmissionID string `json:"submission_id"`
+	Success      bool   `json:"success"`
+	Status       string `json:"status,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
 // PinepodsAnalytics represents analytics data from a Pinepods server
 type PinepodsAnalytics struct {
 	ID         string    `json:"id" db:"id"`
@@ -1,206 +1,481 @@
 package services
 
 import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
 	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
 )
 
+func init() {
+	RegisterAction(googlePlayTesterAction{})
+	RegisterAction(sendEmailAction{})
+	RegisterAction(sendFeedbackEmailAction{})
+	RegisterAction(webhookAction{})
+	RegisterAction(logAction{})
+}
+
 type ActionService struct {
 	config *config.Config
+
+	conditionsMu sync.Mutex
+	conditions   map[string]*Condition
+	templates    *actionTemplates
+	googlePlay   *GooglePlayService
+	email        *EmailService
 }
 
-func NewActionService(cfg *config.Config) *ActionService {
+func NewActionService(cfg *config.Config, db *sql.DB, emailService *EmailService) *ActionService {
 	return &ActionService{
-		config: cfg,
+		config:     cfg,
+		conditions: make(map[string]*Condition),
+		templates:  newActionTemplates(),
+		googlePlay: NewGooglePlayService(cfg, db),
+		email:      emailService,
 	}
 }
 
-func (as *ActionService) ProcessActions(submission *models.FormSubmission, formConfig config.FormConfig) *models.ProcessingResult {
-	result := &models.ProcessingResult{
-		SubmissionID: submission.ID,
-		FormID:       submission.FormID,
-		Success:      true,
-		ProcessedAt:  time.Now().UTC(),
-		Actions:      []models.ActionResult{},
-	}
-
-	// Process each action defined in the form config
-	for _, actionConfig := range formConfig.Actions {
-		actionResult := as.executeAction(submission, actionConfig)
-		result.Actions = append(result.Actions, actionResult)
-		
-		// If any action fails, mark the overall result as failed
-		if !actionResult.Success {
-			result.Success = false
+func (as *ActionService) executeAction(ctx context.Context, submission *models.FormSubmission, actionConfig config.ActionConfig, jobID string, attempt int) models.ActionResult {
+	// Config errors don't go away on a retry, so they are permanent
+	failed := func(message, errMsg string, permanent bool) models.ActionResult {
+		return models.ActionResult{ActionType: actionConfig.Type, Success: false, Message: message, Error: errMsg, Permanent: permanent}
+	}
+
+	action, exists := LookupAction(actionConfig.Type)
+	if !exists {
+		return failed("Unknown action type", fmt.Sprintf("Action type '%s' is not supported", actionConfig.Type), true)
+	}
+
+	formConfig, exists := as.config.Forms.Forms[submission.FormID]
+	if !exists {
+		return failed("Form configuration not found", fmt.Sprintf("form '%s' is not configured", submission.FormID), true)
+	}
+
+	if actionConfig.When != "" {
+		matched, err := as.conditionMatches(actionConfig.When, submission)
+		if err != nil {
+			return failed("Invalid action condition", err.Error(), true)
 		}
+		if !matched {
+			return models.ActionResult{
+				ActionType: actionConfig.Type,
+				Success:    true,
+				Skipped:    true,
+				Message:    fmt.Sprintf("Skipped: condition '%s' not met", actionConfig.When),
+			}
+		}
+	}
+
+	// Render templated config values such as {{.Data.email}} against the submission. Templates
+	// are parsed at startup, so a render error comes from the submission's data (e.g. a field of
+	// an unexpected type) and is retried like any other failure.
+	rendered, err := as.templates.render(submission, formConfig, as.config.Server.PublicURL, actionConfig.Config)
+	if err != nil {
+		return failed("Failed to render action config", err.Error(), false)
 	}
+	actionConfig.Config = rendered
 
+	result := action.Execute(ctx, &ActionRequest{
+		Submission: submission,
+		Form:       formConfig,
+		Action:     actionConfig,
+		AppConfig:  as.config,
+		JobID:      jobID,
+		Attempt:    attempt,
+		actions:    as,
+	})
+	if result.ActionType == "" {
+		result.ActionType = actionConfig.Type
+	}
 	return result
 }
 
-func (as *ActionService) executeAction(submission *models.FormSubmission, actionConfig config.ActionConfig) models.ActionResult {
-	switch actionConfig.Type {
-	case "google_play_add_tester":
-		return as.addGooglePlayTester(submission, actionConfig)
-	case "send_email":
-		return as.sendEmailAction(submission, actionConfig)
-	case "send_feedback_email":
-		return as.sendFeedbackEmail(submission, actionConfig)
-	case "webhook":
-		return as.sendWebhook(submission, actionConfig)
-	case "log":
-		return as.logAction(submission, actionConfig)
-	default:
-		return models.ActionResult{
-			ActionType: actionConfig.Type,
-			Success:    false,
-			Message:    "Unknown action type",
-			Error:      fmt.Sprintf("Action type '%s' is not supported", actionConfig.Type),
+// conditionMatches evaluates an action's when expression, caching the compiled form
+func (as *ActionService) conditionMatches(expr string, submission *models.FormSubmission) (bool, error) {
+	as.conditionsMu.Lock()
+	condition, exists := as.conditions[expr]
+	if !exists {
+		var err error
+		condition, err = CompileCondition(expr)
+		if err != nil {
+			as.conditionsMu.Unlock()
+			return false, fmt.Errorf("invalid when condition '%s': %w", expr, err)
 		}
+		as.conditions[expr] = condition
 	}
+	as.conditionsMu.Unlock()
+
+	return condition.Evaluate(submission.Data), nil
+}
+
+// googlePlayTesterAction adds the submitter to a Google Play testing track
+type googlePlayTesterAction struct{}
+
+func (googlePlayTesterAction) Name() string {
+	return "google_play_add_tester"
+}
+
+func (googlePlayTesterAction) Validate(cfg map[string]interface{}) error {
+	return validateConfigStrings(cfg, "track")
 }
 
-func (as *ActionService) addGooglePlayTester(submission *models.FormSubmission, actionConfig config.ActionConfig) models.ActionResult {
+func (googlePlayTesterAction) Execute(ctx context.Context, req *ActionRequest) models.ActionResult {
+	submission := req.Submission
 	result := models.ActionResult{
 		ActionType: "google_play_add_tester",
-		Success:    true,
-		Message:    "Tester details logged for manual addition to Google Play Console",
+		Success:    false,
 	}
 
-	// Extract email from submission for logging
-	emailService := NewEmailService(as.config)
-	email := emailService.GetEmailFromSubmission(submission)
+	email := req.actions.email.GetEmailFromSubmission(submission)
 	if email == "" {
-		result.Success = false
 		result.Error = "No email address found in submission"
 		result.Message = "Email address required for Google Play testing"
 		return result
 	}
 
-	// Log the submission details - manual addition required
-	fmt.Printf("[MANUAL ACTION REQUIRED] Add %s to Google Play Internal Testing\n", email)
+	track := configString(req.Action.Config, "track", "internal")
+	googlePlay := req.actions.googlePlay
 
+	tester, err := googlePlay.AddTester(ctx, submission.ID, email, track)
+	if err != nil {
+		fmt.Printf("[GOOGLE PLAY] Failed to open the %s track to %s: %v\n", track, email, err)
+		result.Error = err.Error()
+		result.Message = fmt.Sprintf("Failed to update the Google Play %s track", track)
+		return result
+	}
+
+	result.Success = true
+	if tester.Status == models.PlayTesterStatusPending {
+		// Google Play or its group isn't configured, so the tester has to be added by hand
+		fmt.Printf("[MANUAL ACTION REQUIRED] Add %s to Google Play %s testing\n", email, track)
+		result.Message = "Tester details logged for manual addition to Google Play Console"
+		return result
+	}
+
+	group := req.AppConfig.GooglePlay.GoogleGroup
+	fmt.Printf("[GOOGLE PLAY] The %s track lists %s, waiting for %s to join it\n", track, group, email)
+	result.Message = fmt.Sprintf("The Google Play %s track lists %s; %s has to join the group to test", track, group, email)
 	return result
 }
 
-func (as *ActionService) sendEmailAction(submission *models.FormSubmission, actionConfig config.ActionConfig) models.ActionResult {
+// sendEmailAction emails the submitter. The action's template and subject config override the
+// form's email settings, so a form can send different emails depending on its when conditions.
+type sendEmailAction struct{}
+
+func (sendEmailAction) Name() string {
+	return "send_email"
+}
+
+func (sendEmailAction) Validate(cfg map[string]interface{}) error {
+	return validateConfigStrings(cfg, "template", "subject")
+}
+
+func (sendEmailAction) Execute(ctx context.Context, req *ActionRequest) models.ActionResult {
+	submission, actionConfig, formConfig := req.Submission, req.Action, req.Form
 	result := models.ActionResult{
 		ActionType: "send_email",
 		Success:    false,
 	}
 
-	// Get form config
-	formConfig, exists := as.config.Forms.Forms[submission.FormID]
-	if !exists {
-		result.Error = "Form configuration not found"
-		result.Message = "Cannot send email: form config missing"
+	templateName := configString(actionConfig.Config, "template", "")
+	subject := configString(actionConfig.Config, "subject", formConfig.Email.Subject)
+
+	if !formConfig.Email.Enabled {
+		result.Success = true
+		result.Skipped = true
+		result.Message = "Email is disabled for this form"
 		return result
 	}
 
-	emailService := NewEmailService(as.config)
-
-	// Check if this is iOS internal testing - send welcome email immediately
-	if submission.FormID == "internal-testing-signup" {
-		// Check platform
-		platform, platformExists := submission.Data["platform"]
-		if platformExists && platform == "ios" {
-			// For iOS, send welcome email immediately (no manual approval needed)
-			email := emailService.GetEmailFromSubmission(submission)
-			if email == "" {
-				fmt.Printf("[ERROR] iOS welcome email failed for submission %s: No email address found\n", submission.ID[:8])
-				result.Error = "No email address found in submission"
-				result.Message = "Cannot send email: email address missing"
-				return result
-			}
-
-			fmt.Printf("[DEBUG] Attempting to send iOS welcome email to %s for submission %s\n", email, submission.ID[:8])
-			err := emailService.SendWelcomeEmail(submission, formConfig, email)
-			if err != nil {
-				fmt.Printf("[ERROR] iOS welcome email failed for submission %s to %s: %v\n", submission.ID[:8], email, err)
-				result.Error = err.Error()
-				result.Message = "Failed to send welcome email"
-				return result
-			}
-
-			fmt.Printf("[SUCCESS] iOS welcome email sent automatically to %s for submission %s (external app access)\n", email, submission.ID[:8])
-			result.Success = true
-			result.Message = "iOS welcome email sent immediately (external app access)"
-			return result
-		}
+	// Without an explicit template this is the form's regular confirmation email
+	if templateName == "" && !formConfig.Email.SendConfirmation {
+		result.Success = true
+		result.Skipped = true
+		result.Message = "Confirmation emails are disabled for this form"
+		return result
 	}
-
-	// For Android internal testing, don't send any automatic email - wait for manual approval
-	if submission.FormID == "internal-testing-signup" {
-		platform, platformExists := submission.Data["platform"]
-		if platformExists && platform == "android" {
-			fmt.Printf("[INFO] Android testing signup received for submission %s - no automatic email sent, waiting for manual approval\n", submission.ID[:8])
-			result.Success = true
-			result.Message = "Android signup processed - awaiting manual approval for welcome email"
-			return result
-		}
+	if templateName == "" {
+		templateName = formConfig.Email.Template
 	}
 
-	// For other forms (like contact-form, feedback-form), send regular confirmation email
+	emailService := req.actions.email
 	email := emailService.GetEmailFromSubmission(submission)
-	fmt.Printf("[DEBUG] Attempting to send confirmation email to %s for submission %s (platform: %v)\n", email, submission.ID[:8], submission.Data["platform"])
+	if email == "" {
+		fmt.Printf("[ERROR] Email failed for submission %s: No email address found\n", submission.ID[:8])
+		result.Error = "No email address found in submission"
+		result.Message = "Cannot send email: email address missing"
+		return result
+	}
+
+	fmt.Printf("[DEBUG] Attempting to send '%s' email to %s for submission %s\n", templateName, email, submission.ID[:8])
 	
-	err := emailService.SendConfirmationEmail(submission, formConfig)
+	emailID, err := emailService.queueTemplateEmail(submission, formConfig, email, templateName, subject, req.JobID)
 	if err != nil {
-		fmt.Printf("[ERROR] Confirmation email failed for submission %s to %s: %v\n", submission.ID[:8], email, err)
+		fmt.Printf("[ERROR] Email failed for submission %s to %s: %v\n", submission.ID[:8], email, err)
 		result.Error = err.Error()
-		result.Message = "Failed to send email"
+		result.Message = "Failed to queue email"
 		return result
 	}
 
-	fmt.Printf("[SUCCESS] Confirmation email sent to %s for submission %s\n", email, submission.ID[:8])
+	fmt.Printf("[SUCCESS] '%s' email queued for %s for submission %s\n", templateName, email, submission.ID[:8])
 	result.Success = true
-	result.Message = "Email sent successfully"
+	result.Message = fmt.Sprintf("Email to %s queued for delivery", email)
+	result.EmailID = emailID
 	return result
 }
 
-func (as *ActionService) sendFeedbackEmail(submission *models.FormSubmission, actionConfig config.ActionConfig) models.ActionResult {
+// sendFeedbackEmailAction forwards a submission to the feedback recipient
+type sendFeedbackEmailAction struct{}
+
+func (sendFeedbackEmailAction) Name() string {
+	return "send_feedback_email"
+}
+
+func (sendFeedbackEmailAction) Validate(cfg map[string]interface{}) error {
+	return validateConfigStrings(cfg, "template")
+}
+
+func (sendFeedbackEmailAction) Execute(ctx context.Context, req *ActionRequest) models.ActionResult {
+	submission, appConfig := req.Submission, req.AppConfig
 	result := models.ActionResult{
 		ActionType: "send_feedback_email",
 		Success:    false,
 	}
 
-	if as.config.Feedback.RecipientEmail == "" {
+	if appConfig.Feedback.RecipientEmail == "" {
 		result.Error = "Feedback recipient email not configured"
 		result.Message = "Cannot send feedback: FEEDBACK_EMAIL environment variable not set"
 		return result
 	}
 
-	emailService := NewEmailService(as.config)
-	err := emailService.SendFeedbackNotification(submission, as.config.Feedback.RecipientEmail)
+	emailID, err := req.actions.email.queueFeedbackNotification(submission, appConfig.Feedback.RecipientEmail, req.JobID)
 	if err != nil {
 		result.Error = err.Error()
-		result.Message = "Failed to send feedback notification"
+		result.Message = "Failed to queue feedback notification"
 		return result
 	}
 
 	result.Success = true
-	result.Message = fmt.Sprintf("Feedback notification sent to %s", as.config.Feedback.RecipientEmail)
+	result.Message = fmt.Sprintf("Feedback notification queued for %s", appConfig.Feedback.RecipientEmail)
+	result.EmailID = emailID
 	return result
 }
 
-func (as *ActionService) sendWebhook(submission *models.FormSubmission, actionConfig config.ActionConfig) models.ActionResult {
+// WebhookPayload is the JSON body POSTed by the webhook action
+type WebhookPayload struct {
+	Event        string                 `json:"event"`
+	SubmissionID string                 `json:"submission_id"`
+	FormID       string                 `json:"form_id"`
+	Data         map[string]interface{} `json:"data"`
+	SubmittedAt  time.Time              `json:"submitted_at"`
+	SentAt       time.Time              `json:"sent_at"`
+}
+
+// webhookAction POSTs the submission as JSON to a configured URL
+type webhookAction struct{}
+
+func (webhookAction) Name() string {
+	return "webhook"
+}
+
+func (webhookAction) Validate(cfg map[string]interface{}) error {
+	rawURL, _ := cfg["url"].(string)
+	if rawURL == "" {
+		return fmt.Errorf("'url' is required")
+	}
+	if !isTemplated(rawURL) {
+		if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("'url' must be an http(s) URL, got '%s'", rawURL)
+		}
+	}
+
+	if err := validateConfigStrings(cfg, "method", "secret", "signature_header"); err != nil {
+		return err
+	}
+	if method, ok := cfg["method"].(string); ok && !isTemplated(method) {
+		switch strings.ToUpper(method) {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			return fmt.Errorf("'method' must be POST, PUT or PATCH, got '%s'", method)
+		}
+	}
+
+	if err := validateConfigDurations(cfg, "timeout", "retry_backoff"); err != nil {
+		return err
+	}
+	// The retry policy is read when the jobs are queued, before anything is rendered
+	if backoff, ok := cfg["retry_backoff"].(string); ok && isTemplated(backoff) {
+		return fmt.Errorf("'retry_backoff' cannot be a template")
+	}
+	if retries, exists := cfg["max_retries"]; exists {
+		if n, ok := configInt(retries); !ok || n < 0 {
+			return fmt.Errorf("'max_retries' must be a whole number of at least 0")
+		}
+	}
+	if headers, exists := cfg["headers"]; exists {
+		if _, ok := headers.(map[string]interface{}); !ok {
+			return fmt.Errorf("'headers' must be a map of header names to values")
+		}
+	}
+	return nil
+}
+
+// RetryPolicy lets a webhook set its own retries: each retry is another job attempt, and
+// retry_backoff replaces jobs.base_backoff as the delay that doubles after every attempt
+func (webhookAction) RetryPolicy(cfg map[string]interface{}) (int, time.Duration) {
+	maxAttempts := 0
+	if retries, ok := configInt(cfg["max_retries"]); ok && retries >= 0 {
+		maxAttempts = retries + 1
+	}
+	return maxAttempts, configDuration(cfg, "retry_backoff", 0)
+}
+
+func (webhookAction) Execute(ctx context.Context, req *ActionRequest) models.ActionResult {
+	submission, actionConfig := req.Submission, req.Action
 	result := models.ActionResult{
 		ActionType: "webhook",
 		Success:    false,
 	}
 
-	// Webhook implementation would go here
-	// This is a placeholder for now
-	result.Error = "Webhook action not yet implemented"
-	result.Message = "Webhook functionality coming soon"
-	
+	webhookURL := configString(actionConfig.Config, "url", "")
+	if webhookURL == "" {
+		result.Error = "Webhook URL not configured"
+		result.Message = "Cannot send webhook: 'url' is missing from the action config"
+		result.Permanent = true
+		return result
+	}
+
+	method := strings.ToUpper(configString(actionConfig.Config, "method", http.MethodPost))
+	timeout := configDuration(actionConfig.Config, "timeout", 10*time.Second)
+	headers := configStringMap(actionConfig.Config, "headers")
+	secret := configString(actionConfig.Config, "secret", "")
+	signatureHeader := configString(actionConfig.Config, "signature_header", "X-Pinepods-Signature")
+
+	body, err := json.Marshal(WebhookPayload{
+		Event:        "form.submitted",
+		SubmissionID: submission.ID,
+		FormID:       submission.FormID,
+		Data:         submission.Data,
+		SubmittedAt:  submission.SubmittedAt,
+		SentAt:       time.Now().UTC(),
+	})
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to marshal webhook payload: %v", err)
+		result.Message = "Failed to build webhook payload"
+		result.Permanent = true
+		return result
+	}
+
+	// The job id stays the same when the queue retries, so receivers can use it to drop duplicates
+	deliveryID := req.JobID
+	if deliveryID == "" {
+		deliveryID = uuid.New().String()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		result.Error = fmt.Sprintf("failed to create webhook request: %v", err)
+		result.Message = "Invalid webhook configuration"
+		result.Permanent = true
+		return result
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "PinePods-Forms-Webhook/1.0")
+	httpReq.Header.Set("X-Pinepods-Delivery", deliveryID)
+	httpReq.Header.Set("X-Pinepods-Event", "form.submitted")
+	for key, value := range headers {
+		httpReq.Header.Set(key, value)
+	}
+	if secret != "" {
+		httpReq.Header.Set(signatureHeader, "sha256="+signPayload(secret, body))
+	}
+
+	client := &http.Client{Timeout: timeout}
+	start := time.Now()
+	resp, err := client.Do(httpReq)
+	duration := time.Since(start)
+
+	attemptResult := models.ActionAttempt{
+		Attempt:    req.Attempt,
+		DurationMs: duration.Milliseconds(),
+	}
+
+	if err != nil {
+		attemptResult.Error = err.Error()
+	} else {
+		// Drain the body so the connection can be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+
+		attemptResult.StatusCode = resp.StatusCode
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			attemptResult.Success = true
+		} else {
+			attemptResult.Error = fmt.Sprintf("webhook returned status %d", resp.StatusCode)
+			result.Permanent = !retryableStatus(resp.StatusCode)
+		}
+	}
+
+	result.Attempts = append(result.Attempts, attemptResult)
+
+	if attemptResult.Success {
+		fmt.Printf("[WEBHOOK] Delivered submission %s to %s (status %d, attempt %d)\n", submission.ID, webhookURL, attemptResult.StatusCode, req.Attempt)
+		result.Success = true
+		result.Message = fmt.Sprintf("Webhook delivered (status %d)", attemptResult.StatusCode)
+		return result
+	}
+
+	fmt.Printf("[WEBHOOK] Attempt %d for submission %s to %s failed: %s\n", req.Attempt, submission.ID, webhookURL, attemptResult.Error)
+	result.Error = attemptResult.Error
+	if result.Permanent {
+		result.Message = "Webhook rejected the delivery, it will not be retried"
+	} else {
+		result.Message = "Webhook delivery failed"
+	}
 	return result
 }
 
-func (as *ActionService) logAction(submission *models.FormSubmission, actionConfig config.ActionConfig) models.ActionResult {
+// retryableStatus reports whether a failed webhook response may succeed on a later attempt:
+// server errors, timeouts and rate limiting. Other 4xx responses are the request's fault.
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// signPayload returns the hex encoded HMAC-SHA256 of body using secret
+func signPayload(secret string, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// logAction writes the submission to the server log
+type logAction struct{}
+
+func (logAction) Name() string {
+	return "log"
+}
+
+func (logAction) Validate(cfg map[string]interface{}) error {
+	return validateConfigStrings(cfg, "message")
+}
+
+func (logAction) Execute(ctx context.Context, req *ActionRequest) models.ActionResult {
+	submission, actionConfig := req.Submission, req.Action
 	result := models.ActionResult{
 		ActionType: "log",
 		Success:    true,
@@ -224,4 +499,55 @@ func (as *ActionService) logAction(submission *models.FormSubmission, actionConf
 		submission.Data)
 
 	return result
-}
\ No newline at end of file
+}
+
+// configString reads a string value from an action config map
+func configString(cfg map[string]interface{}, key, defaultValue string) string {
+	if value, exists := cfg[key]; exists {
+		if str, ok := value.(string); ok && str != "" {
+			return str
+		}
+	}
+	return defaultValue
+}
+
+// configDuration reads a duration from an action config map. Strings use time.ParseDuration
+// syntax ("5s", "1m"), bare numbers are treated as seconds.
+func configDuration(cfg map[string]interface{}, key string, defaultValue time.Duration) time.Duration {
+	switch value := cfg[key].(type) {
+	case int:
+		return time.Duration(value) * time.Second
+	case float64:
+		return time.Duration(value * float64(time.Second))
+	case string:
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// configInt reads a whole number from an action config value, which YAML may decode as an int
+// or a float64
+func configInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), true
+		}
+	}
+	return 0, false
+}
+
+// configStringMap reads a map of strings (e.g. HTTP headers) from an action config map
+func configStringMap(cfg map[string]interface{}, key string) map[string]string {
+	result := make(map[string]string)
+	if values, ok := cfg[key].(map[string]interface{}); ok {
+		for k, v := range values {
+			result[k] = fmt.Sprintf("%v", v)
+		}
+	}
+	return result
+}
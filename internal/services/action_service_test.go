@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+func TestWebhookActionValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     map[string]interface{}
+		wantErr string // "" when the config is valid
+	}{
+		{"minimal", map[string]interface{}{"url": "https://example.com/hook"}, ""},
+		{"templated url", map[string]interface{}{"url": "{{ .Data.hook }}"}, ""},
+		{"full", map[string]interface{}{
+			"url":           "https://example.com/hook",
+			"method":        "put",
+			"secret":        "s3cret",
+			"timeout":       "5s",
+			"max_retries":   3,
+			"retry_backoff": "30s",
+			"headers":       map[string]interface{}{"X-Token": "abc"},
+		}, ""},
+		{"no retries", map[string]interface{}{"url": "https://example.com/hook", "max_retries": 0}, ""},
+		{"missing url", map[string]interface{}{}, "'url' is required"},
+		{"not http", map[string]interface{}{"url": "ftp://example.com/hook"}, "must be an http(s) URL"},
+		{"bad method", map[string]interface{}{"url": "https://example.com/hook", "method": "GET"}, "must be POST, PUT or PATCH"},
+		{"negative retries", map[string]interface{}{"url": "https://example.com/hook", "max_retries": -1}, "'max_retries'"},
+		{"fractional retries", map[string]interface{}{"url": "https://example.com/hook", "max_retries": 1.5}, "'max_retries'"},
+		{"bad backoff", map[string]interface{}{"url": "https://example.com/hook", "retry_backoff": "soon"}, "retry_backoff"},
+		{"templated backoff", map[string]interface{}{"url": "https://example.com/hook", "retry_backoff": "{{ .Data.delay }}"}, "cannot be a template"},
+		{"headers not a map", map[string]interface{}{"url": "https://example.com/hook", "headers": "X-Token: abc"}, "'headers'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := webhookAction{}.Validate(tt.cfg)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWebhookActionRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         map[string]interface{}
+		wantMax     int
+		wantBackoff time.Duration
+	}{
+		{"queue defaults", map[string]interface{}{}, 0, 0},
+		{"no retries", map[string]interface{}{"max_retries": 0}, 1, 0},
+		{"retries and backoff", map[string]interface{}{"max_retries": 4, "retry_backoff": "30s"}, 5, 30 * time.Second},
+		{"backoff in seconds", map[string]interface{}{"retry_backoff": 2}, 0, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxAttempts, backoff := actionRetryPolicy(config.ActionConfig{Type: "webhook", Config: tt.cfg})
+			if maxAttempts != tt.wantMax || backoff != tt.wantBackoff {
+				t.Errorf("RetryPolicy = (%d, %s), want (%d, %s)", maxAttempts, backoff, tt.wantMax, tt.wantBackoff)
+			}
+		})
+	}
+}
+
+func TestWebhookActionExecute(t *testing.T) {
+	submission := &models.FormSubmission{
+		ID:          "sub-1",
+		FormID:      "contact-form",
+		Data:        map[string]interface{}{"name": "Jane"},
+		SubmittedAt: time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name          string
+		status        int
+		wantSuccess   bool
+		wantPermanent bool
+	}{
+		{"delivered", http.StatusOK, true, false},
+		{"accepted", http.StatusAccepted, true, false},
+		{"server error is retried", http.StatusBadGateway, false, false},
+		{"rate limited is retried", http.StatusTooManyRequests, false, false},
+		{"timeout is retried", http.StatusRequestTimeout, false, false},
+		{"client error is permanent", http.StatusBadRequest, false, true},
+		{"gone is permanent", http.StatusGone, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *http.Request
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r
+				body, _ = io.ReadAll(r.Body)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			result := webhookAction{}.Execute(context.Background(), &ActionRequest{
+				Submission: submission,
+				Action: config.ActionConfig{Type: "webhook", Config: map[string]interface{}{
+					"url":     server.URL + "/hook",
+					"method":  "put",
+					"secret":  "s3cret",
+					"headers": map[string]interface{}{"X-Token": "abc"},
+				}},
+				JobID:   "job-1",
+				Attempt: 2,
+			})
+
+			if result.Success != tt.wantSuccess || result.Permanent != tt.wantPermanent {
+				t.Fatalf("result = success %t permanent %t (%s), want success %t permanent %t", result.Success, result.Permanent, result.Error, tt.wantSuccess, tt.wantPermanent)
+			}
+			if len(result.Attempts) != 1 || result.Attempts[0].Attempt != 2 || result.Attempts[0].StatusCode != tt.status {
+				t.Errorf("attempts = %+v, want attempt 2 with status %d", result.Attempts, tt.status)
+			}
+
+			if got.Method != http.MethodPut || got.URL.Path != "/hook" {
+				t.Errorf("request = %s %s, want PUT /hook", got.Method, got.URL.Path)
+			}
+			// Retries of the same job share the delivery id, so receivers can drop duplicates
+			if delivery := got.Header.Get("X-Pinepods-Delivery"); delivery != "job-1" {
+				t.Errorf("X-Pinepods-Delivery = %q, want the job id", delivery)
+			}
+			if token := got.Header.Get("X-Token"); token != "abc" {
+				t.Errorf("X-Token = %q, want the configured header", token)
+			}
+			if signature := got.Header.Get("X-Pinepods-Signature"); signature != "sha256="+signPayload("s3cret", body) {
+				t.Errorf("X-Pinepods-Signature = %q, want the HMAC of the body", signature)
+			}
+
+			var payload WebhookPayload
+			if err := json.Unmarshal(body, &payload); err != nil {
+				t.Fatalf("body isn't a webhook payload: %v", err)
+			}
+			if payload.Event != "form.submitted" || payload.SubmissionID != "sub-1" || payload.FormID != "contact-form" || payload.Data["name"] != "Jane" {
+				t.Errorf("payload = %+v, want the submission", payload)
+			}
+		})
+	}
+}
+
+func TestWebhookActionUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	result := webhookAction{}.Execute(context.Background(), &ActionRequest{
+		Submission: &models.FormSubmission{ID: "sub-1", FormID: "contact-form"},
+		Action:     config.ActionConfig{Type: "webhook", Config: map[string]interface{}{"url": url}},
+		Attempt:    1,
+	})
+
+	// A receiver that is down may come back, so the job queue retries
+	if result.Success || result.Permanent {
+		t.Errorf("result = success %t permanent %t, want a retryable failure", result.Success, result.Permanent)
+	}
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// ActionTemplateData is the value action config templates are rendered against, e.g.
+// {{.Data.email}}, {{.ID}} or {{.Form.Name}}
+type ActionTemplateData struct {
+	ID          string
+	FormID      string
+	Data        map[string]interface{}
+	Form        config.FormConfig
+	SubmittedAt time.Time
+	PublicURL   string // server.public_url, for links back to this server
+}
+
+// actionTemplateFuncs is the helper set available to action config templates
+var actionTemplateFuncs = template.FuncMap{
+	"lower": func(value interface{}) string {
+		return strings.ToLower(templateString(value))
+	},
+	"upper": func(value interface{}) string {
+		return strings.ToUpper(templateString(value))
+	},
+	// default returns fallback when value is empty: {{.Data.name | default "there"}}
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || templateString(value) == "" {
+			return fallback
+		}
+		return value
+	},
+	// truncate shortens value to n characters: {{.Data.message | truncate 80}}
+	"truncate": func(n int, value interface{}) string {
+		return truncateText(templateString(value), n)
+	},
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	},
+}
+
+// actionTemplates caches parsed config templates keyed by their source text
+type actionTemplates struct {
+	mu    sync.Mutex
+	cache map[string]*template.Template
+}
+
+func newActionTemplates() *actionTemplates {
+	return &actionTemplates{cache: make(map[string]*template.Template)}
+}
+
+func (at *actionTemplates) get(text string) (*template.Template, error) {
+	at.mu.Lock()
+	defer at.mu.Unlock()
+
+	if tmpl, exists := at.cache[text]; exists {
+		return tmpl, nil
+	}
+
+	tmpl, err := parseActionTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	at.cache[text] = tmpl
+	return tmpl, nil
+}
+
+func parseActionTemplate(text string) (*template.Template, error) {
+	return template.New("action").Funcs(actionTemplateFuncs).Parse(text)
+}
+
+// render returns a copy of an action's config with every string value rendered as a template
+// against the submission. Values without template actions are passed through untouched.
+func (at *actionTemplates) render(submission *models.FormSubmission, formConfig config.FormConfig, publicURL string, values map[string]interface{}) (map[string]interface{}, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	rendered, err := at.renderValue(values, newActionTemplateData(submission, formConfig, publicURL), "")
+	if err != nil {
+		return nil, err
+	}
+	return rendered.(map[string]interface{}), nil
+}
+
+func newActionTemplateData(submission *models.FormSubmission, formConfig config.FormConfig, publicURL string) ActionTemplateData {
+	data := ActionTemplateData{
+		ID:          submission.ID,
+		FormID:      submission.FormID,
+		Data:        make(map[string]interface{}, len(submission.Data)),
+		Form:        formConfig,
+		SubmittedAt: submission.SubmittedAt,
+		PublicURL:   publicURL,
+	}
+	// Declared fields that weren't submitted render as empty strings rather than "<no value>"
+	for _, field := range formConfig.Fields {
+		data.Data[field.Name] = ""
+	}
+	for key, value := range submission.Data {
+		data.Data[key] = value
+	}
+	return data
+}
+
+// execute renders a single template text against data
+func (at *actionTemplates) execute(text string, data interface{}) (string, error) {
+	tmpl, err := at.get(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func (at *actionTemplates) renderValue(value interface{}, data ActionTemplateData, path string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		rendered, err := at.execute(v, data)
+		if err != nil {
+			return nil, fmt.Errorf("config '%s': %w", path, err)
+		}
+		return rendered, nil
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			r, err := at.renderValue(item, data, joinConfigPath(path, key))
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+	case map[interface{}]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			name := fmt.Sprintf("%v", key)
+			r, err := at.renderValue(item, data, joinConfigPath(path, name))
+			if err != nil {
+				return nil, err
+			}
+			rendered[name] = r
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := at.renderValue(item, data, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+	}
+	return value, nil
+}
+
+// compileActionTemplates parses every templated config value of every form so syntax errors
+// are caught at startup
+func compileActionTemplates(forms map[string]config.FormConfig) error {
+	var check func(value interface{}, path string) error
+	check = func(value interface{}, path string) error {
+		switch v := value.(type) {
+		case string:
+			if strings.Contains(v, "{{") {
+				if _, err := parseActionTemplate(v); err != nil {
+					return fmt.Errorf("config '%s': %w", path, err)
+				}
+			}
+		case map[string]interface{}:
+			for key, item := range v {
+				if err := check(item, joinConfigPath(path, key)); err != nil {
+					return err
+				}
+			}
+		case map[interface{}]interface{}:
+			for key, item := range v {
+				if err := check(item, joinConfigPath(path, fmt.Sprintf("%v", key))); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			for i, item := range v {
+				if err := check(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	for formID, form := range forms {
+		for _, stage := range actionStages {
+			for index, action := range stageActions(form, stage) {
+				if err := check(action.Config, ""); err != nil {
+					return fmt.Errorf("form '%s' %s (%s): %w", formID, actionLabel(stage, index), action.Type, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func templateString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if str, ok := value.(string); ok {
+		return str
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// truncateText shortens str to n characters, ending it with "..." when there is room
+func truncateText(str string, n int) string {
+	if n < 0 || utf8.RuneCountInString(str) <= n {
+		return str
+	}
+	runes := []rune(str)
+	if n <= 3 {
+		return string(runes[:n])
+	}
+	return string(runes[:n-3]) + "..."
+}
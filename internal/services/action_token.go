@@ -0,0 +1,197 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// ActionTokenWelcomeEmail is the purpose of tokens carried by the ntfy "send welcome email" button
+const ActionTokenWelcomeEmail = "welcome"
+
+// ErrInvalidActionToken is returned when an action token is malformed, forged, expired, already
+// used or issued for a different submission or email
+var ErrInvalidActionToken = errors.New("invalid action token")
+
+// NewActionToken returns a signed token allowing one use of an unauthenticated action, such as
+// an ntfy button, for a single submission and email address. The token reads
+// "<purpose>.<submission id>.<email hash>.<expiry>.<nonce>.<signature>".
+func NewActionToken(secret, purpose, submissionID, email string, ttl time.Duration) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate token nonce: %w", err)
+	}
+
+	payload := strings.Join([]string{
+		purpose,
+		submissionID,
+		actionTokenEmailHash(email),
+		strconv.FormatInt(time.Now().Add(ttl).UTC().Unix(), 10),
+		hex.EncodeToString(nonce),
+	}, ".")
+	return payload + "." + signPayload(secret, []byte(payload)), nil
+}
+
+// actionTokenClaims is the verified content of an action token
+type actionTokenClaims struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+func parseActionToken(secret, token, purpose, submissionID, email string) (*actionTokenClaims, error) {
+	index := strings.LastIndex(token, ".")
+	if index < 0 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidActionToken)
+	}
+
+	payload, signature := token[:index], token[index+1:]
+	if !verifySignature(secret, []byte(payload), signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidActionToken)
+	}
+
+	parts := strings.Split(payload, ".")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidActionToken)
+	}
+	if parts[0] != purpose {
+		return nil, fmt.Errorf("%w: token is for a different action", ErrInvalidActionToken)
+	}
+	if parts[1] != submissionID {
+		return nil, fmt.Errorf("%w: token is for a different submission", ErrInvalidActionToken)
+	}
+	if parts[2] != actionTokenEmailHash(email) {
+		return nil, fmt.Errorf("%w: token is for a different email address", ErrInvalidActionToken)
+	}
+
+	seconds, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidActionToken)
+	}
+	expiresAt := time.Unix(seconds, 0).UTC()
+	if time.Now().After(expiresAt) {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidActionToken)
+	}
+
+	return &actionTokenClaims{nonce: parts[4], expiresAt: expiresAt}, nil
+}
+
+// actionTokenEmailHash binds a token to an address without putting the address in the token
+func actionTokenEmailHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (fs *FormService) createActionTokensTable() error {
+	var createTableSQL string
+
+	switch fs.config.Database.Type {
+	case "sqlite":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS used_action_tokens (
+			nonce TEXT PRIMARY KEY,
+			submission_id TEXT NOT NULL,
+			purpose TEXT NOT NULL,
+			used_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_used_action_tokens_expires_at ON used_action_tokens(expires_at);
+		`
+	case "postgres":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS used_action_tokens (
+			nonce TEXT PRIMARY KEY,
+			submission_id TEXT NOT NULL,
+			purpose TEXT NOT NULL,
+			used_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_used_action_tokens_expires_at ON used_action_tokens(expires_at);
+		`
+	}
+
+	_, err := fs.db.Exec(createTableSQL)
+	return err
+}
+
+// RedeemActionToken checks that token was issued for this purpose, submission and email, and
+// marks it used. Each token can be redeemed once; the submission's stored email must match.
+// The returned release function un-marks the token: call it when the action the token guards
+// fails, so the same button can be pressed again once the problem is fixed.
+func (fs *FormService) RedeemActionToken(token, purpose string, submission *models.FormSubmission, email string) (release func(), err error) {
+	claims, err := parseActionToken(fs.config.Server.SecretKey, token, purpose, submission.ID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, _ := submission.Data["email"].(string)
+	if !strings.EqualFold(strings.TrimSpace(stored), strings.TrimSpace(email)) {
+		return nil, fmt.Errorf("%w: email does not match the submission", ErrInvalidActionToken)
+	}
+
+	now := time.Now().UTC()
+
+	// Used tokens only need to be remembered until they would have expired anyway
+	cleanupQuery := `DELETE FROM used_action_tokens WHERE expires_at < ?`
+	insertQuery := `
+		INSERT INTO used_action_tokens (nonce, submission_id, purpose, used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (nonce) DO NOTHING
+	`
+	if fs.config.Database.Type == "postgres" {
+		cleanupQuery = `DELETE FROM used_action_tokens WHERE expires_at < $1`
+		insertQuery = `
+			INSERT INTO used_action_tokens (nonce, submission_id, purpose, used_at, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (nonce) DO NOTHING
+		`
+	}
+
+	if _, err := fs.db.Exec(cleanupQuery, now); err != nil {
+		return nil, fmt.Errorf("failed to clean up used action tokens: %w", err)
+	}
+
+	res, err := fs.db.Exec(insertQuery, claims.nonce, submission.ID, purpose, now, claims.expiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record action token use: %w", err)
+	}
+	if inserted, _ := res.RowsAffected(); inserted == 0 {
+		return nil, fmt.Errorf("%w: token already used", ErrInvalidActionToken)
+	}
+
+	release = func() {
+		query := `DELETE FROM used_action_tokens WHERE nonce = ?`
+		if fs.config.Database.Type == "postgres" {
+			query = `DELETE FROM used_action_tokens WHERE nonce = $1`
+		}
+		if _, err := fs.db.Exec(query, claims.nonce); err != nil {
+			log.Printf("[ACTIONS] Failed to release %s token for submission %s: %v", purpose, submission.ID, err)
+		}
+	}
+	return release, nil
+}
+
+// releaseActionTokens forgets the used tokens of a submission for purpose, so the buttons that
+// carried them work again. It is called once the action they triggered has failed for good.
+func (fs *FormService) releaseActionTokens(submissionID, purpose string) {
+	query := `DELETE FROM used_action_tokens WHERE submission_id = ? AND purpose = ?`
+	if fs.config.Database.Type == "postgres" {
+		query = `DELETE FROM used_action_tokens WHERE submission_id = $1 AND purpose = $2`
+	}
+
+	res, err := fs.db.Exec(query, submissionID, purpose)
+	if err != nil {
+		log.Printf("[ACTIONS] Failed to release %s tokens for submission %s: %v", purpose, submissionID, err)
+		return
+	}
+	if released, _ := res.RowsAffected(); released > 0 {
+		log.Printf("[ACTIONS] Released %d %s token(s) for submission %s", released, purpose, submissionID)
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+const testTokenSecret = "test-secret"
+
+// newTokenTestService returns a FormService with just the used action token table, in an
+// in-memory SQLite database
+func newTokenTestService(t *testing.T) *FormService {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{}
+	cfg.Database.Type = "sqlite"
+	cfg.Server.SecretKey = testTokenSecret
+
+	fs := &FormService{config: cfg, db: db}
+	if err := fs.createActionTokensTable(); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func newTestToken(t *testing.T, secret, purpose, submissionID, email string, ttl time.Duration) string {
+	t.Helper()
+
+	token, err := NewActionToken(secret, purpose, submissionID, email, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestRedeemActionToken(t *testing.T) {
+	submission := &models.FormSubmission{ID: "sub-1", Data: map[string]interface{}{"email": "Tester@Example.com"}}
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		email   string
+		wantErr string // "" when the token should be accepted
+	}{
+		{
+			name: "valid",
+			token: func(t *testing.T) string {
+				return newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-1", "tester@example.com", time.Hour)
+			},
+			email: "tester@example.com",
+		},
+		{
+			name: "email differs only in case and spacing",
+			token: func(t *testing.T) string {
+				return newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-1", "tester@example.com", time.Hour)
+			},
+			email: " TESTER@example.com ",
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				return newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-1", "tester@example.com", -time.Minute)
+			},
+			email:   "tester@example.com",
+			wantErr: "token expired",
+		},
+		{
+			name: "tampered signature",
+			token: func(t *testing.T) string {
+				token := newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-1", "tester@example.com", time.Hour)
+				last := "0"
+				if strings.HasSuffix(token, "0") {
+					last = "1"
+				}
+				return token[:len(token)-1] + last
+			},
+			email:   "tester@example.com",
+			wantErr: "bad signature",
+		},
+		{
+			name: "tampered expiry",
+			token: func(t *testing.T) string {
+				token := newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-1", "tester@example.com", -time.Minute)
+				parts := strings.Split(token, ".")
+				parts[3] = "9999999999"
+				return strings.Join(parts, ".")
+			},
+			email:   "tester@example.com",
+			wantErr: "bad signature",
+		},
+		{
+			name: "signed with another secret",
+			token: func(t *testing.T) string {
+				return newTestToken(t, "other-secret", ActionTokenWelcomeEmail, "sub-1", "tester@example.com", time.Hour)
+			},
+			email:   "tester@example.com",
+			wantErr: "bad signature",
+		},
+		{
+			name: "issued for another submission",
+			token: func(t *testing.T) string {
+				return newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-2", "tester@example.com", time.Hour)
+			},
+			email:   "tester@example.com",
+			wantErr: "different submission",
+		},
+		{
+			name: "issued for another email",
+			token: func(t *testing.T) string {
+				return newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-1", "someone@example.com", time.Hour)
+			},
+			email:   "tester@example.com",
+			wantErr: "different email address",
+		},
+		{
+			name: "issued for another action",
+			token: func(t *testing.T) string {
+				return newTestToken(t, testTokenSecret, "approve", "sub-1", "tester@example.com", time.Hour)
+			},
+			email:   "tester@example.com",
+			wantErr: "different action",
+		},
+		{
+			name: "email not on the submission",
+			token: func(t *testing.T) string {
+				return newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-1", "someone@example.com", time.Hour)
+			},
+			email:   "someone@example.com",
+			wantErr: "email does not match the submission",
+		},
+		{
+			name:    "malformed",
+			token:   func(t *testing.T) string { return "not-a-token" },
+			email:   "tester@example.com",
+			wantErr: "malformed token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newTokenTestService(t)
+
+			release, err := fs.RedeemActionToken(tt.token(t), ActionTokenWelcomeEmail, submission, tt.email)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("RedeemActionToken failed: %v", err)
+				}
+				if release == nil {
+					t.Fatal("RedeemActionToken returned no release function")
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidActionToken) {
+				t.Fatalf("RedeemActionToken error = %v, want ErrInvalidActionToken", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("RedeemActionToken error = %q, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedeemActionTokenReplay(t *testing.T) {
+	fs := newTokenTestService(t)
+	submission := &models.FormSubmission{ID: "sub-1", Data: map[string]interface{}{"email": "tester@example.com"}}
+	token := newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-1", "tester@example.com", time.Hour)
+
+	redeem := func() (func(), error) {
+		return fs.RedeemActionToken(token, ActionTokenWelcomeEmail, submission, "tester@example.com")
+	}
+
+	release, err := redeem()
+	if err != nil {
+		t.Fatalf("first use failed: %v", err)
+	}
+	if _, err := redeem(); !errors.Is(err, ErrInvalidActionToken) || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("second use error = %v, want the token to be already used", err)
+	}
+
+	// Releasing the token after the guarded action failed lets the button be pressed again,
+	// once
+	release()
+	if _, err := redeem(); err != nil {
+		t.Fatalf("use after release failed: %v", err)
+	}
+	if _, err := redeem(); !errors.Is(err, ErrInvalidActionToken) {
+		t.Fatalf("use after the released token was redeemed again: error = %v, want ErrInvalidActionToken", err)
+	}
+}
+
+func TestReleaseActionTokens(t *testing.T) {
+	fs := newTokenTestService(t)
+	submission := &models.FormSubmission{ID: "sub-1", Data: map[string]interface{}{"email": "tester@example.com"}}
+	token := newTestToken(t, testTokenSecret, ActionTokenWelcomeEmail, "sub-1", "tester@example.com", time.Hour)
+
+	if _, err := fs.RedeemActionToken(token, ActionTokenWelcomeEmail, submission, "tester@example.com"); err != nil {
+		t.Fatalf("first use failed: %v", err)
+	}
+
+	// Another submission's failure leaves the token used
+	fs.releaseActionTokens("sub-2", ActionTokenWelcomeEmail)
+	if _, err := fs.RedeemActionToken(token, ActionTokenWelcomeEmail, submission, "tester@example.com"); !errors.Is(err, ErrInvalidActionToken) {
+		t.Fatalf("use after releasing another submission's tokens: error = %v, want ErrInvalidActionToken", err)
+	}
+
+	// The welcome email failed for good, so the button works again
+	fs.releaseActionTokens("sub-1", ActionTokenWelcomeEmail)
+	if _, err := fs.RedeemActionToken(token, ActionTokenWelcomeEmail, submission, "tester@example.com"); err != nil {
+		t.Fatalf("use after release failed: %v", err)
+	}
+}
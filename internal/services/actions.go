@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// Action is a form action that forms reference by name in their `actions` config. Built-in
+// actions register themselves in init; other packages can add their own with RegisterAction
+// before the server starts.
+type Action interface {
+	// Name is the value used for `type` in the form config
+	Name() string
+	// Validate checks an action's config at startup. String values may still contain
+	// unrendered {{ }} templates.
+	Validate(cfg map[string]interface{}) error
+	// Execute runs the action for a submission
+	Execute(ctx context.Context, req *ActionRequest) models.ActionResult
+}
+
+// RetryPolicy is implemented by actions whose config can override the job queue's retry
+// settings. A zero maxAttempts or baseBackoff keeps the queue's jobs.max_attempts or
+// jobs.base_backoff.
+type RetryPolicy interface {
+	RetryPolicy(cfg map[string]interface{}) (maxAttempts int, baseBackoff time.Duration)
+}
+
+// ActionRequest is everything an action needs to run against a submission
+type ActionRequest struct {
+	Submission *models.FormSubmission
+	Form       config.FormConfig
+	// Action holds the action's config with templates already rendered
+	Action    config.ActionConfig
+	AppConfig *config.Config
+	// JobID identifies the queued job running the action. It stays the same across retries and is
+	// empty when the action runs outside the job queue.
+	JobID string
+	// Attempt is the 1-based attempt number of the run
+	Attempt int
+
+	// actions gives built-in actions access to shared services such as Google Play
+	actions *ActionService
+}
+
+var (
+	actionRegistryMu sync.RWMutex
+	actionRegistry   = make(map[string]Action)
+)
+
+// RegisterAction makes an action available to form configs. It panics if the name is empty or
+// already registered, as that is a programming error.
+func RegisterAction(action Action) {
+	actionRegistryMu.Lock()
+	defer actionRegistryMu.Unlock()
+
+	name := action.Name()
+	if name == "" {
+		panic("services: RegisterAction called with an empty action name")
+	}
+	if _, exists := actionRegistry[name]; exists {
+		panic(fmt.Sprintf("services: action '%s' registered twice", name))
+	}
+	actionRegistry[name] = action
+}
+
+// LookupAction returns the registered action with the given name
+func LookupAction(name string) (Action, bool) {
+	actionRegistryMu.RLock()
+	defer actionRegistryMu.RUnlock()
+
+	action, exists := actionRegistry[name]
+	return action, exists
+}
+
+// RegisteredActions returns the names of all registered actions, sorted
+func RegisteredActions() []string {
+	actionRegistryMu.RLock()
+	defer actionRegistryMu.RUnlock()
+
+	names := make([]string, 0, len(actionRegistry))
+	for name := range actionRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateActions checks that every configured action exists and accepts its config
+func validateActions(forms map[string]config.FormConfig) error {
+	for formID, form := range forms {
+		for _, stage := range actionStages {
+			for index, actionConfig := range stageActions(form, stage) {
+				action, exists := LookupAction(actionConfig.Type)
+				if !exists {
+					return fmt.Errorf("form '%s' %s: unknown action type '%s' (available: %s)",
+						formID, actionLabel(stage, index), actionConfig.Type, strings.Join(RegisteredActions(), ", "))
+				}
+				if err := action.Validate(actionConfig.Config); err != nil {
+					return fmt.Errorf("form '%s' %s (%s): %w", formID, actionLabel(stage, index), actionConfig.Type, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isTemplated reports whether a config value will only be known once rendered
+func isTemplated(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+// validateConfigStrings checks that the given keys, when present, hold strings
+func validateConfigStrings(cfg map[string]interface{}, keys ...string) error {
+	for _, key := range keys {
+		if value, exists := cfg[key]; exists {
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("'%s' must be a string", key)
+			}
+		}
+	}
+	return nil
+}
+
+// actionRetryPolicy returns the retry settings of an action config, or zero values when the
+// action doesn't override the job queue's
+func actionRetryPolicy(actionConfig config.ActionConfig) (int, time.Duration) {
+	action, exists := LookupAction(actionConfig.Type)
+	if !exists {
+		return 0, 0
+	}
+	policy, ok := action.(RetryPolicy)
+	if !ok {
+		return 0, 0
+	}
+	return policy.RetryPolicy(actionConfig.Config)
+}
+
+// validateConfigDurations checks that the given keys, when present, hold a number of seconds
+// or a duration string such as "5s"
+func validateConfigDurations(cfg map[string]interface{}, keys ...string) error {
+	for _, key := range keys {
+		switch value := cfg[key].(type) {
+		case nil, int, float64:
+		case string:
+			if _, err := time.ParseDuration(value); err != nil && !isTemplated(value) {
+				return fmt.Errorf("'%s' must be a duration such as \"5s\", got '%s'", key, value)
+			}
+		default:
+			return fmt.Errorf("'%s' must be a duration such as \"5s\"", key)
+		}
+	}
+	return nil
+}
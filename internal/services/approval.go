@@ -0,0 +1,185 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// ErrInvalidApproval is returned when a submission can't be approved or rejected in its
+// current state
+var ErrInvalidApproval = errors.New("invalid approval")
+
+// actionStages lists the stages in the order a submission goes through them
+var actionStages = []string{models.ActionStageSubmission, models.ActionStageApproval}
+
+// stageActions returns the actions a form runs at the given stage
+func stageActions(formConfig config.FormConfig, stage string) []config.ActionConfig {
+	if stage == models.ActionStageApproval {
+		return formConfig.Approval.Actions
+	}
+	return formConfig.Actions
+}
+
+// actionLabel names an action in error messages, e.g. "action 2" or "approval action 0"
+func actionLabel(stage string, index int) string {
+	if stage == models.ActionStageApproval {
+		return fmt.Sprintf("approval action %d", index)
+	}
+	return fmt.Sprintf("action %d", index)
+}
+
+// requiresApproval reports whether a new submission has to wait for an admin before its
+// approval actions run
+func (fs *FormService) requiresApproval(submission *models.FormSubmission, formConfig config.FormConfig) bool {
+	if !formConfig.Approval.Enabled {
+		return false
+	}
+	if strings.TrimSpace(formConfig.Approval.When) == "" {
+		return true
+	}
+
+	matched, err := fs.actionService.conditionMatches(formConfig.Approval.When, submission)
+	if err != nil {
+		// Holding the submission is safer than running approval actions nobody signed off on
+		log.Printf("[APPROVAL] Failed to evaluate approval condition for form %s: %v", submission.FormID, err)
+		return true
+	}
+	return matched
+}
+
+// initialStatus is the status of a submission once it has passed spam checks
+func (fs *FormService) initialStatus(submission *models.FormSubmission, formConfig config.FormConfig) string {
+	if fs.requiresApproval(submission, formConfig) {
+		return models.SubmissionStatusPending
+	}
+	return models.SubmissionStatusReceived
+}
+
+// ApproveSubmission marks a pending or rejected submission approved and queues the form's
+// approval actions. They run one after another and stop at the first action that fails.
+// Approving an already approved submission retries the failed action and carries on from there
+// without running the ones that succeeded again. Once they all succeed the submission becomes
+// invited.
+func (fs *FormService) ApproveSubmission(submission *models.FormSubmission) error {
+	formConfig, exists := fs.GetFormConfig(submission.FormID)
+	if !exists {
+		return fmt.Errorf("form '%s' not found", submission.FormID)
+	}
+	if !formConfig.Approval.Enabled {
+		return fmt.Errorf("%w: form '%s' does not use approval", ErrInvalidApproval, submission.FormID)
+	}
+
+	if submission.Status == models.SubmissionStatusApproved {
+		return fs.retryApproval(submission, formConfig)
+	}
+
+	status := models.SubmissionStatusApproved
+	if len(formConfig.Approval.Actions) == 0 {
+		status = models.SubmissionStatusInvited
+	}
+	approved, err := fs.transitionSubmission(submission.ID, status, models.SubmissionStatusPending, models.SubmissionStatusRejected)
+	if err != nil {
+		return fmt.Errorf("failed to update submission: %w", err)
+	}
+	if !approved {
+		return fs.approvalConflict(submission, "only pending or rejected submissions can be approved")
+	}
+	submission.Status = status
+	log.Printf("[APPROVAL] Submission %s for form %s approved", submission.ID, submission.FormID)
+
+	if len(formConfig.Approval.Actions) == 0 {
+		return nil
+	}
+	if err := fs.jobs.Enqueue(submission, formConfig, models.ActionStageApproval); err != nil {
+		return fmt.Errorf("failed to queue approval actions: %w", err)
+	}
+	return nil
+}
+
+// retryApproval queues the failed approval action of an approved submission again
+func (fs *FormService) retryApproval(submission *models.FormSubmission, formConfig config.FormConfig) error {
+	retried, err := fs.jobs.retryDeadJobs(submission.ID, models.ActionStageApproval)
+	if err != nil {
+		return fmt.Errorf("failed to retry approval actions: %w", err)
+	}
+	if retried > 0 {
+		log.Printf("[APPROVAL] Retrying %d failed approval action(s) for submission %s", retried, submission.ID)
+		return nil
+	}
+
+	jobs, err := fs.jobs.countStageJobs(submission.ID, models.ActionStageApproval)
+	if err != nil {
+		return fmt.Errorf("failed to check approval jobs: %w", err)
+	}
+	if jobs > 0 {
+		return fmt.Errorf("%w: approval actions are still running", ErrInvalidApproval)
+	}
+
+	// The submission was approved but queueing its actions failed
+	if err := fs.jobs.Enqueue(submission, formConfig, models.ActionStageApproval); err != nil {
+		return fmt.Errorf("failed to queue approval actions: %w", err)
+	}
+	return nil
+}
+
+// approvalConflict explains why a submission could not change status, using its current status
+// since the caller's copy may be stale
+func (fs *FormService) approvalConflict(submission *models.FormSubmission, reason string) error {
+	current, err := fs.GetSubmission(submission.ID)
+	if err != nil {
+		return fmt.Errorf("failed to reload submission: %w", err)
+	}
+	submission.Status = current.Status
+	return fmt.Errorf("%w: %s, submission is %s", ErrInvalidApproval, reason, current.Status)
+}
+
+// RejectSubmission marks a pending submission rejected. No approval actions run.
+func (fs *FormService) RejectSubmission(submission *models.FormSubmission) error {
+	rejected, err := fs.transitionSubmission(submission.ID, models.SubmissionStatusRejected, models.SubmissionStatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to update submission: %w", err)
+	}
+	if !rejected {
+		return fs.approvalConflict(submission, "only pending submissions can be rejected")
+	}
+	submission.Status = models.SubmissionStatusRejected
+	log.Printf("[APPROVAL] Submission %s for form %s rejected", submission.ID, submission.FormID)
+	return nil
+}
+
+// MarkSubmissionInvited records that a welcome email was queued outside the approval workflow.
+// Only received submissions move on, so a status set in the meantime is never overwritten.
+func (fs *FormService) MarkSubmissionInvited(submission *models.FormSubmission) error {
+	invited, err := fs.transitionSubmission(submission.ID, models.SubmissionStatusInvited, models.SubmissionStatusReceived, models.SubmissionStatusInvited)
+	if err != nil {
+		return fmt.Errorf("failed to update submission: %w", err)
+	}
+	if !invited {
+		return fs.approvalConflict(submission, "only received submissions can be marked invited")
+	}
+	submission.Status = models.SubmissionStatusInvited
+	return nil
+}
+
+// welcomeEmailFinished undoes MarkSubmissionInvited when the welcome email it was sent with
+// failed for good: the submission is received again and the button's token works again
+func (fs *FormService) welcomeEmailFinished(delivery *models.EmailDelivery) {
+	if delivery.JobID != "" || delivery.Template != welcomeEmailTemplate || delivery.SubmissionID == "" {
+		return
+	}
+	if delivery.Status != models.EmailStatusFailed {
+		return
+	}
+
+	fs.releaseActionTokens(delivery.SubmissionID, ActionTokenWelcomeEmail)
+	if _, err := fs.transitionSubmission(delivery.SubmissionID, models.SubmissionStatusReceived, models.SubmissionStatusInvited); err != nil {
+		log.Printf("[APPROVAL] Failed to reset submission %s after its welcome email failed: %v", delivery.SubmissionID, err)
+		return
+	}
+	log.Printf("[APPROVAL] Welcome email for submission %s failed, the submission is received again", delivery.SubmissionID)
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+)
+
+// ErrCaptchaRequired is returned when a form requires a captcha and no token was supplied
+var ErrCaptchaRequired = errors.New("captcha token required")
+
+// ErrCaptchaUnavailable is returned when the token couldn't be checked, e.g. because the
+// provider is down or rejected our secret, rather than because the token is bad
+var ErrCaptchaUnavailable = errors.New("captcha verification unavailable")
+
+// CaptchaVerifier checks a captcha token submitted alongside a form
+type CaptchaVerifier interface {
+	// Name returns the provider name exposed to clients (e.g. "hcaptcha")
+	Name() string
+	// Verify returns nil when the token is valid for the given client IP
+	Verify(ctx context.Context, token, remoteIP string) error
+}
+
+// NewCaptchaVerifier builds the verifier selected by the captcha config. It returns nil when no
+// provider is configured.
+func NewCaptchaVerifier(cfg *config.Config) (CaptchaVerifier, error) {
+	captcha := cfg.Captcha
+
+	var verifier CaptchaVerifier
+	var err error
+
+	switch captcha.Provider {
+	case "":
+		return nil, nil
+	case "hcaptcha":
+		verifier, err = NewHCaptchaVerifier(captcha.SecretKey, captcha.VerifyURL)
+	case "turnstile":
+		verifier, err = NewTurnstileVerifier(captcha.SecretKey, captcha.VerifyURL)
+	case "recaptcha":
+		verifier, err = NewRecaptchaVerifier(captcha.SecretKey, captcha.VerifyURL, captcha.MinScore)
+	case "pow":
+		ttl, parseErr := time.ParseDuration(captcha.PowTTL)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid captcha pow_ttl '%s': %w", captcha.PowTTL, parseErr)
+		}
+		verifier, err = NewProofOfWorkVerifier(cfg.Server.SecretKey, captcha.PowDifficulty, ttl)
+	default:
+		return nil, fmt.Errorf("unsupported captcha provider: %s", captcha.Provider)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return verifier, nil
+}
+
+// siteVerifier implements the "siteverify" protocol shared by hCaptcha, Turnstile and reCAPTCHA:
+// a form POST of secret/response/remoteip answered with {"success": bool, "error-codes": [...]}.
+type siteVerifier struct {
+	name      string
+	verifyURL string
+	secret    string
+	minScore  float64
+	client    *http.Client
+}
+
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+	Score      *float64 `json:"score,omitempty"`
+}
+
+func newSiteVerifier(name, secret, verifyURL, defaultURL string, minScore float64) (CaptchaVerifier, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("%s secret key not configured", name)
+	}
+	if verifyURL == "" {
+		verifyURL = defaultURL
+	}
+	return &siteVerifier{
+		name:      name,
+		verifyURL: verifyURL,
+		secret:    secret,
+		minScore:  minScore,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// NewHCaptchaVerifier returns a verifier for hCaptcha tokens
+func NewHCaptchaVerifier(secret, verifyURL string) (CaptchaVerifier, error) {
+	return newSiteVerifier("hcaptcha", secret, verifyURL, "https://api.hcaptcha.com/siteverify", 0)
+}
+
+// NewTurnstileVerifier returns a verifier for Cloudflare Turnstile tokens
+func NewTurnstileVerifier(secret, verifyURL string) (CaptchaVerifier, error) {
+	return newSiteVerifier("turnstile", secret, verifyURL, "https://challenges.cloudflare.com/turnstile/v0/siteverify", 0)
+}
+
+// NewRecaptchaVerifier returns a verifier for Google reCAPTCHA tokens. minScore only applies to
+// v3 tokens, which carry a score.
+func NewRecaptchaVerifier(secret, verifyURL string, minScore float64) (CaptchaVerifier, error) {
+	return newSiteVerifier("recaptcha", secret, verifyURL, "https://www.google.com/recaptcha/api/siteverify", minScore)
+}
+
+func (sv *siteVerifier) Name() string {
+	return sv.name
+}
+
+// siteVerifierConfigErrors are the error codes hCaptcha, Turnstile and reCAPTCHA return for a
+// missing or wrong secret key
+var siteVerifierConfigErrors = map[string]bool{
+	"missing-input-secret":    true,
+	"invalid-input-secret":    true,
+	"sitekey-secret-mismatch": true,
+}
+
+func (sv *siteVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrCaptchaRequired
+	}
+
+	form := url.Values{}
+	form.Set("secret", sv.secret)
+	form.Set("response", token)
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", sv.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%w: failed to create %s verify request: %v", ErrCaptchaUnavailable, sv.name, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := sv.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to reach %s: %v", ErrCaptchaUnavailable, sv.name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s verify endpoint returned status %d", ErrCaptchaUnavailable, sv.name, resp.StatusCode)
+	}
+
+	var result siteVerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("%w: failed to decode %s response: %v", ErrCaptchaUnavailable, sv.name, err)
+	}
+
+	if !result.Success {
+		for _, code := range result.ErrorCodes {
+			// The provider refused our configuration, not the visitor's token
+			if siteVerifierConfigErrors[code] {
+				return fmt.Errorf("%w: %s rejected the secret key: %s", ErrCaptchaUnavailable, sv.name, code)
+			}
+		}
+		if len(result.ErrorCodes) > 0 {
+			return fmt.Errorf("%s rejected token: %s", sv.name, strings.Join(result.ErrorCodes, ", "))
+		}
+		return fmt.Errorf("%s rejected token", sv.name)
+	}
+
+	if sv.minScore > 0 && result.Score != nil && *result.Score < sv.minScore {
+		return fmt.Errorf("%s score %.2f is below the minimum of %.2f", sv.name, *result.Score, sv.minScore)
+	}
+
+	return nil
+}
+
+// PowChallenge is handed to clients that need to solve a proof-of-work captcha
+type PowChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ProofOfWorkVerifier is a self-hosted captcha. Clients fetch a signed challenge and must find a
+// nonce such that SHA-256("<challenge>:<nonce>") starts with Difficulty zero bits. The token they
+// submit is "<challenge>:<nonce>". Each challenge can only be redeemed once.
+type ProofOfWorkVerifier struct {
+	secret     string
+	difficulty int
+	ttl        time.Duration
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+// NewProofOfWorkVerifier returns a proof-of-work verifier signing challenges with secret
+func NewProofOfWorkVerifier(secret string, difficulty int, ttl time.Duration) (*ProofOfWorkVerifier, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("proof-of-work captcha requires server.secret_key")
+	}
+	if difficulty < 1 || difficulty > 32 {
+		return nil, fmt.Errorf("proof-of-work difficulty must be between 1 and 32, got %d", difficulty)
+	}
+	return &ProofOfWorkVerifier{
+		secret:     secret,
+		difficulty: difficulty,
+		ttl:        ttl,
+		used:       make(map[string]time.Time),
+	}, nil
+}
+
+func (pv *ProofOfWorkVerifier) Name() string {
+	return "pow"
+}
+
+// NewChallenge issues a fresh signed challenge
+func (pv *ProofOfWorkVerifier) NewChallenge() (*PowChallenge, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	expiresAt := time.Now().UTC().Add(pv.ttl)
+	payload := fmt.Sprintf("%s.%d.%d", hex.EncodeToString(nonce), expiresAt.Unix(), pv.difficulty)
+
+	return &PowChallenge{
+		Challenge:  payload + "." + signPayload(pv.secret, []byte(payload)),
+		Difficulty: pv.difficulty,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+func (pv *ProofOfWorkVerifier) Verify(ctx context.Context, token, remoteIP string) error {
+	if token == "" {
+		return ErrCaptchaRequired
+	}
+
+	challenge, solution, found := strings.Cut(token, ":")
+	if !found || solution == "" {
+		return fmt.Errorf("malformed proof-of-work token")
+	}
+
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 {
+		return fmt.Errorf("malformed proof-of-work challenge")
+	}
+
+	payload := strings.Join(parts[:3], ".")
+	if !verifySignature(pv.secret, []byte(payload), parts[3]) {
+		return fmt.Errorf("invalid proof-of-work challenge signature")
+	}
+
+	expiresUnix, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("malformed proof-of-work challenge")
+	}
+	expiresAt := time.Unix(expiresUnix, 0)
+	if time.Now().After(expiresAt) {
+		return fmt.Errorf("proof-of-work challenge expired")
+	}
+
+	difficulty, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return fmt.Errorf("malformed proof-of-work challenge")
+	}
+
+	sum := sha256.Sum256([]byte(token))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return fmt.Errorf("proof-of-work solution does not meet difficulty %d", difficulty)
+	}
+
+	pv.mu.Lock()
+	defer pv.mu.Unlock()
+
+	now := time.Now()
+	for key, expiry := range pv.used {
+		if now.After(expiry) {
+			delete(pv.used, key)
+		}
+	}
+	if _, redeemed := pv.used[challenge]; redeemed {
+		return fmt.Errorf("proof-of-work challenge already used")
+	}
+	pv.used[challenge] = expiresAt
+
+	return nil
+}
+
+// verifySignature checks a hex signature produced by signPayload in constant time
+func verifySignature(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(signPayload(secret, payload)))
+}
+
+func leadingZeroBits(data []byte) int {
+	count := 0
+	for _, b := range data {
+		if b == 0 {
+			count += 8
+			continue
+		}
+		return count + bits.LeadingZeros8(b)
+	}
+	return count
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSiteVerifier(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		minScore    float64
+		token       string
+		wantErr     string // "" when the token should be accepted
+		unavailable bool   // Whether the error should be ErrCaptchaUnavailable
+	}{
+		{name: "valid", status: http.StatusOK, body: `{"success": true}`, token: "tok"},
+		{name: "missing token", token: "", wantErr: "captcha token required"},
+		{name: "rejected", status: http.StatusOK, body: `{"success": false, "error-codes": ["invalid-input-response"]}`, token: "tok", wantErr: "rejected token: invalid-input-response"},
+		{name: "rejected without codes", status: http.StatusOK, body: `{"success": false}`, token: "tok", wantErr: "rejected token"},
+		{name: "wrong secret", status: http.StatusOK, body: `{"success": false, "error-codes": ["invalid-input-secret"]}`, token: "tok", wantErr: "rejected the secret key", unavailable: true},
+		{name: "provider error", status: http.StatusInternalServerError, body: "", token: "tok", wantErr: "returned status 500", unavailable: true},
+		{name: "garbled response", status: http.StatusOK, body: "<html>", token: "tok", wantErr: "failed to decode", unavailable: true},
+		{name: "score above minimum", status: http.StatusOK, body: `{"success": true, "score": 0.9}`, minScore: 0.5, token: "tok"},
+		{name: "score below minimum", status: http.StatusOK, body: `{"success": true, "score": 0.2}`, minScore: 0.5, token: "tok", wantErr: "score 0.20 is below the minimum of 0.50"},
+		{name: "v2 token without score", status: http.StatusOK, body: `{"success": true}`, minScore: 0.5, token: "tok"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var form url.Values
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				r.ParseForm()
+				form = r.PostForm
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+
+			verifier, err := NewRecaptchaVerifier("captcha-secret", server.URL, tt.minScore)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = verifier.Verify(context.Background(), tt.token, "192.0.2.1")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify failed: %v", err)
+				}
+				if form.Get("secret") != "captcha-secret" || form.Get("response") != "tok" || form.Get("remoteip") != "192.0.2.1" {
+					t.Errorf("verify request = %v, want the secret, token and client IP", form)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Verify error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if got := errors.Is(err, ErrCaptchaUnavailable); got != tt.unavailable {
+				t.Errorf("errors.Is(%v, ErrCaptchaUnavailable) = %t, want %t", err, got, tt.unavailable)
+			}
+		})
+	}
+}
+
+func TestSiteVerifierUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	verifier, err := NewHCaptchaVerifier("captcha-secret", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifier.Verify(context.Background(), "tok", ""); !errors.Is(err, ErrCaptchaUnavailable) {
+		t.Errorf("Verify error = %v, want ErrCaptchaUnavailable", err)
+	}
+}
+
+// solvePowChallenge finds a nonce for challenge the way a client would
+func solvePowChallenge(t *testing.T, challenge *PowChallenge) string {
+	t.Helper()
+
+	for nonce := 0; nonce < 1<<24; nonce++ {
+		token := challenge.Challenge + ":" + strconv.Itoa(nonce)
+		sum := sha256.Sum256([]byte(token))
+		if leadingZeroBits(sum[:]) >= challenge.Difficulty {
+			return token
+		}
+	}
+	t.Fatal("no solution found")
+	return ""
+}
+
+func TestProofOfWorkVerifier(t *testing.T) {
+	verifier, err := NewProofOfWorkVerifier("pow-secret", 8, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := NewProofOfWorkVerifier("pow-secret", 8, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewProofOfWorkVerifier("other-secret", 8, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   func(t *testing.T) string
+		wantErr string // "" when the token should be accepted
+	}{
+		{
+			name: "solved",
+			token: func(t *testing.T) string {
+				challenge, _ := verifier.NewChallenge()
+				return solvePowChallenge(t, challenge)
+			},
+		},
+		{
+			name:    "missing",
+			token:   func(t *testing.T) string { return "" },
+			wantErr: "captcha token required",
+		},
+		{
+			name: "no solution",
+			token: func(t *testing.T) string {
+				challenge, _ := verifier.NewChallenge()
+				return challenge.Challenge
+			},
+			wantErr: "malformed proof-of-work token",
+		},
+		{
+			name: "wrong solution",
+			token: func(t *testing.T) string {
+				challenge, _ := verifier.NewChallenge()
+				for nonce := 0; ; nonce++ {
+					token := challenge.Challenge + ":" + strconv.Itoa(nonce)
+					if sum := sha256.Sum256([]byte(token)); leadingZeroBits(sum[:]) < challenge.Difficulty {
+						return token
+					}
+				}
+			},
+			wantErr: "does not meet difficulty 8",
+		},
+		{
+			name: "lowered difficulty",
+			token: func(t *testing.T) string {
+				challenge, _ := verifier.NewChallenge()
+				parts := strings.Split(challenge.Challenge, ".")
+				parts[2] = "1"
+				return strings.Join(parts, ".") + ":0"
+			},
+			wantErr: "invalid proof-of-work challenge signature",
+		},
+		{
+			name: "signed with another secret",
+			token: func(t *testing.T) string {
+				challenge, _ := other.NewChallenge()
+				return solvePowChallenge(t, challenge)
+			},
+			wantErr: "invalid proof-of-work challenge signature",
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T) string {
+				challenge, _ := expired.NewChallenge()
+				return solvePowChallenge(t, challenge)
+			},
+			wantErr: "proof-of-work challenge expired",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifier.Verify(context.Background(), tt.token(t), "")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProofOfWorkVerifierReplay(t *testing.T) {
+	verifier, err := NewProofOfWorkVerifier("pow-secret", 8, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := verifier.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := solvePowChallenge(t, challenge)
+
+	if err := verifier.Verify(context.Background(), token, ""); err != nil {
+		t.Fatalf("first use failed: %v", err)
+	}
+	if err := verifier.Verify(context.Background(), token, ""); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Errorf("second use error = %v, want the challenge to be already used", err)
+	}
+}
+
+func TestNewProofOfWorkVerifierDifficulty(t *testing.T) {
+	for _, difficulty := range []int{0, 33} {
+		if _, err := NewProofOfWorkVerifier("pow-secret", difficulty, time.Minute); err == nil {
+			t.Errorf("NewProofOfWorkVerifier accepted difficulty %d", difficulty)
+		}
+	}
+	if _, err := NewProofOfWorkVerifier("", 8, time.Minute); err == nil {
+		t.Error("NewProofOfWorkVerifier accepted an empty secret")
+	}
+}
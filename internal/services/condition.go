@@ -0,0 +1,411 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+)
+
+// Condition is a compiled action `when` expression. Expressions compare submission fields
+// with literals, for example:
+//
+//	platform == "ios"
+//	wantsNews == true && newsEmail != ""
+//	!(platform == "android" || platform == "ios")
+//
+// Bare field names are truthy when they hold true, a non-zero number or a non-empty string.
+// Supported operators are ==, !=, <, <=, >, >=, &&, || and !, with parentheses for grouping.
+type Condition struct {
+	source string
+	root   conditionNode
+}
+
+// CompileCondition parses a `when` expression
+func CompileCondition(expr string) (*Condition, error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &conditionParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.peek().text, p.peek().pos)
+	}
+
+	return &Condition{source: expr, root: root}, nil
+}
+
+// Evaluate reports whether the condition holds for the given submission data
+func (c *Condition) Evaluate(data map[string]interface{}) bool {
+	return truthy(c.root.eval(data))
+}
+
+func (c *Condition) String() string {
+	return c.source
+}
+
+// compileConditions checks every action and approval condition of every form so bad
+// expressions are caught at startup
+func compileConditions(forms map[string]config.FormConfig) error {
+	for formID, form := range forms {
+		if strings.TrimSpace(form.Approval.When) != "" {
+			if _, err := CompileCondition(form.Approval.When); err != nil {
+				return fmt.Errorf("form '%s': invalid approval when condition: %w", formID, err)
+			}
+		}
+		for _, stage := range actionStages {
+			for index, action := range stageActions(form, stage) {
+				if strings.TrimSpace(action.When) == "" {
+					continue
+				}
+				if _, err := CompileCondition(action.When); err != nil {
+					return fmt.Errorf("form '%s' %s (%s): invalid when condition: %w", formID, actionLabel(stage, index), action.Type, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type conditionNode interface {
+	eval(data map[string]interface{}) interface{}
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n literalNode) eval(map[string]interface{}) interface{} {
+	return n.value
+}
+
+type fieldNode struct {
+	name string
+}
+
+func (n fieldNode) eval(data map[string]interface{}) interface{} {
+	return data[n.name]
+}
+
+type notNode struct {
+	operand conditionNode
+}
+
+func (n notNode) eval(data map[string]interface{}) interface{} {
+	return !truthy(n.operand.eval(data))
+}
+
+type logicalNode struct {
+	op          string
+	left, right conditionNode
+}
+
+func (n logicalNode) eval(data map[string]interface{}) interface{} {
+	left := truthy(n.left.eval(data))
+	if n.op == "&&" {
+		return left && truthy(n.right.eval(data))
+	}
+	return left || truthy(n.right.eval(data))
+}
+
+type compareNode struct {
+	op          string
+	left, right conditionNode
+}
+
+func (n compareNode) eval(data map[string]interface{}) interface{} {
+	left, right := n.left.eval(data), n.right.eval(data)
+
+	switch n.op {
+	case "==":
+		return valuesEqual(left, right)
+	case "!=":
+		return !valuesEqual(left, right)
+	}
+
+	// Ordering comparisons only make sense for numbers
+	l, lok := parseNumber(left)
+	r, rok := parseNumber(right)
+	if !lok || !rok {
+		return false
+	}
+
+	switch n.op {
+	case "<":
+		return l < r
+	case "<=":
+		return l <= r
+	case ">":
+		return l > r
+	case ">=":
+		return l >= r
+	}
+	return false
+}
+
+// valuesEqual compares a submission value with a literal. Form values often arrive as strings,
+// so "true" equals true and "3" equals 3.
+func valuesEqual(left, right interface{}) bool {
+	if left == nil || right == nil {
+		if left == nil && right == nil {
+			return true
+		}
+		// A missing field equals the zero values "", false and 0
+		other := left
+		if other == nil {
+			other = right
+		}
+		return !truthy(other)
+	}
+
+	if lb, ok := left.(bool); ok {
+		rb, ok := parseBool(right)
+		return ok && lb == rb
+	}
+	if rb, ok := right.(bool); ok {
+		lb, ok := parseBool(left)
+		return ok && lb == rb
+	}
+
+	_, lnum := left.(float64)
+	_, rnum := right.(float64)
+	if lnum || rnum {
+		l, lok := parseNumber(left)
+		r, rok := parseNumber(right)
+		return lok && rok && l == r
+	}
+
+	return fmt.Sprintf("%v", left) == fmt.Sprintf("%v", right)
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case int:
+		return v != 0
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+		return v != ""
+	}
+	return true
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOperator
+	tokenLParen
+	tokenRParen
+)
+
+type conditionToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var conditionOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!"}
+
+func tokenizeCondition(expr string) ([]conditionToken, error) {
+	var tokens []conditionToken
+	i := 0
+
+	for i < len(expr) {
+		c := rune(expr[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, conditionToken{tokenLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, conditionToken{tokenRParen, ")", i})
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			var sb strings.Builder
+			i++
+			for i < len(expr) && rune(expr[i]) != c {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					i++
+				}
+				sb.WriteByte(expr[i])
+				i++
+			}
+			if i >= len(expr) {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			i++
+			tokens = append(tokens, conditionToken{tokenString, sb.String(), start})
+		case unicode.IsDigit(c) || (c == '-' && i+1 < len(expr) && unicode.IsDigit(rune(expr[i+1]))):
+			start := i
+			i++
+			for i < len(expr) && (unicode.IsDigit(rune(expr[i])) || expr[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, conditionToken{tokenNumber, expr[start:i], start})
+		case unicode.IsLetter(c) || c == '_':
+			start := i
+			for i < len(expr) && (unicode.IsLetter(rune(expr[i])) || unicode.IsDigit(rune(expr[i])) || expr[i] == '_' || expr[i] == '-') {
+				i++
+			}
+			tokens = append(tokens, conditionToken{tokenIdent, expr[start:i], start})
+		default:
+			matched := false
+			for _, op := range conditionOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, conditionToken{tokenOperator, op, i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+			}
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty condition")
+	}
+
+	return append(tokens, conditionToken{tokenEOF, "end of expression", len(expr)}), nil
+}
+
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+func (p *conditionParser) peek() conditionToken {
+	return p.tokens[p.pos]
+}
+
+func (p *conditionParser) next() conditionToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *conditionParser) isOperator(ops ...string) bool {
+	tok := p.peek()
+	return tok.kind == tokenOperator && containsString(ops, tok.text)
+}
+
+func (p *conditionParser) parseOr() (conditionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (conditionNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseUnary() (conditionNode, error) {
+	if p.isOperator("!") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *conditionParser) parseComparison() (conditionNode, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.isOperator("==", "!=", "<", "<=", ">", ">=") {
+		op := p.next().text
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compareNode{op: op, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+func (p *conditionParser) parseOperand() (conditionNode, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, fmt.Errorf("expected ')' at position %d", closing.pos)
+		}
+		return node, nil
+	case tokenString:
+		return literalNode{value: tok.text}, nil
+	case tokenNumber:
+		number, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s' at position %d", tok.text, tok.pos)
+		}
+		return literalNode{value: number}, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		}
+		return fieldNode{name: tok.text}, nil
+	}
+
+	return nil, fmt.Errorf("unexpected '%s' at position %d", tok.text, tok.pos)
+}
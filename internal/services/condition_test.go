@@ -0,0 +1,91 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConditionEvaluate(t *testing.T) {
+	data := map[string]interface{}{
+		"platform":  "ios",
+		"wantsNews": "true",
+		"count":     float64(3),
+		"name":      `Jo "JJ" O'Neil`,
+		"empty":     "",
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		{"string equality", `platform == "ios"`, true},
+		{"single quoted string", `platform == 'ios'`, true},
+		{"inequality", `platform != "ios"`, false},
+		{"escaped double quotes", `name == "Jo \"JJ\" O'Neil"`, true},
+		{"escaped single quote", `name == 'Jo "JJ" O\'Neil'`, true},
+		{"string compared with bool", `wantsNews == true`, true},
+		{"bare field is truthy", `wantsNews`, true},
+		{"empty string is falsy", `empty`, false},
+		{"missing field is falsy", `missing`, false},
+		{"missing field equals zero values", `missing == "" && missing == false && missing == 0 && missing == null`, true},
+		{"number comparison", `count > 2 && count <= 3`, true},
+		{"negative number", `count > -1`, true},
+		{"number compared with numeric string", `count == "3"`, true},
+		{"ordering a non-number is false", `platform > 1`, false},
+
+		// && binds tighter than ||, on either side
+		{"and before or", `platform == "android" && count == 1 || count == 3`, true},
+		{"or before and", `count == 3 || platform == "android" && count == 1`, true},
+		// ! applies to the whole comparison but binds tighter than &&
+		{"not covers comparison", `!platform == "android"`, true},
+		{"not before and", `!missing && missing`, false},
+		{"double not", `!!wantsNews`, true},
+		{"parentheses group", `(platform == "android" || count == 3) && !missing`, true},
+		{"negated group", `!(platform == "android" || platform == "ios")`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition, err := CompileCondition(tt.expr)
+			if err != nil {
+				t.Fatalf("CompileCondition(%q) failed: %v", tt.expr, err)
+			}
+			if got := condition.Evaluate(data); got != tt.want {
+				t.Errorf("%s = %t, want %t", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileConditionErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		wantErr string
+	}{
+		{"empty", ``, "empty condition"},
+		{"only spaces", `   `, "empty condition"},
+		{"missing operand", `platform ==`, "unexpected 'end of expression' at position 11"},
+		{"unclosed parenthesis", `(platform == "ios"`, "expected ')'"},
+		{"stray closing parenthesis", `platform)`, "unexpected ')' at position 8"},
+		{"unterminated string", `platform == "ios`, "unterminated string starting at position 12"},
+		{"escape at the end", `platform == "ios\`, "unterminated string"},
+		{"single equals", `platform = "ios"`, "unexpected character '=' at position 9"},
+		{"two operands", `platform ios`, "unexpected 'ios' at position 9"},
+		{"bad number", `count == 1.2.3`, "invalid number '1.2.3'"},
+		{"dangling and", `platform == "ios" &&`, "unexpected 'end of expression'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CompileCondition(tt.expr)
+			if err == nil {
+				t.Fatalf("CompileCondition(%q) succeeded, want an error", tt.expr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CompileCondition(%q) error = %q, want it to contain %q", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailAttachment is a file sent with an email
+type EmailAttachment struct {
+	Filename    string
+	ContentType string // Guessed from Filename when empty
+	Content     []byte
+}
+
+// emailMessage is everything buildEmailMessage needs to produce a message
+type emailMessage struct {
+	From            *mail.Address
+	To              *mail.Address
+	ReplyTo         *mail.Address
+	Subject         string
+	MessageID       string // e.g. "<id@example.com>"; generated when empty
+	ListUnsubscribe string // mailto: address or https URL, e.g. "mailto:unsubscribe@example.com"
+	HTML            string
+	Text            string
+	Attachments     []EmailAttachment
+}
+
+// buildEmailMessage encodes msg as a MIME message. An HTML message is sent as
+// multipart/alternative with its plain text version first, and attachments wrap the body in
+// multipart/mixed. Bodies are quoted-printable and headers are RFC 2047 encoded, so non-ASCII
+// subjects and names survive every mail server.
+func buildEmailMessage(msg emailMessage, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+
+	messageID := msg.MessageID
+	if messageID == "" {
+		messageID = emailMessageID(uuid.New().String(), msg.From.Address)
+	}
+	headers := [][2]string{
+		{"From", msg.From.String()},
+		{"To", msg.To.String()},
+		{"Subject", encodeEmailHeader(msg.Subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+	}
+	if msg.ReplyTo != nil {
+		headers = append(headers, [2]string{"Reply-To", msg.ReplyTo.String()})
+	}
+	headers = append(headers, listUnsubscribeHeaders(msg.ListUnsubscribe)...)
+	headers = append(headers, [2]string{"MIME-Version", "1.0"})
+	for _, header := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", header[0], header[1])
+	}
+
+	bodyHeader, body, err := emailBody(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msg.Attachments) == 0 {
+		for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			if value := bodyHeader.Get(key); value != "" {
+				fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+			}
+		}
+		buf.WriteString("\r\n")
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+
+	mixed := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+
+	part, err := mixed.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(body); err != nil {
+		return nil, err
+	}
+	for _, attachment := range msg.Attachments {
+		if err := writeEmailAttachment(mixed, attachment); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// emailBody encodes the text and HTML versions, returning the headers that describe them
+func emailBody(msg emailMessage) (textproto.MIMEHeader, []byte, error) {
+	var buf bytes.Buffer
+	if msg.HTML == "" {
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, nil, err
+		}
+		return textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, buf.Bytes(), nil
+	}
+
+	alternative := multipart.NewWriter(&buf)
+
+	// Clients show the last version they support, so the plain text version goes first
+	for _, version := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", msg.Text},
+		{"text/html; charset=UTF-8", msg.HTML},
+	} {
+		part, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {version.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writeQuotedPrintable(part, version.body); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, nil, err
+	}
+	return textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + alternative.Boundary()},
+	}, buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeEmailAttachment(mixed *multipart.Writer, attachment EmailAttachment) error {
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	part, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+	})
+	if err != nil {
+		return err
+	}
+
+	// Base64 lines are kept to 76 characters as RFC 2045 requires
+	encoded := base64.StdEncoding.EncodeToString(attachment.Content)
+	for len(encoded) > 76 {
+		if _, err := fmt.Fprintf(part, "%s\r\n", encoded[:76]); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = fmt.Fprintf(part, "%s\r\n", encoded)
+	return err
+}
+
+// encodeEmailHeader RFC 2047 encodes a header value that isn't plain ASCII, folding long values
+// onto continuation lines
+func encodeEmailHeader(value string) string {
+	encoded := mime.QEncoding.Encode("UTF-8", value)
+	if encoded == value {
+		return value
+	}
+	return strings.ReplaceAll(encoded, "?= =?", "?=\r\n =?")
+}
+
+// emailMessageID returns the Message-ID for the email with the given unique id, in the sender's
+// domain
+func emailMessageID(id, from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", id, domain)
+}
+
+// listUnsubscribeHeaders returns the List-Unsubscribe header for unsubscribe, or nothing when it
+// is empty. An https URL also gets List-Unsubscribe-Post, so mail clients can unsubscribe with a
+// single POST as described in RFC 8058.
+func listUnsubscribeHeaders(unsubscribe string) [][2]string {
+	if unsubscribe == "" {
+		return nil
+	}
+	headers := [][2]string{{"List-Unsubscribe", "<" + unsubscribe + ">"}}
+	if strings.HasPrefix(unsubscribe, "https://") {
+		headers = append(headers, [2]string{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"})
+	}
+	return headers
+}
+
+var (
+	htmlHiddenPattern = regexp.MustCompile(`(?is)<(head|style|script)\b.*?</(head|style|script)>`)
+	htmlLinkPattern   = regexp.MustCompile(`(?is)<a\b[^>]*\bhref="([^"]*)"[^>]*>(.*?)</a>`)
+	htmlBreakPattern  = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|tr|li|table|ul|ol)>`)
+	htmlHeaderPattern = regexp.MustCompile(`(?i)</th>\s*`)
+	htmlTagPattern    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToText makes the plain text version of an HTML email that has no .txt template: links keep
+// their address, block elements become line breaks and table headers are followed by a colon
+func htmlToText(body string) string {
+	text := htmlHiddenPattern.ReplaceAllString(body, "")
+	text = htmlLinkPattern.ReplaceAllString(text, "$2 ($1)")
+	text = htmlBreakPattern.ReplaceAllString(text, "\n")
+	text = htmlHeaderPattern.ReplaceAllString(text, ": ")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	// Trim every line and keep at most one blank line between paragraphs
+	var lines []string
+	blank := true
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if !blank {
+				lines = append(lines, "")
+			}
+			blank = true
+			continue
+		}
+		lines = append(lines, line)
+		blank = false
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeEmailHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"ascii", "Thanks for your submission"},
+		{"accents", "Merci, vous êtes inscrit"},
+		{"emoji", "🎉 Welcome to PinePods Internal Testing - You're In!"},
+		{"long", "🎉 Welcome – thanks for writing, this subject is long enough to need folding across several lines of the header"},
+		{"long without spaces", strings.Repeat("ü", 80)},
+	}
+
+	decoder := new(mime.WordDecoder)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := encodeEmailHeader(tt.value)
+
+			if !strings.ContainsFunc(tt.value, func(r rune) bool { return r > 127 }) {
+				if encoded != tt.value {
+					t.Errorf("encodeEmailHeader(%q) = %q, want it unchanged", tt.value, encoded)
+				}
+				return
+			}
+
+			// RFC 2047: encoded words are at most 75 characters, and folded lines continue with
+			// whitespace
+			for i, line := range strings.Split(encoded, "\r\n") {
+				if i > 0 && !strings.HasPrefix(line, " ") {
+					t.Errorf("continuation line %q doesn't start with a space", line)
+				}
+				if word := strings.TrimPrefix(line, " "); len(word) > 75 {
+					t.Errorf("encoded word %q is %d characters long", word, len(word))
+				}
+			}
+
+			unfolded := strings.ReplaceAll(encoded, "\r\n", "")
+			decoded, err := decoder.DecodeHeader(unfolded)
+			if err != nil {
+				t.Fatalf("DecodeHeader(%q) failed: %v", unfolded, err)
+			}
+			if decoded != tt.value {
+				t.Errorf("round trip = %q, want %q", decoded, tt.value)
+			}
+		})
+	}
+}
+
+func TestBuildEmailMessageHeaders(t *testing.T) {
+	from := &mail.Address{Name: "PinePods Förms", Address: "forms@example.com"}
+	to := &mail.Address{Address: "tester@example.com"}
+
+	tests := []struct {
+		name        string
+		unsubscribe string
+		want        []string
+		wantMissing []string
+	}{
+		{
+			name:        "no unsubscribe",
+			want:        []string{"Message-ID: <fixed@example.com>\r\n"},
+			wantMissing: []string{"List-Unsubscribe"},
+		},
+		{
+			name:        "mailto unsubscribe",
+			unsubscribe: "mailto:unsubscribe@example.com",
+			want:        []string{"List-Unsubscribe: <mailto:unsubscribe@example.com>\r\n"},
+			wantMissing: []string{"List-Unsubscribe-Post"},
+		},
+		{
+			name:        "https unsubscribe allows one-click",
+			unsubscribe: "https://example.com/unsubscribe",
+			want: []string{
+				"List-Unsubscribe: <https://example.com/unsubscribe>\r\n",
+				"List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, err := buildEmailMessage(emailMessage{
+				From:            from,
+				To:              to,
+				Subject:         "🎉 Welcome",
+				MessageID:       "<fixed@example.com>",
+				ListUnsubscribe: tt.unsubscribe,
+				Text:            "Hello",
+			}, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+			if err != nil {
+				t.Fatalf("buildEmailMessage failed: %v", err)
+			}
+
+			header, _, _ := strings.Cut(string(message), "\r\n\r\n")
+			header += "\r\n"
+			for _, want := range tt.want {
+				if !strings.Contains(header, want) {
+					t.Errorf("header is missing %q:\n%s", want, header)
+				}
+			}
+			for _, missing := range tt.wantMissing {
+				if strings.Contains(header, missing) {
+					t.Errorf("header has %q:\n%s", missing, header)
+				}
+			}
+			if !strings.Contains(header, "Subject: =?UTF-8?q?") {
+				t.Errorf("subject isn't RFC 2047 encoded:\n%s", header)
+			}
+		})
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "paragraphs",
+			html: "<p>Hello</p><p>World</p>",
+			want: "Hello\nWorld\n",
+		},
+		{
+			name: "head and style are dropped",
+			html: "<html><head><title>Hi</title><style>p { color: red; }</style></head><body><p>Body</p></body></html>",
+			want: "Body\n",
+		},
+		{
+			name: "links keep their address",
+			html: `<p>See <a href="https://example.com/docs" target="_blank">the docs</a></p>`,
+			want: "See the docs (https://example.com/docs)\n",
+		},
+		{
+			name: "line breaks",
+			html: "One<br>Two<br/>Three",
+			want: "One\nTwo\nThree\n",
+		},
+		{
+			name: "table headers get a colon",
+			html: "<table><tr><th>name</th><td>Jo</td></tr><tr><th>email</th><td>jo@example.com</td></tr></table>",
+			want: "name: Jo\nemail: jo@example.com\n",
+		},
+		{
+			name: "entities are decoded",
+			html: "<p>Tom &amp; Jerry &lt;3 &#39;quotes&#39;</p>",
+			want: "Tom & Jerry <3 'quotes'\n",
+		},
+		{
+			name: "blank lines collapse and whitespace is trimmed",
+			html: "<div>\n   First   line  \n\n\n\n</div><div></div><div>  Second</div>",
+			want: "First line\n\nSecond\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := htmlToText(tt.html); got != tt.want {
+				t.Errorf("htmlToText(%q) = %q, want %q", tt.html, got, tt.want)
+			}
+		})
+	}
+}
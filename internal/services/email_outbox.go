@@ -0,0 +1,536 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// ErrEmailNotResendable is returned when resending an email that is still queued
+var ErrEmailNotResendable = errors.New("email can't be resent")
+
+// emailOutboxPollInterval is how often the email sender looks for retries that have fallen due
+const emailOutboxPollInterval = 5 * time.Second
+
+// emailOutboxStaleAfter is how long an email may stay sending before it is treated as abandoned by
+// a server that stopped mid-send, well beyond the SMTP and SendGrid timeouts
+const emailOutboxStaleAfter = 10 * time.Minute
+
+func (es *EmailService) createOutboxTable() error {
+	var createTableSQL string
+
+	switch es.config.Database.Type {
+	case "sqlite":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS email_outbox (
+			id TEXT PRIMARY KEY,
+			template TEXT,
+			form_id TEXT,
+			submission_id TEXT,
+			job_id TEXT,
+			message_id TEXT,
+			list_unsubscribe TEXT,
+			recipient TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			reply_to TEXT,
+			html_body TEXT,
+			text_body TEXT,
+			attachments TEXT,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			next_attempt_at DATETIME NOT NULL,
+			last_error TEXT,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			sent_at DATETIME
+		);
+		CREATE INDEX IF NOT EXISTS idx_email_outbox_status_next_attempt ON email_outbox(status, next_attempt_at);
+		CREATE INDEX IF NOT EXISTS idx_email_outbox_submission_id ON email_outbox(submission_id);
+		`
+	case "postgres":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS email_outbox (
+			id TEXT PRIMARY KEY,
+			template TEXT,
+			form_id TEXT,
+			submission_id TEXT,
+			job_id TEXT,
+			message_id TEXT,
+			list_unsubscribe TEXT,
+			recipient TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			reply_to TEXT,
+			html_body TEXT,
+			text_body TEXT,
+			attachments TEXT,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			last_error TEXT,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			sent_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE INDEX IF NOT EXISTS idx_email_outbox_status_next_attempt ON email_outbox(status, next_attempt_at);
+		CREATE INDEX IF NOT EXISTS idx_email_outbox_submission_id ON email_outbox(submission_id);
+		`
+	}
+
+	if _, err := es.db.Exec(createTableSQL); err != nil {
+		return err
+	}
+	return addMissingColumns(es.db, es.config.Database.Type, emailColumnMigrations)
+}
+
+// emailColumnMigrations lists email_outbox columns added after the table was introduced
+var emailColumnMigrations = []tableColumn{
+	{"email_outbox", "job_id", "TEXT", "TEXT"},
+	{"email_outbox", "message_id", "TEXT", "TEXT"},
+	{"email_outbox", "list_unsubscribe", "TEXT", "TEXT"},
+}
+
+// OnEmailFinished registers a callback fired when a queued email has been delivered or has
+// failed for good
+func (es *EmailService) OnEmailFinished(fn EmailFinishedFunc) {
+	es.onFinished = append(es.onFinished, fn)
+}
+
+// enqueue stores a rendered email and wakes the sender to deliver it, returning the email's ID
+func (es *EmailService) enqueue(emailData EmailData) (string, error) {
+	htmlBody, textBody := "", emailData.Body
+	if emailData.IsHTML {
+		htmlBody, textBody = emailData.Body, emailData.TextBody
+	}
+
+	var attachments sql.NullString
+	if len(emailData.Attachments) > 0 {
+		encoded, err := json.Marshal(emailData.Attachments)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode email attachments: %w", err)
+		}
+		attachments = sql.NullString{String: string(encoded), Valid: true}
+	}
+
+	var formID, submissionID string
+	if emailData.Submission != nil {
+		formID, submissionID = emailData.Submission.FormID, emailData.Submission.ID
+	}
+
+	var jobID sql.NullString
+	if emailData.JobID != "" {
+		jobID = sql.NullString{String: emailData.JobID, Valid: true}
+	}
+
+	query := `
+		INSERT INTO email_outbox (id, template, form_id, submission_id, job_id, message_id, list_unsubscribe, recipient, subject, reply_to, html_body, text_body, attachments, status, attempts, max_attempts, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?, ?)
+	`
+	if es.config.Database.Type == "postgres" {
+		query = `
+			INSERT INTO email_outbox (id, template, form_id, submission_id, job_id, message_id, list_unsubscribe, recipient, subject, reply_to, html_body, text_body, attachments, status, attempts, max_attempts, next_attempt_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, 0, $15, $16, $17, $18)
+		`
+	}
+
+	// The Message-ID is fixed now, so a retry after a lost response is recognisable as the same
+	// message
+	id := uuid.New().String()
+	now := time.Now().UTC()
+	_, err := es.db.Exec(query,
+		id,
+		emailData.Template,
+		formID,
+		submissionID,
+		jobID,
+		emailMessageID(id, es.senderAddress()),
+		emailData.ListUnsubscribe,
+		emailData.To,
+		emailData.Subject,
+		emailData.ReplyTo,
+		htmlBody,
+		textBody,
+		attachments,
+		models.EmailStatusPending,
+		es.maxAttempts,
+		now,
+		now,
+		now,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to queue email to %s: %w", emailData.To, err)
+	}
+
+	es.wakeOutbox()
+	return id, nil
+}
+
+func (es *EmailService) wakeOutbox() {
+	select {
+	case es.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (es *EmailService) outboxWorker() {
+	defer es.wg.Done()
+
+	ticker := time.NewTicker(emailOutboxPollInterval)
+	defer ticker.Stop()
+
+	var lastSend time.Time
+	for {
+		// Deliver everything that is due before going back to sleep, keeping to the rate limit
+		for {
+			if wait := time.Until(lastSend.Add(es.sendInterval)); wait > 0 {
+				select {
+				case <-es.stop:
+					return
+				case <-time.After(wait):
+				}
+			}
+			select {
+			case <-es.stop:
+				return
+			default:
+			}
+
+			delivery, emailData, err := es.claimNextEmail()
+			if err != nil {
+				log.Printf("[EMAIL] Failed to claim email: %v", err)
+				break
+			}
+			if delivery == nil {
+				break
+			}
+			es.attemptEmail(delivery, emailData)
+			lastSend = time.Now()
+		}
+
+		select {
+		case <-es.stop:
+			return
+		case <-es.wake:
+		case <-ticker.C:
+			es.requeueInterrupted()
+		}
+	}
+}
+
+// requeueInterrupted returns emails that have been sending for longer than emailOutboxStaleAfter
+// to the queue. Only a server that stopped or crashed mid-send leaves them behind.
+func (es *EmailService) requeueInterrupted() {
+	query := `UPDATE email_outbox SET status = ?, updated_at = ? WHERE status = ? AND updated_at < ?`
+	if es.config.Database.Type == "postgres" {
+		query = `UPDATE email_outbox SET status = $1, updated_at = $2 WHERE status = $3 AND updated_at < $4`
+	}
+	now := time.Now().UTC()
+	if _, err := es.db.Exec(query, models.EmailStatusPending, now, models.EmailStatusSending, now.Add(-emailOutboxStaleAfter)); err != nil {
+		log.Printf("[EMAIL] Failed to requeue interrupted emails: %v", err)
+	}
+}
+
+// claimNextEmail atomically moves the next due email from pending to sending
+func (es *EmailService) claimNextEmail() (*models.EmailDelivery, *EmailData, error) {
+	selectQuery := `SELECT id FROM email_outbox WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT 1`
+	claimQuery := `UPDATE email_outbox SET status = ?, attempts = attempts + 1, updated_at = ? WHERE id = ? AND status = ?`
+	if es.config.Database.Type == "postgres" {
+		selectQuery = `SELECT id FROM email_outbox WHERE status = $1 AND next_attempt_at <= $2 ORDER BY next_attempt_at LIMIT 1`
+		claimQuery = `UPDATE email_outbox SET status = $1, attempts = attempts + 1, updated_at = $2 WHERE id = $3 AND status = $4`
+	}
+
+	for {
+		now := time.Now().UTC()
+
+		var id string
+		err := es.db.QueryRow(selectQuery, models.EmailStatusPending, now).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		res, err := es.db.Exec(claimQuery, models.EmailStatusSending, now, id, models.EmailStatusPending)
+		if err != nil {
+			return nil, nil, err
+		}
+		if claimed, _ := res.RowsAffected(); claimed == 0 {
+			// Another server got there first
+			continue
+		}
+
+		return es.getEmail(id)
+	}
+}
+
+// attemptEmail sends a claimed email and records the outcome: sent, pending with a backoff, or
+// failed once it has used up its attempts or the server rejected it outright
+func (es *EmailService) attemptEmail(delivery *models.EmailDelivery, emailData *EmailData) {
+	err := es.deliver(*emailData)
+
+	now := time.Now().UTC()
+	delivery.UpdatedAt = now
+	delivery.LastError = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = models.EmailStatusSent
+		delivery.SentAt = &now
+		log.Printf("[EMAIL] Sent email %s to %s", delivery.ID, delivery.To)
+	case delivery.Attempts >= delivery.MaxAttempts || permanentEmailError(err):
+		delivery.Status = models.EmailStatusFailed
+		delivery.LastError = err.Error()
+		log.Printf("[EMAIL] Email %s to %s failed permanently after %d attempt(s): %v",
+			delivery.ID, delivery.To, delivery.Attempts, err)
+	default:
+		delivery.Status = models.EmailStatusPending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(es.backoff(delivery.Attempts))
+		log.Printf("[EMAIL] Email %s to %s failed on attempt %d, retrying at %s: %v",
+			delivery.ID, delivery.To, delivery.Attempts, delivery.NextAttemptAt.Format(time.RFC3339), err)
+	}
+
+	query := `
+		UPDATE email_outbox
+		SET status = ?, next_attempt_at = ?, last_error = ?, updated_at = ?, sent_at = ?
+		WHERE id = ?
+	`
+	if es.config.Database.Type == "postgres" {
+		query = `
+			UPDATE email_outbox
+			SET status = $1, next_attempt_at = $2, last_error = $3, updated_at = $4, sent_at = $5
+			WHERE id = $6
+		`
+	}
+	if _, err := es.db.Exec(query, delivery.Status, delivery.NextAttemptAt, delivery.LastError, delivery.UpdatedAt, delivery.SentAt, delivery.ID); err != nil {
+		log.Printf("[EMAIL] Failed to update email %s: %v", delivery.ID, err)
+		return
+	}
+
+	if delivery.Status != models.EmailStatusPending {
+		for _, fn := range es.onFinished {
+			fn(delivery)
+		}
+	}
+}
+
+// permanentEmailError reports whether retrying can't help, e.g. an SMTP server answering 550
+// for an unknown recipient. Failures to connect or authenticate, such as a 535 after the
+// password changed, are retried: they say nothing about the message.
+func permanentEmailError(err error) bool {
+	var rejected *smtpRejectedError
+	return errors.As(err, &rejected) && rejected.reply.Code >= 500
+}
+
+// backoff returns the delay before the next attempt: base * 2^(attempt-1), capped at maxBackoff
+func (es *EmailService) backoff(attempt int) time.Duration {
+	delay := es.baseBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= es.maxBackoff {
+			return es.maxBackoff
+		}
+	}
+	return delay
+}
+
+// GetEmailDeliveries lists outbox emails without their bodies, most recently updated first,
+// optionally filtered by status
+func (es *EmailService) GetEmailDeliveries(status string, limit, offset int) ([]models.EmailDelivery, error) {
+	if status == "" {
+		return es.queryEmailDeliveries(`ORDER BY updated_at DESC LIMIT ? OFFSET ?`, `ORDER BY updated_at DESC LIMIT $1 OFFSET $2`, limit, offset)
+	}
+	return es.queryEmailDeliveries(`WHERE status = ? ORDER BY updated_at DESC LIMIT ? OFFSET ?`, `WHERE status = $1 ORDER BY updated_at DESC LIMIT $2 OFFSET $3`, status, limit, offset)
+}
+
+// GetSubmissionEmails lists the emails queued for a submission without their bodies, oldest first
+func (es *EmailService) GetSubmissionEmails(submissionID string) ([]models.EmailDelivery, error) {
+	return es.queryEmailDeliveries(`WHERE submission_id = ? ORDER BY created_at`, `WHERE submission_id = $1 ORDER BY created_at`, submissionID)
+}
+
+// latestJobEmail returns the email most recently queued by an action job, or nil if it has none
+func (es *EmailService) latestJobEmail(jobID string) (*models.EmailDelivery, error) {
+	deliveries, err := es.queryEmailDeliveries(`WHERE job_id = ? ORDER BY created_at DESC LIMIT 1`, `WHERE job_id = $1 ORDER BY created_at DESC LIMIT 1`, jobID)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+	return &deliveries[0], nil
+}
+
+func (es *EmailService) queryEmailDeliveries(sqliteWhere, postgresWhere string, args ...interface{}) ([]models.EmailDelivery, error) {
+	query := `
+		SELECT id, template, form_id, submission_id, job_id, message_id, recipient, subject, reply_to, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at
+		FROM email_outbox ` + sqliteWhere
+	if es.config.Database.Type == "postgres" {
+		query = `
+			SELECT id, template, form_id, submission_id, job_id, message_id, recipient, subject, reply_to, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at
+			FROM email_outbox ` + postgresWhere
+	}
+
+	rows, err := es.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.EmailDelivery{}
+	for rows.Next() {
+		delivery, err := scanEmailDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// GetEmailDelivery returns one outbox email with its rendered bodies and attachment names
+func (es *EmailService) GetEmailDelivery(id string) (*models.EmailDelivery, error) {
+	delivery, _, err := es.getEmail(id)
+	return delivery, err
+}
+
+// ResendEmail queues a sent or failed email for delivery again, with a fresh set of attempts.
+// The email is sent exactly as it was rendered the first time.
+func (es *EmailService) ResendEmail(id string) (*models.EmailDelivery, error) {
+	delivery, _, err := es.getEmail(id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status != models.EmailStatusFailed && delivery.Status != models.EmailStatusSent {
+		return nil, fmt.Errorf("%w: email is %s", ErrEmailNotResendable, delivery.Status)
+	}
+
+	// A sent email goes out again as a new message, which clients would otherwise hide as a
+	// duplicate. A failed one keeps its Message-ID, in case an attempt was delivered after all.
+	messageID := delivery.MessageID
+	if delivery.Status == models.EmailStatusSent {
+		messageID = emailMessageID(uuid.New().String(), es.senderAddress())
+	}
+
+	now := time.Now().UTC()
+	query := `
+		UPDATE email_outbox
+		SET status = ?, attempts = 0, max_attempts = ?, next_attempt_at = ?, last_error = NULL, updated_at = ?, sent_at = NULL, message_id = ?
+		WHERE id = ? AND status = ?
+	`
+	if es.config.Database.Type == "postgres" {
+		query = `
+			UPDATE email_outbox
+			SET status = $1, attempts = 0, max_attempts = $2, next_attempt_at = $3, last_error = NULL, updated_at = $4, sent_at = NULL, message_id = $5
+			WHERE id = $6 AND status = $7
+		`
+	}
+
+	res, err := es.db.Exec(query, models.EmailStatusPending, es.maxAttempts, now, now, messageID, id, delivery.Status)
+	if err != nil {
+		return nil, err
+	}
+	if updated, _ := res.RowsAffected(); updated == 0 {
+		return nil, fmt.Errorf("%w: email changed while resending", ErrEmailNotResendable)
+	}
+	log.Printf("[EMAIL] Resending email %s to %s", id, delivery.To)
+
+	es.wakeOutbox()
+	return es.GetEmailDelivery(id)
+}
+
+// getEmail reads a whole outbox row, returning it along with the email ready to deliver
+func (es *EmailService) getEmail(id string) (*models.EmailDelivery, *EmailData, error) {
+	query := `
+		SELECT id, template, form_id, submission_id, job_id, message_id, recipient, subject, reply_to, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at, html_body, text_body, attachments, list_unsubscribe
+		FROM email_outbox WHERE id = ?
+	`
+	if es.config.Database.Type == "postgres" {
+		query = `
+			SELECT id, template, form_id, submission_id, job_id, message_id, recipient, subject, reply_to, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at, html_body, text_body, attachments, list_unsubscribe
+			FROM email_outbox WHERE id = $1
+		`
+	}
+
+	var htmlBody, textBody, attachments, listUnsubscribe sql.NullString
+	delivery, err := scanEmailDelivery(es.db.QueryRow(query, id), &htmlBody, &textBody, &attachments, &listUnsubscribe)
+	if err != nil {
+		return nil, nil, err
+	}
+	delivery.HTMLBody = htmlBody.String
+	delivery.TextBody = textBody.String
+	// Emails queued before the message_id column existed get one derived from their row
+	if delivery.MessageID == "" {
+		delivery.MessageID = emailMessageID(delivery.ID, es.senderAddress())
+	}
+
+	emailData := &EmailData{
+		Template:        delivery.Template,
+		To:              delivery.To,
+		Subject:         delivery.Subject,
+		ReplyTo:         delivery.ReplyTo,
+		Body:            delivery.TextBody,
+		MessageID:       delivery.MessageID,
+		ListUnsubscribe: listUnsubscribe.String,
+	}
+	if delivery.HTMLBody != "" {
+		emailData.Body, emailData.TextBody, emailData.IsHTML = delivery.HTMLBody, delivery.TextBody, true
+	}
+	if attachments.String != "" {
+		if err := json.Unmarshal([]byte(attachments.String), &emailData.Attachments); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode attachments of email %s: %w", delivery.ID, err)
+		}
+		for _, attachment := range emailData.Attachments {
+			delivery.Attachments = append(delivery.Attachments, attachment.Filename)
+		}
+	}
+	return delivery, emailData, nil
+}
+
+// scanEmailDelivery reads the columns shared by the list and single email queries, followed by
+// any extra columns
+func scanEmailDelivery(row rowScanner, extra ...interface{}) (*models.EmailDelivery, error) {
+	var delivery models.EmailDelivery
+	var template, formID, submissionID, jobID, messageID, replyTo, lastError sql.NullString
+	var sentAt sql.NullTime
+
+	dest := []interface{}{
+		&delivery.ID,
+		&template,
+		&formID,
+		&submissionID,
+		&jobID,
+		&messageID,
+		&delivery.To,
+		&delivery.Subject,
+		&replyTo,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.MaxAttempts,
+		&delivery.NextAttemptAt,
+		&lastError,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+		&sentAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	delivery.Template = template.String
+	delivery.FormID = formID.String
+	delivery.SubmissionID = submissionID.String
+	delivery.JobID = jobID.String
+	delivery.MessageID = messageID.String
+	delivery.ReplyTo = replyTo.String
+	delivery.LastError = lastError.String
+	if sentAt.Valid {
+		delivery.SentAt = &sentAt.Time
+	}
+	return &delivery, nil
+}
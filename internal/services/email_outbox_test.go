@@ -0,0 +1,255 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// newEmailOutboxTestService returns an EmailService sending through a stub SendGrid API that
+// answers with the given statuses in turn, repeating the last one, and the Message-ID of every
+// email it received. Retries are due a millisecond after a failure.
+func newEmailOutboxTestService(t *testing.T, maxAttempts int, statuses ...int) (*EmailService, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var messageIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var payload sendGridRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("request body isn't a SendGrid request: %v", err)
+		}
+		messageIDs = append(messageIDs, payload.Headers["Message-ID"])
+		call := len(messageIDs)
+		if call > len(statuses) {
+			call = len(statuses)
+		}
+		w.WriteHeader(statuses[call-1])
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{}
+	cfg.Email.Provider = "sendgrid"
+	cfg.Email.SendGrid.APIKey = "SG.test"
+	cfg.Email.SendGrid.From = "forms@example.com"
+	cfg.Email.SendGrid.BaseURL = server.URL
+	cfg.Email.Retry = config.EmailRetryConfig{MaxAttempts: maxAttempts, BaseBackoff: "1ms"}
+
+	return newEmailTestService(t, cfg), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), messageIDs...)
+	}
+}
+
+// sendDueEmails sends every email that is due, like an idle outbox worker, and returns how many
+// it attempted
+func sendDueEmails(t *testing.T, es *EmailService) int {
+	t.Helper()
+
+	attempted := 0
+	for {
+		delivery, emailData, err := es.claimNextEmail()
+		if err != nil {
+			t.Fatalf("claimNextEmail failed: %v", err)
+		}
+		if delivery == nil {
+			return attempted
+		}
+		es.attemptEmail(delivery, emailData)
+		attempted++
+	}
+}
+
+func queueTestEmail(t *testing.T, es *EmailService) string {
+	t.Helper()
+
+	id, err := es.enqueue(EmailData{
+		Template:   "confirmation",
+		To:         "tester@example.com",
+		Subject:    "Thanks",
+		Body:       "<p>Thanks</p>",
+		TextBody:   "Thanks",
+		IsHTML:     true,
+		Submission: &models.FormSubmission{ID: "sub-1", FormID: "contact-form"},
+	})
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	return id
+}
+
+func TestEmailOutboxBackoff(t *testing.T) {
+	es := &EmailService{baseBackoff: time.Minute, maxBackoff: time.Hour}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{6, 32 * time.Minute},
+		{7, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := es.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestEmailOutboxDelivery(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"sent first time", []int{http.StatusAccepted}, models.EmailStatusSent, 1},
+		{"sent on a retry", []int{http.StatusServiceUnavailable, http.StatusAccepted}, models.EmailStatusSent, 2},
+		{"attempts used up", []int{http.StatusServiceUnavailable}, models.EmailStatusFailed, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es, messageIDs := newEmailOutboxTestService(t, 3, tt.statuses...)
+
+			var finished []*models.EmailDelivery
+			es.OnEmailFinished(func(delivery *models.EmailDelivery) {
+				finished = append(finished, delivery)
+			})
+
+			id := queueTestEmail(t, es)
+
+			// Each retry waits out the backoff before it is due
+			for i := 0; i < 10 && sendDueEmails(t, es) > 0; i++ {
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			delivery, err := es.GetEmailDelivery(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if delivery.Status != tt.wantStatus || delivery.Attempts != tt.wantAttempts || delivery.MaxAttempts != 3 {
+				t.Errorf("email = %s after %d/%d attempt(s), want %s after %d/3", delivery.Status, delivery.Attempts, delivery.MaxAttempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if delivery.SubmissionID != "sub-1" || delivery.FormID != "contact-form" {
+				t.Errorf("email linked to %s/%s, want contact-form/sub-1", delivery.FormID, delivery.SubmissionID)
+			}
+			if tt.wantStatus == models.EmailStatusFailed && !strings.Contains(delivery.LastError, "status 503") {
+				t.Errorf("last_error = %q, want the provider's status", delivery.LastError)
+			}
+
+			// Retries aren't reported, only the final outcome
+			if len(finished) != 1 || finished[0].ID != id || finished[0].Status != tt.wantStatus {
+				t.Errorf("OnEmailFinished called with %+v, want the email once as %s", finished, tt.wantStatus)
+			}
+
+			sent := messageIDs()
+			if len(sent) != tt.wantAttempts {
+				t.Fatalf("provider received %d emails, want %d", len(sent), tt.wantAttempts)
+			}
+			// Every attempt carries the Message-ID fixed when the email was queued
+			for _, messageID := range sent {
+				if messageID != delivery.MessageID {
+					t.Errorf("Message-ID = %q, want %q", messageID, delivery.MessageID)
+				}
+			}
+		})
+	}
+}
+
+func TestPermanentEmailError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"unknown recipient", &smtpRejectedError{&textproto.Error{Code: 550, Msg: "no such user"}}, true},
+		{"wrapped rejection", fmt.Errorf("failed to send: %w", &smtpRejectedError{&textproto.Error{Code: 554, Msg: "spam"}}), true},
+		{"mailbox busy", &smtpRejectedError{&textproto.Error{Code: 451, Msg: "try again later"}}, false},
+		// The password changed, which says nothing about the message
+		{"authentication failed", &textproto.Error{Code: 535, Msg: "bad credentials"}, false},
+		{"connection refused", errors.New("dial tcp: connection refused"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := permanentEmailError(tt.err); got != tt.want {
+				t.Errorf("permanentEmailError(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResendEmail(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantNewMsgID bool
+	}{
+		// A sent email goes out again as a new message, which clients would otherwise hide
+		{"sent", []int{http.StatusAccepted}, true},
+		// A failed one keeps its Message-ID, in case an attempt was delivered after all
+		{"failed", []int{http.StatusServiceUnavailable, http.StatusAccepted}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es, messageIDs := newEmailOutboxTestService(t, 1, tt.statuses...)
+			id := queueTestEmail(t, es)
+			sendDueEmails(t, es)
+
+			resent, err := es.ResendEmail(id)
+			if err != nil {
+				t.Fatalf("ResendEmail failed: %v", err)
+			}
+			if resent.Status != models.EmailStatusPending || resent.Attempts != 0 || resent.LastError != "" || resent.SentAt != nil {
+				t.Errorf("resent email = %+v, want it pending with a fresh set of attempts", resent)
+			}
+			// The email is sent exactly as it was rendered the first time
+			if resent.HTMLBody != "<p>Thanks</p>" || resent.TextBody != "Thanks" {
+				t.Errorf("resent bodies = %q and %q, want the original ones", resent.HTMLBody, resent.TextBody)
+			}
+
+			sendDueEmails(t, es)
+			if delivery, _ := es.GetEmailDelivery(id); delivery.Status != models.EmailStatusSent {
+				t.Errorf("resent email status = %s, want %s", delivery.Status, models.EmailStatusSent)
+			}
+
+			sent := messageIDs()
+			if len(sent) != 2 {
+				t.Fatalf("provider received %d emails, want 2", len(sent))
+			}
+			if newMsgID := sent[0] != sent[1]; newMsgID != tt.wantNewMsgID {
+				t.Errorf("Message-IDs %s then %s, want a new one: %t", sent[0], sent[1], tt.wantNewMsgID)
+			}
+		})
+	}
+}
+
+func TestResendEmailPending(t *testing.T) {
+	es, _ := newEmailOutboxTestService(t, 3, http.StatusAccepted)
+	id := queueTestEmail(t, es)
+
+	// Resending a queued email would send it twice
+	if _, err := es.ResendEmail(id); !errors.Is(err, ErrEmailNotResendable) {
+		t.Errorf("ResendEmail error = %v, want ErrEmailNotResendable", err)
+	}
+}
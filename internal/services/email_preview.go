@@ -0,0 +1,199 @@
+package services
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// EmailPreview is a rendered email exactly as it would be queued
+type EmailPreview struct {
+	Template string `json:"template"`
+	Subject  string `json:"subject"`
+	ReplyTo  string `json:"reply_to,omitempty"`
+	// The List-Unsubscribe target, for emails to submitters of forms that opt in
+	ListUnsubscribe string   `json:"list_unsubscribe,omitempty"`
+	HTMLBody        string   `json:"html_body,omitempty"`
+	TextBody        string   `json:"text_body"`
+	Attachments     []string `json:"attachments,omitempty"`
+}
+
+// PreviewEmail renders a template for a submission without sending it. An empty template uses the
+// form's email.template and an empty subject the one the template is normally sent with. Admin
+// templates are rendered with result, or with every configured action succeeding when it is nil.
+func (es *EmailService) PreviewEmail(templateName, subject string, submission *models.FormSubmission, formConfig config.FormConfig, result *models.ProcessingResult) (*EmailPreview, error) {
+	emailData, err := es.previewEmailData(templateName, subject, submission, formConfig, result)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &EmailPreview{
+		Template:        emailData.Template,
+		Subject:         emailData.Subject,
+		ReplyTo:         emailData.ReplyTo,
+		TextBody:        emailData.Body,
+		ListUnsubscribe: emailData.ListUnsubscribe,
+	}
+	if emailData.IsHTML {
+		preview.HTMLBody, preview.TextBody = emailData.Body, emailData.TextBody
+	}
+	for _, attachment := range emailData.Attachments {
+		preview.Attachments = append(preview.Attachments, attachment.Filename)
+	}
+	return preview, nil
+}
+
+// SendPreviewEmail renders a template like PreviewEmail and queues it to the given address with
+// "[Test]" before its subject, returning the id of the queued email. The test email isn't linked
+// to the submission, so it doesn't show up among the submission's emails.
+func (es *EmailService) SendPreviewEmail(to, templateName, subject string, submission *models.FormSubmission, formConfig config.FormConfig, result *models.ProcessingResult) (string, error) {
+	emailData, err := es.previewEmailData(templateName, subject, submission, formConfig, result)
+	if err != nil {
+		return "", err
+	}
+	emailData.To = to
+	emailData.Subject = "[Test] " + emailData.Subject
+	emailData.Submission = nil
+
+	return es.enqueue(*emailData)
+}
+
+// previewEmailData renders an email the way the matching Send method would
+func (es *EmailService) previewEmailData(templateName, subject string, submission *models.FormSubmission, formConfig config.FormConfig, result *models.ProcessingResult) (*EmailData, error) {
+	if templateName == "" {
+		templateName = formConfig.Email.Template
+	}
+	if result == nil {
+		result = sampleProcessingResult(submission, formConfig)
+	}
+
+	adminTemplate := formConfig.Email.Admin.Template
+	if adminTemplate == "" {
+		adminTemplate = "admin-notification"
+	}
+
+	emailData := &EmailData{
+		Subject:    subject,
+		Submission: submission,
+		FormConfig: formConfig,
+		IsHTML:     true,
+		PublicURL:  es.config.Server.PublicURL,
+		Result:     result,
+	}
+	if err := es.renderEmailTemplate(templateName, emailData); err != nil {
+		return nil, err
+	}
+
+	switch emailData.Template {
+	case adminTemplate:
+		if emailData.Subject == "" {
+			emailData.Subject = es.adminNotificationSubject(submission, formConfig, result)
+		}
+		if submitter := es.GetEmailFromSubmission(submission); submitter != "" {
+			if _, err := mail.ParseAddress(submitter); err == nil {
+				emailData.ReplyTo = submitter
+			}
+		}
+	case "internal-testing":
+		if emailData.Subject == "" {
+			emailData.Subject = welcomeEmailSubject
+		}
+	case "feedback-notification":
+		if emailData.Subject == "" {
+			emailData.Subject = feedbackEmailSubject
+		}
+	default:
+		attachments, err := formEmailAttachments(formConfig)
+		if err != nil {
+			return nil, err
+		}
+		emailData.Attachments = attachments
+		if formConfig.Email.ListUnsubscribe {
+			emailData.ListUnsubscribe = es.config.Email.ListUnsubscribe
+		}
+	}
+	if emailData.Subject == "" {
+		emailData.Subject = formConfig.Email.Subject
+	}
+	if emailData.Subject == "" {
+		emailData.Subject = fmt.Sprintf("%s email", emailData.Template)
+	}
+
+	es.completeEmail(emailData)
+	return emailData, nil
+}
+
+// SampleSubmission is a submission to preview emails with when there is no real one. Fields of the
+// form missing from data get an example value.
+func SampleSubmission(formID string, formConfig config.FormConfig, data map[string]interface{}) *models.FormSubmission {
+	sample := make(map[string]interface{}, len(data))
+	for _, field := range formConfig.Fields {
+		sample[field.Name] = sampleFieldValue(field)
+	}
+	for name, value := range data {
+		sample[name] = value
+	}
+
+	now := time.Now().UTC()
+	return &models.FormSubmission{
+		ID:          uuid.New().String(),
+		FormID:      formID,
+		Data:        sample,
+		IPAddress:   "192.0.2.1",
+		UserAgent:   "PinePods Forms email preview",
+		SubmittedAt: now,
+		Processed:   true,
+		ProcessedAt: &now,
+		Status:      models.SubmissionStatusReceived,
+	}
+}
+
+func sampleFieldValue(field config.FieldConfig) interface{} {
+	switch field.Type {
+	case "email":
+		return "jane.doe@example.com"
+	case "number":
+		if field.Min != nil {
+			return *field.Min
+		}
+		return 1
+	case "checkbox":
+		return true
+	}
+	if len(field.Options) > 0 {
+		return field.Options[0]
+	}
+
+	if strings.Contains(strings.ToLower(field.Name), "name") {
+		return "Jane Doe"
+	}
+	label := field.Label
+	if label == "" {
+		label = field.Name
+	}
+	return "Example " + strings.ToLower(label)
+}
+
+// sampleProcessingResult is the result admin templates are previewed with: every action
+// configured on the form succeeded
+func sampleProcessingResult(submission *models.FormSubmission, formConfig config.FormConfig) *models.ProcessingResult {
+	result := &models.ProcessingResult{
+		SubmissionID: submission.ID,
+		FormID:       submission.FormID,
+		Success:      true,
+		ProcessedAt:  time.Now().UTC(),
+	}
+	for _, action := range formConfig.Actions {
+		result.Actions = append(result.Actions, models.ActionResult{
+			ActionType: action.Type,
+			Success:    true,
+			Message:    "Preview, the action was not run",
+		})
+	}
+	return result
+}
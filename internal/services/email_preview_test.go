@@ -0,0 +1,159 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+)
+
+func newPreviewFormConfig(listUnsubscribe bool) config.FormConfig {
+	formConfig := config.FormConfig{
+		Name: "Contact",
+		Fields: []config.FieldConfig{
+			{Name: "name", Type: "text"},
+			{Name: "email", Type: "email"},
+			{Name: "message", Type: "textarea", Label: "Your message"},
+		},
+	}
+	formConfig.Email.Template = "confirmation"
+	formConfig.Email.Subject = "Thanks for contacting us"
+	formConfig.Email.ListUnsubscribe = listUnsubscribe
+	return formConfig
+}
+
+func TestPreviewEmail(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Email.ListUnsubscribe = "mailto:unsubscribe@example.com"
+	es := newEmailTestService(t, cfg)
+
+	tests := []struct {
+		name                string
+		template            string
+		optIn               bool
+		wantTemplate        string
+		wantSubject         string // Prefix of the subject
+		wantReplyTo         string
+		wantListUnsubscribe string
+	}{
+		{"form template", "", false, "confirmation", "Thanks for contacting us", "", ""},
+		{"opted in to List-Unsubscribe", "", true, "confirmation", "Thanks for contacting us", "", "mailto:unsubscribe@example.com"},
+		// Admins replying to the notification reach the submitter, and can't unsubscribe
+		{"admin notification", "admin-notification", true, "admin-notification", "New Contact submission (", "jane.doe@example.com", ""},
+		{"welcome", "internal-testing", false, "internal-testing", welcomeEmailSubject, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			formConfig := newPreviewFormConfig(tt.optIn)
+			submission := SampleSubmission("contact-form", formConfig, nil)
+
+			preview, err := es.PreviewEmail(tt.template, "", submission, formConfig, nil)
+			if err != nil {
+				t.Fatalf("PreviewEmail failed: %v", err)
+			}
+			if preview.Template != tt.wantTemplate || !strings.HasPrefix(preview.Subject, tt.wantSubject) {
+				t.Errorf("preview = %s %q, want %s %q", preview.Template, preview.Subject, tt.wantTemplate, tt.wantSubject)
+			}
+			if preview.ReplyTo != tt.wantReplyTo {
+				t.Errorf("reply_to = %q, want %q", preview.ReplyTo, tt.wantReplyTo)
+			}
+			if preview.ListUnsubscribe != tt.wantListUnsubscribe {
+				t.Errorf("list_unsubscribe = %q, want %q", preview.ListUnsubscribe, tt.wantListUnsubscribe)
+			}
+			if !strings.Contains(preview.HTMLBody, "</") || preview.TextBody == "" || strings.Contains(preview.TextBody, "</") {
+				t.Errorf("bodies = %q and %q, want the HTML and a plain text version", preview.HTMLBody, preview.TextBody)
+			}
+		})
+	}
+}
+
+func TestPreviewEmailSubject(t *testing.T) {
+	es := newEmailTestService(t, nil)
+	formConfig := newPreviewFormConfig(false)
+	submission := SampleSubmission("contact-form", formConfig, map[string]interface{}{"name": "Sam"})
+
+	preview, err := es.PreviewEmail("", "Custom subject", submission, formConfig, nil)
+	if err != nil {
+		t.Fatalf("PreviewEmail failed: %v", err)
+	}
+	if preview.Subject != "Custom subject" {
+		t.Errorf("subject = %q, want the one asked for", preview.Subject)
+	}
+	if !strings.Contains(preview.HTMLBody, "Dear Sam") {
+		t.Errorf("html_body = %q, want it rendered with the given data", preview.HTMLBody)
+	}
+}
+
+func TestSendPreviewEmail(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Email.ListUnsubscribe = "mailto:unsubscribe@example.com"
+	es := newEmailTestService(t, cfg)
+	formConfig := newPreviewFormConfig(true)
+	submission := SampleSubmission("contact-form", formConfig, nil)
+
+	id, err := es.SendPreviewEmail("admin@example.com", "", "", submission, formConfig, nil)
+	if err != nil {
+		t.Fatalf("SendPreviewEmail failed: %v", err)
+	}
+
+	delivery, emailData, err := es.getEmail(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.To != "admin@example.com" || delivery.Subject != "[Test] Thanks for contacting us" {
+		t.Errorf("queued email = %s %q, want the test address and a marked subject", delivery.To, delivery.Subject)
+	}
+	if emailData.ListUnsubscribe != "mailto:unsubscribe@example.com" {
+		t.Errorf("list_unsubscribe = %q, want the target the real email would carry", emailData.ListUnsubscribe)
+	}
+
+	// A test email isn't one of the submission's emails
+	if delivery.SubmissionID != "" || delivery.FormID != "" {
+		t.Errorf("test email linked to %s/%s, want no submission", delivery.FormID, delivery.SubmissionID)
+	}
+	emails, err := es.GetSubmissionEmails(submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 0 {
+		t.Errorf("submission lists %d emails, want none", len(emails))
+	}
+}
+
+func TestSampleSubmission(t *testing.T) {
+	minimum := 18.0
+	formConfig := config.FormConfig{Fields: []config.FieldConfig{
+		{Name: "full_name", Type: "text"},
+		{Name: "email", Type: "email"},
+		{Name: "age", Type: "number", Min: &minimum},
+		{Name: "count", Type: "number"},
+		{Name: "subscribe", Type: "checkbox"},
+		{Name: "platform", Type: "select", Options: []string{"android", "ios"}},
+		{Name: "message", Type: "textarea", Label: "Your Message"},
+	}}
+
+	submission := SampleSubmission("contact-form", formConfig, map[string]interface{}{"platform": "ios", "extra": "kept"})
+
+	want := map[string]interface{}{
+		"full_name": "Jane Doe",
+		"email":     "jane.doe@example.com",
+		"age":       18.0,
+		"count":     1,
+		"subscribe": true,
+		"platform":  "ios", // Given values win over the examples
+		"message":   "Example your message",
+		"extra":     "kept",
+	}
+	if len(submission.Data) != len(want) {
+		t.Errorf("data = %v, want %v", submission.Data, want)
+	}
+	for name, value := range want {
+		if submission.Data[name] != value {
+			t.Errorf("data[%q] = %v, want %v", name, submission.Data[name], value)
+		}
+	}
+	if submission.ID == "" || submission.FormID != "contact-form" || !submission.Processed {
+		t.Errorf("submission = %+v, want a processed submission to contact-form with an ID", submission)
+	}
+}
@@ -2,32 +2,121 @@ package services
 
 import (
 	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
-	"html/template"
-	"net/smtp"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/mail"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
 	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
 )
 
+// Subjects of the emails that don't take theirs from the form's config
+const (
+	welcomeEmailSubject  = "🎉 Welcome to PinePods Internal Testing - You're In!"
+	feedbackEmailSubject = "New Feedback Received - PinePods"
+)
+
+// welcomeEmailTemplate is the template of the welcome email sent by the ntfy button
+const welcomeEmailTemplate = "internal-testing"
+
+// EmailFinishedFunc is called once a queued email was sent or failed for good
+type EmailFinishedFunc func(delivery *models.EmailDelivery)
+
+// EmailService renders emails and queues them in the email_outbox table. A background sender
+// delivers them through the configured provider, no faster than its rate limit, and retries
+// failures with exponential backoff.
 type EmailService struct {
 	config *config.Config
+	db     *sql.DB
+
+	maxAttempts  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	sendInterval time.Duration // Minimum gap between two sends, from the provider's rate limit
+
+	onFinished []EmailFinishedFunc
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
 }
 
-func NewEmailService(cfg *config.Config) *EmailService {
-	return &EmailService{
-		config: cfg,
+// NewEmailService creates the email outbox table. Call Start to begin delivering queued emails.
+func NewEmailService(cfg *config.Config, db *sql.DB) (*EmailService, error) {
+	service := &EmailService{
+		config:      cfg,
+		db:          db,
+		maxAttempts: cfg.Email.Retry.MaxAttempts,
+		baseBackoff: parseDurationOr(cfg.Email.Retry.BaseBackoff, time.Minute),
+		maxBackoff:  parseDurationOr(cfg.Email.Retry.MaxBackoff, time.Hour),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	if service.maxAttempts < 1 {
+		service.maxAttempts = 1
+	}
+
+	rateLimit := cfg.Email.SMTP.RateLimit
+	if cfg.Email.Provider == "sendgrid" {
+		rateLimit = cfg.Email.SendGrid.RateLimit
 	}
+	if rateLimit > 0 {
+		service.sendInterval = time.Minute / time.Duration(rateLimit)
+	}
+
+	if err := service.createOutboxTable(); err != nil {
+		return nil, fmt.Errorf("failed to create email outbox: %w", err)
+	}
+	return service, nil
+}
+
+// Start delivers queued emails in the background, beginning with any abandoned mid-send by a
+// stopped server
+func (es *EmailService) Start() {
+	es.requeueInterrupted()
+	es.wg.Add(1)
+	go es.outboxWorker()
+}
+
+// Stop waits for the email being sent, if any. Queued emails are delivered after a restart.
+func (es *EmailService) Stop() {
+	close(es.stop)
+	es.wg.Wait()
 }
 
 type EmailData struct {
+	Template   string // Set by renderEmailTemplate
 	To         string
 	Subject    string
 	Body       string
+	TextBody   string // Plain text version sent alongside an HTML Body
 	IsHTML     bool
 	Submission *models.FormSubmission
 	FormConfig config.FormConfig
+	PublicURL  string // server.public_url, for links back to this server
+	Result     *models.ProcessingResult // Action results, set for admin notifications
+	ReplyTo     string // Defaults to the form's email.reply_to, then email.reply_to
+	Attachments []EmailAttachment
+	JobID       string // Action job that waits for the email to be delivered
+	MessageID   string // Set when the email is queued and kept across retries
+	// The form's List-Unsubscribe target, set for emails to submitters of forms that opt in
+	ListUnsubscribe string
+
+	// google_play.google_group and its join page, for welcome emails asking Android testers to
+	// join the group listed on the test track
+	GoogleGroup    string
+	GoogleGroupURL string
 }
 
 func (es *EmailService) SendConfirmationEmail(submission *models.FormSubmission, formConfig config.FormConfig) error {
@@ -47,323 +136,193 @@ func (es *EmailService) SendConfirmationEmail(submission *models.FormSubmission,
 		return fmt.Errorf("no email address found in submission data")
 	}
 
+	return es.SendTemplateEmail(submission, formConfig, recipientEmail, formConfig.Email.Template, formConfig.Email.Subject)
+}
+
+// SendTemplateEmail renders the named template for a submission and sends it to the given address
+func (es *EmailService) SendTemplateEmail(submission *models.FormSubmission, formConfig config.FormConfig, to, templateName, subject string) error {
+	_, err := es.queueTemplateEmail(submission, formConfig, to, templateName, subject, "")
+	return err
+}
+
+// queueTemplateEmail is SendTemplateEmail for the action job jobID, which is told once the email
+// has been delivered. It returns the id of the queued email.
+func (es *EmailService) queueTemplateEmail(submission *models.FormSubmission, formConfig config.FormConfig, to, templateName, subject, jobID string) (string, error) {
 	// Prepare email data
 	emailData := EmailData{
-		To:         recipientEmail,
-		Subject:    formConfig.Email.Subject,
+		To:         to,
+		Subject:    subject,
 		Submission: submission,
 		FormConfig: formConfig,
 		IsHTML:     true,
+		PublicURL:  es.config.Server.PublicURL,
+		JobID:      jobID,
+	}
+	if formConfig.Email.ListUnsubscribe {
+		emailData.ListUnsubscribe = es.config.Email.ListUnsubscribe
 	}
 
 	// Generate email body from template
-	body, err := es.renderEmailTemplate(formConfig.Email.Template, emailData)
+	if err := es.renderEmailTemplate(templateName, &emailData); err != nil {
+		return "", fmt.Errorf("failed to render email template: %w", err)
+	}
+
+	attachments, err := formEmailAttachments(formConfig)
 	if err != nil {
-		return fmt.Errorf("failed to render email template: %w", err)
+		return "", err
 	}
-	emailData.Body = body
+	emailData.Attachments = attachments
 
-	return es.sendEmail(emailData)
+	es.completeEmail(&emailData)
+	return es.enqueue(emailData)
+}
+
+// formEmailAttachments reads the files listed in the form's email.attachments
+func formEmailAttachments(formConfig config.FormConfig) ([]EmailAttachment, error) {
+	var attachments []EmailAttachment
+	for _, file := range formConfig.Email.Attachments {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email attachment: %w", err)
+		}
+		attachments = append(attachments, EmailAttachment{
+			Filename: filepath.Base(file),
+			Content:  content,
+		})
+	}
+	return attachments, nil
 }
 
+// SendNotificationEmail emails the form's admin recipients a summary of a processed submission
+// and its action results. Nothing is sent unless the form enables email.admin, or when
+// only_on_failure is set and every action succeeded.
 func (es *EmailService) SendNotificationEmail(submission *models.FormSubmission, formConfig config.FormConfig, result *models.ProcessingResult) error {
-	// This can be used to send admin notifications
-	// Implementation would be similar to confirmation email
+	admin := formConfig.Email.Admin
+	if !formConfig.Email.Enabled || !admin.Enabled || len(admin.Recipients) == 0 {
+		return nil
+	}
+	if admin.OnlyOnFailure && result.Success {
+		return nil
+	}
+
+	templateName := admin.Template
+	if templateName == "" {
+		templateName = "admin-notification"
+	}
+
+	emailData := EmailData{
+		Subject:    es.adminNotificationSubject(submission, formConfig, result),
+		Submission: submission,
+		FormConfig: formConfig,
+		IsHTML:     true,
+		PublicURL:  es.config.Server.PublicURL,
+		Result:     result,
+	}
+	// Replies go straight to the person who submitted the form
+	if submitter := es.GetEmailFromSubmission(submission); submitter != "" {
+		if _, err := mail.ParseAddress(submitter); err == nil {
+			emailData.ReplyTo = submitter
+		}
+	}
+
+	if err := es.renderEmailTemplate(templateName, &emailData); err != nil {
+		return fmt.Errorf("failed to render admin notification template: %w", err)
+	}
+
+	// One message per recipient so a bad address doesn't stop the others
+	var failures []string
+	for _, recipient := range admin.Recipients {
+		emailData.To = recipient
+		if err := es.sendEmail(emailData); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", recipient, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to send admin notification to %s", strings.Join(failures, "; "))
+	}
 	return nil
 }
 
-func (es *EmailService) renderEmailTemplate(templateName string, data EmailData) (string, error) {
-	// Default templates
-	defaultTemplates := map[string]string{
-		"feedback-notification": `
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>New Feedback Received - PinePods</title>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-        .header { background-color: #FF6B6B; color: white; padding: 20px; text-align: center; }
-        .content { padding: 20px; background-color: #f9f9f9; }
-        .footer { padding: 20px; text-align: center; color: #666; }
-        .feedback-box { background-color: white; border: 2px solid #FF6B6B; padding: 20px; margin: 20px 0; border-radius: 8px; }
-        .meta-info { background-color: #E8F5E8; padding: 15px; border-left: 4px solid #4CAF50; margin: 20px 0; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>📝 New Feedback Received</h1>
-        </div>
-        <div class="content">
-            <div class="feedback-box">
-                <h2>Feedback Details:</h2>
-                <p><strong>📋 Feedback:</strong></p>
-                <div style="background-color: #f5f5f5; padding: 15px; border-radius: 4px; white-space: pre-wrap;">{{index .Submission.Data "feedback"}}</div>
-
-                {{if index .Submission.Data "email"}}
-                <p><strong>📧 Contact Email:</strong> {{index .Submission.Data "email"}}</p>
-                {{else}}
-                <p><strong>📧 Contact Email:</strong> <em>Anonymous submission</em></p>
-                {{end}}
-
-                {{if index .Submission.Data "platform"}}
-                <p><strong>🖥️ Platform:</strong> {{index .Submission.Data "platform"}}</p>
-                {{end}}
-
-                {{if index .Submission.Data "category"}}
-                <p><strong>🏷️ Category:</strong> {{index .Submission.Data "category"}}</p>
-                {{end}}
-
-                {{if index .Submission.Data "page"}}
-                <p><strong>📄 Page/Feature:</strong> {{index .Submission.Data "page"}}</p>
-                {{end}}
-            </div>
-
-            <div class="meta-info">
-                <h3>📊 Submission Information:</h3>
-                <p><strong>Submission ID:</strong> {{.Submission.ID}}</p>
-                <p><strong>Submitted:</strong> {{.Submission.SubmittedAt.Format "2006-01-02 15:04:05 UTC"}}</p>
-                <p><strong>IP Address:</strong> {{.Submission.IPAddress}}</p>
-                <p><strong>User Agent:</strong> {{.Submission.UserAgent}}</p>
-            </div>
-        </div>
-        <div class="footer">
-            <p>🎧 PinePods Feedback System</p>
-        </div>
-    </div>
-</body>
-</html>`,
-		"feedback-confirmation": `
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Thanks for your feedback!</title>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-        .header { background-color: #4CAF50; color: white; padding: 20px; text-align: center; }
-        .content { padding: 20px; background-color: #f9f9f9; }
-        .footer { padding: 20px; text-align: center; color: #666; }
-        .highlight { background-color: #E8F5E8; padding: 15px; border-left: 4px solid #4CAF50; margin: 20px 0; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>🙏 Thank You for Your Feedback!</h1>
-        </div>
-        <div class="content">
-            <p>Thank you for taking the time to share your feedback with us!</p>
-
-            <div class="highlight">
-                <p>Your feedback has been successfully received and will help us improve PinePods. We read every piece of feedback and use it to guide our development priorities.</p>
-            </div>
-
-            {{if index .Submission.Data "email"}}
-            <p>If your feedback requires a response, we'll get back to you at <strong>{{index .Submission.Data "email"}}</strong>.</p>
-            {{end}}
-
-            <p>Here's what you submitted:</p>
-            <div style="background-color: white; border: 1px solid #ddd; padding: 15px; margin: 15px 0; border-radius: 4px; white-space: pre-wrap;">{{index .Submission.Data "feedback"}}</div>
-
-            <p><strong>Submission ID:</strong> {{.Submission.ID}}</p>
-
-            <p>Want to share more feedback or report another issue? Feel free to submit another form anytime!</p>
-        </div>
-        <div class="footer">
-            <p>🎧 PinePods - Thank you for helping us improve!</p>
-        </div>
-    </div>
-</body>
-</html>`,
-		"confirmation": `
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>{{.Subject}}</title>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-        .header { background-color: #4CAF50; color: white; padding: 20px; text-align: center; }
-        .content { padding: 20px; background-color: #f9f9f9; }
-        .footer { padding: 20px; text-align: center; color: #666; }
-        .data-table { width: 100%; border-collapse: collapse; margin: 20px 0; }
-        .data-table th, .data-table td { border: 1px solid #ddd; padding: 8px; text-align: left; }
-        .data-table th { background-color: #f2f2f2; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>{{.FormConfig.Name}}</h1>
-            <p>Thank you for your submission!</p>
-        </div>
-        <div class="content">
-            <p>Dear {{index .Submission.Data "name"}},</p>
-            <p>We have successfully received your submission for {{.FormConfig.Name}}.</p>
-
-            <h3>Submission Details:</h3>
-            <table class="data-table">
-                {{range $key, $value := .Submission.Data}}
-                <tr>
-                    <th>{{$key}}</th>
-                    <td>{{$value}}</td>
-                </tr>
-                {{end}}
-            </table>
-
-            <p><strong>Submission ID:</strong> {{.Submission.ID}}</p>
-            <p><strong>Submitted at:</strong> {{.Submission.SubmittedAt.Format "2006-01-02 15:04:05 UTC"}}</p>
-
-            {{if .FormConfig.Description}}
-            <p>{{.FormConfig.Description}}</p>
-            {{end}}
-        </div>
-        <div class="footer">
-            <p>This is an automated message. Please do not reply to this email.</p>
-        </div>
-    </div>
-</body>
-</html>`,
-		"internal-testing": `
-<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <title>Welcome to PinePods Internal Testing</title>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-        .header { background-color: #2E7D32; color: white; padding: 20px; text-align: center; }
-        .content { padding: 20px; background-color: #f9f9f9; }
-        .footer { padding: 20px; text-align: center; color: #666; }
-        .highlight { background-color: #E8F5E8; padding: 15px; border-left: 4px solid #4CAF50; margin: 20px 0; }
-        .app-link { background-color: #4CAF50; color: white; padding: 15px; text-align: center; border-radius: 8px; margin: 20px 0; }
-        .app-link a { color: white; text-decoration: none; font-size: 18px; font-weight: bold; }
-        .links { background-color: #E3F2FD; padding: 15px; border-left: 4px solid #2196F3; margin: 20px 0; }
-        .links a { color: #1976D2; text-decoration: none; font-weight: bold; }
-        .links a:hover { text-decoration: underline; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>🎉 Welcome to PinePods Internal Testing!</h1>
-        </div>
-        <div class="content">
-            <p>Hi {{index .Submission.Data "name"}},</p>
-
-            <p><strong>Congratulations! You've been added to PinePods internal testing.</strong> This email is your invitation to access the beta version of PinePods.</p>
-
-            {{if eq (index .Submission.Data "platform") "ios"}}
-            <div class="app-link" style="background-color: #007AFF;">
-                <a href="https://testflight.apple.com/join/8Aax2BcX" target="_blank" style="color: white; text-decoration: none; display: block;">
-                    <p style="color: white; margin: 0; font-size: 18px; font-weight: bold;">
-                        🍎 Join PinePods iOS TestFlight Beta!
-                    </p>
-                    <p style="color: white; margin: 8px 0 0 0; font-size: 14px;">
-                        Click here to install PinePods Beta via TestFlight
-                    </p>
-                </a>
-            </div>
-            {{else}}
-            <div class="app-link">
-                <a href="https://play.google.com/apps/testing/com.gooseberrydevelopment.pinepods" target="_blank">
-                    📱 Download PinePods Beta from Google Play
-                </a>
-            </div>
-            {{end}}
-
-            <div class="highlight">
-                <h3>🚀 What you get with internal testing:</h3>
-                <ul>
-                    <li><strong>Early Access:</strong> Latest features before public release</li>
-                    <li><strong>Direct Feedback Channel:</strong> Your input shapes development</li>
-                    <li><strong>Beta Versions:</strong> Test cutting-edge functionality</li>
-                    <li><strong>Community Access:</strong> Connect with other testers and developers</li>
-                </ul>
-            </div>
-
-            <div class="links">
-                <h3>🔗 Important Links:</h3>
-                <ul>
-                    <li><strong>Discord Community:</strong> <a href="https://discord.com/invite/bKzHRa4GNc" target="_blank">Join our Discord server</a> for real-time chat, support, and direct communication with the dev team</li>
-                    <li><strong>Report Issues:</strong> Found a bug or have feedback? <a href="https://github.com/madeofpendletonwool/PinePods/issues" target="_blank">Submit an issue on GitHub</a></li>
-                </ul>
-            </div>
-
-            <h3>📋 How to Report Mobile App Issues:</h3>
-            <ol>
-                <li>Visit our <a href="https://github.com/madeofpendletonwool/PinePods/issues" target="_blank">GitHub Issues page</a></li>
-                <li>Click "New issue" and select the appropriate template</li>
-                <li><strong>Include "[MOBILE]" in your issue title</strong> to help us identify mobile-specific problems</li>
-                <li>Provide details about:
-                    <ul>
-                        <li>Your device model and Android version</li>
-                        <li>PinePods version number (found in app settings)</li>
-                        <li>Steps to reproduce the issue</li>
-                        <li>Screenshots if applicable</li>
-                    </ul>
-                </li>
-            </ol>
-
-            <h3>⚠️ Important Notes:</h3>
-            <ul>
-                {{if eq (index .Submission.Data "platform") "ios"}}
-                <li>You must use the email <strong>{{index .Submission.Data "email"}}</strong> to access TestFlight (this should be your Apple ID email)</li>
-                <li>We'll send you the TestFlight invitation as soon as iOS testing is ready</li>
-                {{else}}
-                <li>You must use the email <strong>{{index .Submission.Data "email"}}</strong> to access the beta through Google Play</li>
-                {{end}}
-                <li>Beta versions may contain bugs - that's why we need your feedback!</li>
-                <li>Updates are frequent, so check for new versions regularly</li>
-                <li>Join our Discord for announcements about new beta releases</li>
-            </ul>
-
-            <p>Thank you for helping us make PinePods better! Your feedback and testing are invaluable to our development process.</p>
-
-            <p>Happy podcasting!</p>
-
-            <p>Best regards,<br>The PinePods Development Team</p>
-        </div>
-        <div class="footer">
-            <p>🎧 PinePods - Your Personal Podcast Experience</p>
-            <p><a href="https://discord.com/invite/bKzHRa4GNc">Discord</a> • <a href="https://github.com/madeofpendletonwool/PinePods">GitHub</a> • <a href="https://docs.pinepods.online">Documentation</a></p>
-        </div>
-    </div>
-</body>
-</html>`,
-	}
-
-	// Use default template if no custom template specified or found
-	var templateContent string
+// adminNotificationSubject renders the form's email.admin.subject template, falling back to a
+// subject naming the form and the outcome when it is unset or fails to render
+func (es *EmailService) adminNotificationSubject(submission *models.FormSubmission, formConfig config.FormConfig, result *models.ProcessingResult) string {
+	data := newNotificationTemplateData(submission, formConfig, result, es.config.Server.PublicURL)
+
+	subject := fmt.Sprintf("New %s submission (%s)", data.FormName, data.ShortID)
+	if !result.Success {
+		subject = fmt.Sprintf("Processing failed: %s submission (%s)", data.FormName, data.ShortID)
+	}
+
+	if text := formConfig.Email.Admin.Subject; text != "" {
+		tmpl, err := parseActionTemplate(text)
+		if err == nil {
+			var buf bytes.Buffer
+			if err = tmpl.Execute(&buf, data); err == nil {
+				// Submitted values may contain line breaks, which have no place in a header
+				return strings.Join(strings.Fields(buf.String()), " ")
+			}
+		}
+		log.Printf("[EMAIL] Failed to render admin email subject for form %s: %v", submission.FormID, err)
+	}
+	return subject
+}
+
+// renderEmailTemplate renders the named template into data's Body and TextBody. A form's own
+// templates in forms/<form id>/ take precedence over the templates directory, which takes
+// precedence over the built-in templates.
+func (es *EmailService) renderEmailTemplate(templateName string, data *EmailData) error {
 	if templateName == "" {
-		templateContent = defaultTemplates["confirmation"]
-	} else if tmpl, exists := defaultTemplates[templateName]; exists {
-		templateContent = tmpl
-	} else {
-		templateContent = defaultTemplates["confirmation"]
+		templateName = "confirmation"
 	}
+	data.Template = templateName
+	data.GoogleGroup = es.config.GooglePlay.GoogleGroup
+	data.GoogleGroupURL = googleGroupURL(data.GoogleGroup)
 
-	// Parse and execute template
-	tmpl, err := template.New("email").Parse(templateContent)
+	set, err := emailTemplatesFor(es.config.Email.TemplatesDir).current()
 	if err != nil {
-		return "", fmt.Errorf("failed to parse email template: %w", err)
+		return fmt.Errorf("failed to load email templates: %w", err)
 	}
 
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return "", fmt.Errorf("failed to execute email template: %w", err)
+	names := []string{templateName}
+	if data.Submission != nil {
+		names = append([]string{"forms/" + data.Submission.FormID + "/" + templateName}, names...)
+	}
+	for _, name := range names {
+		html, text := set.html[name], set.text[name]
+		if html != nil || text != nil {
+			return executeEmailTemplates(name, html, text, data)
+		}
 	}
 
-	return buf.String(), nil
+	builtin := builtinEmailTemplates()
+	if html, text := builtin.html[templateName], builtin.text[templateName]; html != nil || text != nil {
+		return executeEmailTemplates(templateName, html, text, data)
+	}
+	return fmt.Errorf("%w '%s'", ErrUnknownEmailTemplate, templateName)
 }
 
+// sendEmail completes emailData's defaults and queues it in the email outbox
 func (es *EmailService) sendEmail(emailData EmailData) error {
+	es.completeEmail(&emailData)
+	_, err := es.enqueue(emailData)
+	return err
+}
+
+// completeEmail fills in the Reply-To address and plain text version the email is sent with
+func (es *EmailService) completeEmail(emailData *EmailData) {
+	if emailData.ReplyTo == "" {
+		emailData.ReplyTo = emailData.FormConfig.Email.ReplyTo
+	}
+	if emailData.ReplyTo == "" {
+		emailData.ReplyTo = es.config.Email.ReplyTo
+	}
+	if emailData.IsHTML && emailData.TextBody == "" {
+		emailData.TextBody = htmlToText(emailData.Body)
+	}
+}
+
+// deliver sends an email through the configured provider
+func (es *EmailService) deliver(emailData EmailData) error {
 	switch es.config.Email.Provider {
 	case "smtp":
 		return es.sendSMTPEmail(emailData)
@@ -374,58 +333,238 @@ func (es *EmailService) sendEmail(emailData EmailData) error {
 	}
 }
 
+// senderAddress is the bare address emails are sent from, or "" when none is configured
+func (es *EmailService) senderAddress() string {
+	from := es.config.Email.SMTP.From
+	if es.config.Email.Provider == "sendgrid" {
+		from = es.config.Email.SendGrid.From
+	}
+	if parsed, err := mail.ParseAddress(from); err == nil {
+		return parsed.Address
+	}
+	return from
+}
+
 func (es *EmailService) sendSMTPEmail(emailData EmailData) error {
-	// Email headers and body
-	var contentType string
+	if es.config.Email.SMTP.From == "" {
+		return fmt.Errorf("SMTP from address not configured (set SMTP_FROM)")
+	}
+	from, err := mail.ParseAddress(es.config.Email.SMTP.From)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP from address '%s': %w", es.config.Email.SMTP.From, err)
+	}
+	to, err := mail.ParseAddress(emailData.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address '%s': %w", emailData.To, err)
+	}
+
+	msg := emailMessage{
+		From:            from,
+		To:              to,
+		Subject:         emailData.Subject,
+		MessageID:       emailData.MessageID,
+		ListUnsubscribe: emailData.ListUnsubscribe,
+		Text:            emailData.TextBody,
+		Attachments:     emailData.Attachments,
+	}
 	if emailData.IsHTML {
-		contentType = "text/html; charset=UTF-8"
+		msg.HTML = emailData.Body
 	} else {
-		contentType = "text/plain; charset=UTF-8"
-	}
-
-	message := fmt.Sprintf(`To: %s
-From: %s
-Subject: %s
-MIME-Version: 1.0
-Content-Type: %s
-
-%s`,
-		emailData.To,
-		es.config.Email.SMTP.From,
-		emailData.Subject,
-		contentType,
-		emailData.Body,
-	)
-
-	// Send email
-	addr := fmt.Sprintf("%s:%d", es.config.Email.SMTP.Host, es.config.Email.SMTP.Port)
-
-	// Check if we need authentication (for production SMTP servers)
-	var auth smtp.Auth
-	if es.config.Email.SMTP.Username != "" && es.config.Email.SMTP.Password != "" {
-		auth = smtp.PlainAuth("",
-			es.config.Email.SMTP.Username,
-			es.config.Email.SMTP.Password,
-			es.config.Email.SMTP.Host,
-		)
-	}
-	// For MailHog and other test servers, auth can be nil
-
-	err := smtp.SendMail(addr, auth, es.config.Email.SMTP.From, []string{emailData.To}, []byte(message))
+		msg.Text = emailData.Body
+	}
+	if emailData.ReplyTo != "" {
+		if msg.ReplyTo, err = mail.ParseAddress(emailData.ReplyTo); err != nil {
+			return fmt.Errorf("invalid reply-to address '%s': %w", emailData.ReplyTo, err)
+		}
+	}
+
+	message, err := buildEmailMessage(msg, time.Now())
 	if err != nil {
+		return fmt.Errorf("failed to build email message: %w", err)
+	}
+
+	// Send email over a pooled connection
+	if err := smtpPoolFor(es.config.Email.SMTP).send(from.Address, []string{to.Address}, message); err != nil {
 		return fmt.Errorf("failed to send SMTP email: %w", err)
 	}
 
 	return nil
 }
 
+// sendGridRequest is the body of a SendGrid v3 mail/send request
+type sendGridRequest struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	ReplyTo          *sendGridAddress          `json:"reply_to,omitempty"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"` // Base64 encoded
+	Type        string `json:"type,omitempty"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition"`
+}
+
+// sendGridAddressOf splits an address such as "PinePods <forms@example.com>" into its parts
+func sendGridAddressOf(address string) sendGridAddress {
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		return sendGridAddress{Email: parsed.Address, Name: parsed.Name}
+	}
+	return sendGridAddress{Email: address}
+}
+
+// sendGridErrorResponse is the error body returned by the SendGrid v3 API
+type sendGridErrorResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+		Field   string `json:"field"`
+	} `json:"errors"`
+}
+
 func (es *EmailService) sendSendGridEmail(emailData EmailData) error {
-	// SendGrid implementation would go here
-	// For now, just return an error indicating it's not implemented
-	return fmt.Errorf("SendGrid email provider not yet implemented")
+	sgConfig := es.config.Email.SendGrid
+	if sgConfig.APIKey == "" {
+		return fmt.Errorf("SendGrid API key not configured (set SENDGRID_API_KEY)")
+	}
+	if sgConfig.From == "" {
+		return fmt.Errorf("SendGrid from address not configured (set SENDGRID_FROM)")
+	}
+
+	contentType := "text/plain"
+	if emailData.IsHTML {
+		contentType = "text/html"
+	}
+
+	// SendGrid requires the plain text version to come first
+	var content []sendGridContent
+	if emailData.IsHTML && emailData.TextBody != "" {
+		content = append(content, sendGridContent{Type: "text/plain", Value: emailData.TextBody})
+	}
+	content = append(content, sendGridContent{Type: contentType, Value: emailData.Body})
+
+	payload := sendGridRequest{
+		Personalizations: []sendGridPersonalization{
+			{To: []sendGridAddress{{Email: emailData.To}}},
+		},
+		From:    sendGridAddressOf(sgConfig.From),
+		Subject: emailData.Subject,
+		Content: content,
+	}
+	if emailData.ReplyTo != "" {
+		replyTo := sendGridAddressOf(emailData.ReplyTo)
+		payload.ReplyTo = &replyTo
+	}
+	headers := make(map[string]string)
+	if emailData.MessageID != "" {
+		headers["Message-ID"] = emailData.MessageID
+	}
+	for _, header := range listUnsubscribeHeaders(emailData.ListUnsubscribe) {
+		headers[header[0]] = header[1]
+	}
+	if len(headers) > 0 {
+		payload.Headers = headers
+	}
+	for _, attachment := range emailData.Attachments {
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = mime.TypeByExtension(filepath.Ext(attachment.Filename))
+		}
+		payload.Attachments = append(payload.Attachments, sendGridAttachment{
+			Content:     base64.StdEncoding.EncodeToString(attachment.Content),
+			Type:        contentType,
+			Filename:    attachment.Filename,
+			Disposition: "attachment",
+		})
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal SendGrid request: %w", err)
+	}
+
+	url := strings.TrimRight(sgConfig.BaseURL, "/") + "/v3/mail/send"
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create SendGrid request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+sgConfig.APIKey)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach SendGrid: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// SendGrid answers 202 Accepted when the message has been queued for delivery
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	return sendGridError(resp)
+}
+
+// sendGridError converts a failed SendGrid response into a descriptive error
+func sendGridError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var reason string
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		reason = "invalid or missing API key"
+	case http.StatusForbidden:
+		reason = "API key lacks mail send permission or the sender is not verified"
+	case http.StatusRequestEntityTooLarge:
+		reason = "message too large"
+	case http.StatusTooManyRequests:
+		reason = "rate limit exceeded"
+	default:
+		if resp.StatusCode >= 500 {
+			reason = "SendGrid service error"
+		} else {
+			reason = "request rejected"
+		}
+	}
+
+	var errResp sendGridErrorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && len(errResp.Errors) > 0 {
+		var details []string
+		for _, e := range errResp.Errors {
+			if e.Field != "" {
+				details = append(details, fmt.Sprintf("%s (field: %s)", e.Message, e.Field))
+			} else {
+				details = append(details, e.Message)
+			}
+		}
+		return fmt.Errorf("SendGrid returned status %d: %s: %s", resp.StatusCode, reason, strings.Join(details, "; "))
+	}
+
+	return fmt.Errorf("SendGrid returned status %d: %s", resp.StatusCode, reason)
 }
 
-func (es *EmailService) SendTestEmail(to string) error {
+// SendTestEmail queues a short plain text email to check the provider settings, returning the id
+// of the queued email
+func (es *EmailService) SendTestEmail(to string) (string, error) {
 	emailData := EmailData{
 		To:      to,
 		Subject: "PinePods Forms - Test Email",
@@ -433,7 +572,8 @@ func (es *EmailService) SendTestEmail(to string) error {
 		IsHTML:  false,
 	}
 
-	return es.sendEmail(emailData)
+	es.completeEmail(&emailData)
+	return es.enqueue(emailData)
 }
 
 // GetEmailFromSubmission extracts email address from submission data
@@ -454,20 +594,18 @@ func (es *EmailService) GetEmailFromSubmission(submission *models.FormSubmission
 
 // SendWelcomeEmail sends a welcome email for internal testing after manual approval
 func (es *EmailService) SendWelcomeEmail(submission *models.FormSubmission, formConfig config.FormConfig, email string) error {
-	// Use the internal-testing email template
-	body, err := es.renderEmailTemplate("internal-testing", EmailData{
+	emailData := EmailData{
+		To:         email,
+		Subject:    welcomeEmailSubject,
 		Submission: submission,
 		FormConfig: formConfig,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to render welcome email template: %w", err)
+		IsHTML:     true,
+		PublicURL:  es.config.Server.PublicURL,
 	}
 
-	emailData := EmailData{
-		To:      email,
-		Subject: "🎉 Welcome to PinePods Internal Testing - You're In!",
-		Body:    body,
-		IsHTML:  true,
+	// Use the internal-testing email template
+	if err := es.renderEmailTemplate(welcomeEmailTemplate, &emailData); err != nil {
+		return fmt.Errorf("failed to render welcome email template: %w", err)
 	}
 
 	return es.sendEmail(emailData)
@@ -475,19 +613,27 @@ func (es *EmailService) SendWelcomeEmail(submission *models.FormSubmission, form
 
 // SendFeedbackNotification sends feedback notification email to the admin
 func (es *EmailService) SendFeedbackNotification(submission *models.FormSubmission, recipientEmail string) error {
+	_, err := es.queueFeedbackNotification(submission, recipientEmail, "")
+	return err
+}
+
+// queueFeedbackNotification is SendFeedbackNotification for the action job jobID, returning the
+// id of the queued email
+func (es *EmailService) queueFeedbackNotification(submission *models.FormSubmission, recipientEmail, jobID string) (string, error) {
 	emailData := EmailData{
 		To:         recipientEmail,
-		Subject:    "New Feedback Received - PinePods",
+		Subject:    feedbackEmailSubject,
 		Submission: submission,
 		IsHTML:     true,
+		PublicURL:  es.config.Server.PublicURL,
+		JobID:      jobID,
 	}
 
 	// Generate email body from template
-	body, err := es.renderEmailTemplate("feedback-notification", emailData)
-	if err != nil {
-		return fmt.Errorf("failed to render feedback notification template: %w", err)
+	if err := es.renderEmailTemplate("feedback-notification", &emailData); err != nil {
+		return "", fmt.Errorf("failed to render feedback notification template: %w", err)
 	}
-	emailData.Body = body
 
-	return es.sendEmail(emailData)
+	es.completeEmail(&emailData)
+	return es.enqueue(emailData)
 }
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// newEmailTestService returns an EmailService with its outbox in an in-memory SQLite database.
+// The outbox worker isn't started, so queued emails stay pending.
+func newEmailTestService(t *testing.T, cfg *config.Config) *EmailService {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	cfg.Database.Type = "sqlite"
+	if cfg.Email.Provider == "" {
+		cfg.Email.Provider = "smtp"
+		cfg.Email.SMTP.From = "forms@example.com"
+	}
+
+	service, err := NewEmailService(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+func TestSendWelcomeEmail(t *testing.T) {
+	es := newEmailTestService(t, nil)
+	submission := &models.FormSubmission{ID: "sub-1", FormID: "internal-testing", Data: map[string]interface{}{"email": "tester@example.com"}}
+
+	if err := es.SendWelcomeEmail(submission, config.FormConfig{}, "tester@example.com"); err != nil {
+		t.Fatalf("SendWelcomeEmail failed: %v", err)
+	}
+
+	emails, err := es.GetSubmissionEmails("sub-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(emails) != 1 {
+		t.Fatalf("queued %d emails, want 1", len(emails))
+	}
+
+	delivery, err := es.GetEmailDelivery(emails[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Template != welcomeEmailTemplate {
+		t.Errorf("template = %q, want %q", delivery.Template, welcomeEmailTemplate)
+	}
+	// The welcome template is HTML, sent with a plain text version alongside it
+	if !strings.Contains(delivery.HTMLBody, "<") {
+		t.Errorf("html_body = %q, want the rendered HTML template", delivery.HTMLBody)
+	}
+	if delivery.TextBody == "" || strings.Contains(delivery.TextBody, "</") {
+		t.Errorf("text_body = %q, want a plain text version", delivery.TextBody)
+	}
+}
+
+// newSendGridTestService returns an EmailService sending through a stub SendGrid API that answers
+// with status and body, and records the last request it received
+func newSendGridTestService(t *testing.T, status int, body string) (*EmailService, *http.Request, *sendGridRequest) {
+	t.Helper()
+
+	var got http.Request
+	var payload sendGridRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = *r
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("request body isn't a SendGrid request: %v", err)
+		}
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{}
+	cfg.Email.Provider = "sendgrid"
+	cfg.Email.SendGrid.APIKey = "SG.test"
+	cfg.Email.SendGrid.From = "PinePods Forms <forms@example.com>"
+	cfg.Email.SendGrid.BaseURL = server.URL + "/"
+	return newEmailTestService(t, cfg), &got, &payload
+}
+
+func TestSendSendGridEmail(t *testing.T) {
+	es, got, payload := newSendGridTestService(t, http.StatusAccepted, "")
+
+	err := es.deliver(EmailData{
+		To:              "tester@example.com",
+		Subject:         "Thanks",
+		Body:            "<p>Thanks</p>",
+		TextBody:        "Thanks",
+		IsHTML:          true,
+		ReplyTo:         "Support <support@example.com>",
+		MessageID:       "<id-1@example.com>",
+		ListUnsubscribe: "mailto:unsubscribe@example.com",
+		Attachments:     []EmailAttachment{{Filename: "guide.pdf", Content: []byte("%PDF")}},
+	})
+	if err != nil {
+		t.Fatalf("deliver failed: %v", err)
+	}
+
+	if got.URL.Path != "/v3/mail/send" {
+		t.Errorf("path = %q, want /v3/mail/send", got.URL.Path)
+	}
+	if auth := got.Header.Get("Authorization"); auth != "Bearer SG.test" {
+		t.Errorf("Authorization = %q, want the API key", auth)
+	}
+	if payload.From != (sendGridAddress{Email: "forms@example.com", Name: "PinePods Forms"}) {
+		t.Errorf("from = %+v, want the configured sender split into its parts", payload.From)
+	}
+	if payload.ReplyTo == nil || payload.ReplyTo.Email != "support@example.com" {
+		t.Errorf("reply_to = %+v, want support@example.com", payload.ReplyTo)
+	}
+	if len(payload.Personalizations) != 1 || len(payload.Personalizations[0].To) != 1 || payload.Personalizations[0].To[0].Email != "tester@example.com" {
+		t.Errorf("personalizations = %+v, want the recipient", payload.Personalizations)
+	}
+	// SendGrid rejects requests where the plain text version doesn't come first
+	if len(payload.Content) != 2 || payload.Content[0].Type != "text/plain" || payload.Content[1].Type != "text/html" {
+		t.Errorf("content = %+v, want text/plain then text/html", payload.Content)
+	}
+	if payload.Headers["Message-ID"] != "<id-1@example.com>" || payload.Headers["List-Unsubscribe"] == "" {
+		t.Errorf("headers = %v, want Message-ID and List-Unsubscribe", payload.Headers)
+	}
+	if len(payload.Attachments) != 1 || payload.Attachments[0].Type != "application/pdf" || payload.Attachments[0].Content != "JVBERg==" {
+		t.Errorf("attachments = %+v, want the base64 encoded PDF", payload.Attachments)
+	}
+}
+
+func TestSendSendGridEmailErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"bad key", http.StatusUnauthorized, "", "status 401: invalid or missing API key"},
+		{"unverified sender", http.StatusForbidden, `{"errors":[{"message":"The from address does not match a verified Sender Identity","field":"from"}]}`, "not verified: The from address does not match a verified Sender Identity (field: from)"},
+		{"rate limited", http.StatusTooManyRequests, "", "rate limit exceeded"},
+		{"outage", http.StatusServiceUnavailable, "<html>down</html>", "status 503: SendGrid service error"},
+		{"rejected", http.StatusBadRequest, `{"errors":[{"message":"Invalid email"},{"message":"Missing subject","field":"subject"}]}`, "request rejected: Invalid email; Missing subject (field: subject)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			es, _, _ := newSendGridTestService(t, tt.status, tt.body)
+
+			err := es.deliver(EmailData{To: "tester@example.com", Subject: "Thanks", Body: "Thanks"})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("deliver error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			// Only SMTP rejections of the recipient are permanent, SendGrid failures are retried
+			if permanentEmailError(err) {
+				t.Errorf("permanentEmailError(%v) = true, want the email retried", err)
+			}
+		})
+	}
+}
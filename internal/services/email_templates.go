@@ -0,0 +1,275 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+)
+
+// emailTemplateCheckInterval is how often the templates directory is checked for changes
+const emailTemplateCheckInterval = 2 * time.Second
+
+// ErrUnknownEmailTemplate is returned when neither the templates directory nor the built-in
+// templates have the requested template
+var ErrUnknownEmailTemplate = errors.New("unknown email template")
+
+// emailTemplateSet is one parse of the templates directory. Pages are keyed by their path
+// relative to the directory without the extension, e.g. "confirmation" or
+// "forms/contact-form/confirmation". Each page is parsed into its own copy of the shared layouts
+// and partials, so every page can define its own "content" block.
+type emailTemplateSet struct {
+	html map[string]*htmltemplate.Template
+	text map[string]*texttemplate.Template
+}
+
+// emailTemplateStore caches the parsed templates directory and parses it again when a file is
+// added, removed or modified
+type emailTemplateStore struct {
+	dir string
+
+	mu      sync.Mutex
+	set     *emailTemplateSet
+	files   map[string]time.Time // Modification time of every template file when last scanned
+	checked time.Time
+}
+
+var (
+	emailTemplateStoresMu sync.Mutex
+	emailTemplateStores   = make(map[string]*emailTemplateStore)
+)
+
+// emailTemplatesFor returns the store for dir. Stores are shared so every EmailService uses the
+// same cache.
+func emailTemplatesFor(dir string) *emailTemplateStore {
+	emailTemplateStoresMu.Lock()
+	defer emailTemplateStoresMu.Unlock()
+
+	store, exists := emailTemplateStores[dir]
+	if !exists {
+		store = &emailTemplateStore{dir: dir}
+		emailTemplateStores[dir] = store
+	}
+	return store
+}
+
+// current returns the parsed templates, parsing them again if the directory changed since the
+// last check. If a reload fails, the error is logged and the previous templates stay in use
+// until the files change again.
+func (s *emailTemplateStore) current() (*emailTemplateSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.set != nil && now.Sub(s.checked) < emailTemplateCheckInterval {
+		return s.set, nil
+	}
+	s.checked = now
+
+	files, err := scanEmailTemplates(s.dir)
+	if err != nil {
+		if s.set != nil {
+			log.Printf("[EMAIL] Failed to check email templates in %s: %v", s.dir, err)
+			return s.set, nil
+		}
+		return nil, err
+	}
+	if s.set != nil && sameTemplateFiles(files, s.files) {
+		return s.set, nil
+	}
+
+	set, err := parseEmailTemplates(os.DirFS(s.dir), files)
+	if err != nil {
+		if s.set != nil {
+			log.Printf("[EMAIL] Failed to reload email templates, keeping the previous ones: %v", err)
+			s.files = files
+			return s.set, nil
+		}
+		return nil, err
+	}
+	if s.set != nil {
+		log.Printf("[EMAIL] Reloaded email templates from %s", s.dir)
+	}
+	s.set, s.files = set, files
+	return set, nil
+}
+
+// scanEmailTemplates lists the .html and .txt files under dir with their modification times. A
+// missing directory has no templates.
+func scanEmailTemplates(dir string) (map[string]time.Time, error) {
+	if dir == "" {
+		return make(map[string]time.Time), nil
+	}
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return make(map[string]time.Time), nil
+	}
+
+	files, err := listEmailTemplates(os.DirFS(dir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan email templates: %w", err)
+	}
+	return files, nil
+}
+
+// listEmailTemplates lists the .html and .txt files in fsys with their modification times
+func listEmailTemplates(fsys fs.FS) (map[string]time.Time, error) {
+	files := make(map[string]time.Time)
+	err := fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if ext := path.Ext(name); ext != ".html" && ext != ".txt" {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files[name] = info.ModTime()
+		return nil
+	})
+	return files, err
+}
+
+func sameTemplateFiles(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for file, modified := range a {
+		if other, exists := b[file]; !exists || !other.Equal(modified) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseEmailTemplates parses the files in fsys found by listEmailTemplates. Files under layouts/
+// and partials/ are shared by every page; every other file is a page.
+func parseEmailTemplates(fsys fs.FS, files map[string]time.Time) (*emailTemplateSet, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	htmlBase := htmltemplate.New("").Funcs(htmltemplate.FuncMap(actionTemplateFuncs))
+	textBase := texttemplate.New("").Funcs(actionTemplateFuncs)
+	var pages []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, "layouts/") && !strings.HasPrefix(name, "partials/") {
+			pages = append(pages, name)
+			continue
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email template %s: %w", name, err)
+		}
+		if path.Ext(name) == ".html" {
+			_, err = htmlBase.New(name).Parse(string(content))
+		} else {
+			_, err = textBase.New(name).Parse(string(content))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s: %w", name, err)
+		}
+	}
+
+	set := &emailTemplateSet{
+		html: make(map[string]*htmltemplate.Template),
+		text: make(map[string]*texttemplate.Template),
+	}
+	for _, name := range pages {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email template %s: %w", name, err)
+		}
+		page := strings.TrimSuffix(name, path.Ext(name))
+		if path.Ext(name) == ".html" {
+			tmpl, err := htmlBase.Clone()
+			if err == nil {
+				_, err = tmpl.New(page).Parse(string(content))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse email template %s: %w", name, err)
+			}
+			set.html[page] = tmpl
+		} else {
+			tmpl, err := textBase.Clone()
+			if err == nil {
+				_, err = tmpl.New(page).Parse(string(content))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse email template %s: %w", name, err)
+			}
+			set.text[page] = tmpl
+		}
+	}
+	return set, nil
+}
+
+// builtinEmailTemplateFiles are used when the templates directory has no template of the same
+// name. They are laid out like the templates directory, with their own layouts and partials.
+//
+//go:embed email_templates
+var builtinEmailTemplateFiles embed.FS
+
+var (
+	builtinEmailTemplatesOnce sync.Once
+	builtinEmailTemplateSet   *emailTemplateSet
+)
+
+// builtinEmailTemplates returns the parsed built-in templates. They are part of the binary, so
+// failing to parse them is a bug and panics.
+func builtinEmailTemplates() *emailTemplateSet {
+	builtinEmailTemplatesOnce.Do(func() {
+		fsys, err := fs.Sub(builtinEmailTemplateFiles, "email_templates")
+		if err != nil {
+			panic(err)
+		}
+		files, err := listEmailTemplates(fsys)
+		if err == nil {
+			builtinEmailTemplateSet, err = parseEmailTemplates(fsys, files)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("built-in email templates: %v", err))
+		}
+	})
+	return builtinEmailTemplateSet
+}
+
+// executeEmailTemplates renders a page's HTML and plain text versions into data. A page with
+// only a text version is sent as plain text.
+func executeEmailTemplates(name string, html *htmltemplate.Template, text *texttemplate.Template, data *EmailData) error {
+	data.Body, data.TextBody = "", ""
+	if text != nil {
+		var buf bytes.Buffer
+		if err := text.ExecuteTemplate(&buf, name, data); err != nil {
+			return fmt.Errorf("failed to execute email template %s.txt: %w", name, err)
+		}
+		data.TextBody = buf.String()
+	}
+	if html == nil {
+		data.Body, data.IsHTML = data.TextBody, false
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := html.ExecuteTemplate(&buf, name, data); err != nil {
+		return fmt.Errorf("failed to execute email template %s: %w", name, err)
+	}
+	data.Body, data.IsHTML = buf.String(), true
+	return nil
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// Config keys whose values are replaced before an action config is stored in the history
+var sensitiveConfigKeys = []string{"secret", "password", "token", "api_key", "authorization"}
+
+func (fs *FormService) createExecutionsTable() error {
+	var createTableSQL string
+
+	switch fs.config.Database.Type {
+	case "sqlite":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS action_executions (
+			id TEXT PRIMARY KEY,
+			submission_id TEXT NOT NULL,
+			job_id TEXT,
+			stage TEXT NOT NULL DEFAULT 'submission',
+			action_index INTEGER NOT NULL,
+			action_type TEXT NOT NULL,
+			config TEXT,
+			success BOOLEAN NOT NULL,
+			message TEXT,
+			error TEXT,
+			duration_ms INTEGER NOT NULL,
+			attempt INTEGER NOT NULL,
+			executed_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_action_executions_submission_id ON action_executions(submission_id);
+		`
+	case "postgres":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS action_executions (
+			id TEXT PRIMARY KEY,
+			submission_id TEXT NOT NULL,
+			job_id TEXT,
+			stage TEXT NOT NULL DEFAULT 'submission',
+			action_index INTEGER NOT NULL,
+			action_type TEXT NOT NULL,
+			config JSONB,
+			success BOOLEAN NOT NULL,
+			message TEXT,
+			error TEXT,
+			duration_ms BIGINT NOT NULL,
+			attempt INTEGER NOT NULL,
+			executed_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_action_executions_submission_id ON action_executions(submission_id);
+		`
+	}
+
+	if _, err := fs.db.Exec(createTableSQL); err != nil {
+		return err
+	}
+	return addMissingColumns(fs.db, fs.config.Database.Type, executionColumnMigrations)
+}
+
+// executionColumnMigrations lists action_executions columns added after the table was introduced
+var executionColumnMigrations = []tableColumn{
+	{"action_executions", "stage", "TEXT NOT NULL DEFAULT 'submission'", "TEXT NOT NULL DEFAULT 'submission'"},
+}
+
+// recordExecution stores an action execution. Failures are logged rather than returned so a
+// history problem never changes the outcome of the action itself.
+func (fs *FormService) recordExecution(execution *models.ActionExecution) {
+	if execution.ID == "" {
+		execution.ID = uuid.New().String()
+	}
+	if execution.Stage == "" {
+		execution.Stage = models.ActionStageSubmission
+	}
+
+	var configJSON interface{}
+	if execution.Config != nil {
+		data, err := json.Marshal(execution.Config)
+		if err != nil {
+			log.Printf("[ACTIONS] Failed to marshal config snapshot for %s: %v", execution.ActionType, err)
+		} else {
+			configJSON = string(data)
+		}
+	}
+
+	var jobID interface{}
+	if execution.JobID != "" {
+		jobID = execution.JobID
+	}
+
+	query := `
+		INSERT INTO action_executions (id, submission_id, job_id, stage, action_index, action_type, config, success, message, error, duration_ms, attempt, executed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	if fs.config.Database.Type == "postgres" {
+		query = `
+			INSERT INTO action_executions (id, submission_id, job_id, stage, action_index, action_type, config, success, message, error, duration_ms, attempt, executed_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		`
+	}
+
+	_, err := fs.db.Exec(query,
+		execution.ID,
+		execution.SubmissionID,
+		jobID,
+		execution.Stage,
+		execution.ActionIndex,
+		execution.ActionType,
+		configJSON,
+		execution.Success,
+		execution.Message,
+		execution.Error,
+		execution.DurationMs,
+		execution.Attempt,
+		execution.ExecutedAt,
+	)
+	if err != nil {
+		log.Printf("[ACTIONS] Failed to record %s execution for submission %s: %v", execution.ActionType, execution.SubmissionID, err)
+	}
+}
+
+// completeExecution updates the execution recorded for a job's current attempt once the email its
+// action queued was delivered or failed, so the history shows the delivery outcome
+func (fs *FormService) completeExecution(job *models.ActionJob, success bool) {
+	query := `UPDATE action_executions SET success = ?, message = ?, error = ? WHERE job_id = ? AND attempt = ?`
+	if fs.config.Database.Type == "postgres" {
+		query = `UPDATE action_executions SET success = $1, message = $2, error = $3 WHERE job_id = $4 AND attempt = $5`
+	}
+
+	if _, err := fs.db.Exec(query, success, job.LastMessage, job.LastError, job.ID, job.Attempts); err != nil {
+		log.Printf("[ACTIONS] Failed to update %s execution for submission %s: %v", job.ActionType, job.SubmissionID, err)
+	}
+}
+
+// GetSubmissionExecutions returns every recorded action execution of a submission, oldest first
+func (fs *FormService) GetSubmissionExecutions(submissionID string) ([]models.ActionExecution, error) {
+	query := `
+		SELECT id, submission_id, job_id, stage, action_index, action_type, config, success, message, error, duration_ms, attempt, executed_at
+		FROM action_executions WHERE submission_id = ? ORDER BY executed_at, action_index
+	`
+	if fs.config.Database.Type == "postgres" {
+		query = `
+			SELECT id, submission_id, job_id, stage, action_index, action_type, config, success, message, error, duration_ms, attempt, executed_at
+			FROM action_executions WHERE submission_id = $1 ORDER BY executed_at, action_index
+		`
+	}
+
+	rows, err := fs.db.Query(query, submissionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	executions := []models.ActionExecution{}
+	for rows.Next() {
+		var execution models.ActionExecution
+		var jobID, configJSON, message, errorStr sql.NullString
+
+		err := rows.Scan(
+			&execution.ID,
+			&execution.SubmissionID,
+			&jobID,
+			&execution.Stage,
+			&execution.ActionIndex,
+			&execution.ActionType,
+			&configJSON,
+			&execution.Success,
+			&message,
+			&errorStr,
+			&execution.DurationMs,
+			&execution.Attempt,
+			&execution.ExecutedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if configJSON.Valid && configJSON.String != "" {
+			if err := json.Unmarshal([]byte(configJSON.String), &execution.Config); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal config snapshot: %w", err)
+			}
+		}
+
+		execution.JobID = jobID.String
+		execution.Message = message.String
+		execution.Error = errorStr.String
+		executions = append(executions, execution)
+	}
+
+	return executions, rows.Err()
+}
+
+func (fs *FormService) deleteSubmissionExecutions(submissionID string) error {
+	query := `DELETE FROM action_executions WHERE submission_id = ?`
+	if fs.config.Database.Type == "postgres" {
+		query = `DELETE FROM action_executions WHERE submission_id = $1`
+	}
+
+	_, err := fs.db.Exec(query, submissionID)
+	return err
+}
+
+// snapshotActionConfig copies an action's config for the history, masking secrets such as
+// webhook signing keys and auth headers
+func snapshotActionConfig(actionConfig config.ActionConfig) map[string]interface{} {
+	snapshot := redactConfig(actionConfig.Config)
+	if snapshot == nil {
+		snapshot = make(map[string]interface{})
+	}
+	return snapshot
+}
+
+func redactConfig(values map[string]interface{}) map[string]interface{} {
+	if values == nil {
+		return nil
+	}
+
+	redacted := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if isSensitiveConfigKey(key) {
+			redacted[key] = "[redacted]"
+			continue
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			redacted[key] = redactConfig(v)
+		case map[interface{}]interface{}:
+			converted := make(map[string]interface{}, len(v))
+			for k, item := range v {
+				converted[fmt.Sprintf("%v", k)] = item
+			}
+			redacted[key] = redactConfig(converted)
+		default:
+			redacted[key] = value
+		}
+	}
+	return redacted
+}
+
+func isSensitiveConfigKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveConfigKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,10 +3,13 @@ package services
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	_ "github.com/lib/pq"
@@ -15,9 +18,20 @@ import (
 	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
 )
 
+// ErrActionsPending is returned when a submission's actions can't be queued again because
+// jobs of the earlier run haven't finished
+var ErrActionsPending = errors.New("actions still pending")
+
+// ErrNotSpam is returned when releasing a submission that isn't held as spam
+var ErrNotSpam = errors.New("submission is not spam")
+
 type FormService struct {
-	config *config.Config
-	db     *sql.DB
+	config        *config.Config
+	db            *sql.DB
+	validators    map[string][]fieldValidator
+	actionService *ActionService
+	emailService  *EmailService
+	jobs          *JobQueue
 }
 
 func NewFormService(cfg *config.Config) *FormService {
@@ -25,10 +39,47 @@ func NewFormService(cfg *config.Config) *FormService {
 		config: cfg,
 	}
 	
+	validators, err := compileValidators(cfg.Forms.Forms)
+	if err != nil {
+		log.Fatalf("Failed to compile form validation rules: %v", err)
+	}
+	service.validators = validators
+	
+	if err := validateActions(cfg.Forms.Forms); err != nil {
+		log.Fatalf("Invalid action configuration: %v", err)
+	}
+	if err := compileConditions(cfg.Forms.Forms); err != nil {
+		log.Fatalf("Failed to compile action conditions: %v", err)
+	}
+	if err := compileActionTemplates(cfg.Forms.Forms); err != nil {
+		log.Fatalf("Failed to compile action config templates: %v", err)
+	}
+	
 	if err := service.initDatabase(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	
+	emailService, err := NewEmailService(cfg, service.db)
+	if err != nil {
+		log.Fatalf("Failed to initialize email outbox: %v", err)
+	}
+	service.emailService = emailService
+	service.actionService = NewActionService(cfg, service.db, emailService)
+	if err := service.actionService.googlePlay.createTables(); err != nil {
+		log.Fatalf("Failed to initialize Google Play tester table: %v", err)
+	}
+	service.jobs = NewJobQueue(cfg, service, service.actionService)
+	emailService.OnEmailFinished(service.welcomeEmailFinished)
+	if err := service.jobs.createTables(); err != nil {
+		log.Fatalf("Failed to initialize job queue tables: %v", err)
+	}
+	if err := service.createExecutionsTable(); err != nil {
+		log.Fatalf("Failed to initialize action history table: %v", err)
+	}
+	if err := service.createActionTokensTable(); err != nil {
+		log.Fatalf("Failed to initialize action token table: %v", err)
+	}
+	
 	return service
 }
 
@@ -40,6 +91,11 @@ func (fs *FormService) initDatabase() error {
 	case "sqlite":
 		connectionString = fs.config.Database.Database
 		fs.db, err = sql.Open("sqlite", connectionString)
+		if err == nil {
+			// SQLite allows a single writer; sharing one connection between the HTTP handlers
+			// and the job workers avoids "database is locked" errors
+			fs.db.SetMaxOpenConns(1)
+		}
 	case "postgres":
 		connectionString = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 			fs.config.Database.Host,
@@ -80,7 +136,11 @@ func (fs *FormService) createTables() error {
 			submitted_at DATETIME NOT NULL,
 			processed BOOLEAN DEFAULT FALSE,
 			processed_at DATETIME,
-			error TEXT
+			error TEXT,
+			status TEXT NOT NULL DEFAULT 'received',
+			spam_score REAL NOT NULL DEFAULT 0,
+			spam_reasons TEXT,
+			content_hash TEXT
 		);
 		CREATE INDEX IF NOT EXISTS idx_form_submissions_form_id ON form_submissions(form_id);
 		CREATE INDEX IF NOT EXISTS idx_form_submissions_submitted_at ON form_submissions(submitted_at);
@@ -96,17 +156,74 @@ func (fs *FormService) createTables() error {
 			submitted_at TIMESTAMP WITH TIME ZONE NOT NULL,
 			processed BOOLEAN DEFAULT FALSE,
 			processed_at TIMESTAMP WITH TIME ZONE,
-			error TEXT
+			error TEXT,
+			status TEXT NOT NULL DEFAULT 'received',
+			spam_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+			spam_reasons TEXT,
+			content_hash TEXT
 		);
 		CREATE INDEX IF NOT EXISTS idx_form_submissions_form_id ON form_submissions(form_id);
 		CREATE INDEX IF NOT EXISTS idx_form_submissions_submitted_at ON form_submissions(submitted_at);
 		`
 	}
 	
-	_, err := fs.db.Exec(createTableSQL)
+	if _, err := fs.db.Exec(createTableSQL); err != nil {
+		return err
+	}
+	
+	if err := fs.migrateTables(); err != nil {
+		return err
+	}
+	
+	indexSQL := `
+		CREATE INDEX IF NOT EXISTS idx_form_submissions_status ON form_submissions(status);
+		CREATE INDEX IF NOT EXISTS idx_form_submissions_content_hash ON form_submissions(form_id, content_hash);
+	`
+	_, err := fs.db.Exec(indexSQL)
 	return err
 }
 
+// tableColumn describes a column added after a table was first created
+type tableColumn struct {
+	table        string
+	name         string
+	sqliteType   string
+	postgresType string
+}
+
+// submissionColumnMigrations lists columns that databases created by older versions may be missing
+var submissionColumnMigrations = []tableColumn{
+	{"form_submissions", "status", "TEXT NOT NULL DEFAULT 'received'", "TEXT NOT NULL DEFAULT 'received'"},
+	{"form_submissions", "spam_score", "REAL NOT NULL DEFAULT 0", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"form_submissions", "spam_reasons", "TEXT", "TEXT"},
+	{"form_submissions", "content_hash", "TEXT", "TEXT"},
+}
+
+// migrateTables adds any missing columns to tables created by earlier versions
+func (fs *FormService) migrateTables() error {
+	return addMissingColumns(fs.db, fs.config.Database.Type, submissionColumnMigrations)
+}
+
+func addMissingColumns(db *sql.DB, dbType string, columns []tableColumn) error {
+	for _, column := range columns {
+		if _, err := db.Exec(fmt.Sprintf("SELECT %s FROM %s LIMIT 0", column.name, column.table)); err == nil {
+			continue
+		}
+		
+		columnType := column.sqliteType
+		if dbType == "postgres" {
+			columnType = column.postgresType
+		}
+		
+		alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column.table, column.name, columnType)
+		if _, err := db.Exec(alterSQL); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", column.table, column.name, err)
+		}
+		log.Printf("Migrated database: added column %s.%s", column.table, column.name)
+	}
+	return nil
+}
+
 func (fs *FormService) ProcessSubmission(submission *models.FormSubmission) (*models.ProcessingResult, error) {
 	// Generate ID if not set
 	if submission.ID == "" {
@@ -121,21 +238,61 @@ func (fs *FormService) ProcessSubmission(submission *models.FormSubmission) (*mo
 	
 	// Validate submission data
 	if err := fs.validateSubmission(submission, formConfig); err != nil {
-		return nil, fmt.Errorf("validation failed: %w", err)
+		return nil, err
 	}
 	
-	// Store submission
-	if err := fs.storeSubmission(submission); err != nil {
-		return nil, fmt.Errorf("failed to store submission: %w", err)
+	// Score the submission for spam
+	verdict, err := fs.scoreSpam(submission, formConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to score submission: %w", err)
+	}
+	submission.Status = fs.initialStatus(submission, formConfig)
+	submission.SpamScore = verdict.Score
+	submission.SpamReasons = verdict.Reasons
+	submission.ContentHash = verdict.ContentHash
+	if verdict.Spam {
+		submission.Status = models.SubmissionStatusSpam
+	}
+	
+	// Store submission, enforcing per-form hourly quotas
+	if err := fs.storeSubmissionWithinQuota(submission, formConfig); err != nil {
+		return nil, err
+	}
+	
+	// Spam is kept for review but no actions run until an admin releases it
+	if submission.Status == models.SubmissionStatusSpam {
+		log.Printf("Submission %s for form %s flagged as spam (score %.2f): %s",
+			submission.ID, submission.FormID, submission.SpamScore, strings.Join(submission.SpamReasons, "; "))
+		
+		if err := fs.storeSubmissionFile(submission); err != nil {
+			log.Printf("Failed to store submission file: %v", err)
+		}
+		
+		return &models.ProcessingResult{
+			SubmissionID: submission.ID,
+			FormID:       submission.FormID,
+			Success:      false,
+			Spam:         true,
+			Actions:      []models.ActionResult{},
+			ProcessedAt:  time.Now().UTC(),
+		}, nil
 	}
 	
-	// Process actions
-	actionService := NewActionService(fs.config)
-	result := actionService.ProcessActions(submission, formConfig)
+	// Store submission to file system for backup
+	if err := fs.storeSubmissionFile(submission); err != nil {
+		log.Printf("Failed to store submission file: %v", err)
+	}
 	
-	// Update submission status
+	// Queue actions for the background workers; results are applied to the submission
+	// once every job has finished
+	return fs.queueActions(submission, formConfig)
+}
+
+// applyProcessingResult copies the outcome of running a submission's actions onto the submission
+func (fs *FormService) applyProcessingResult(submission *models.FormSubmission, result *models.ProcessingResult) {
 	submission.Processed = result.Success
 	submission.ProcessedAt = &result.ProcessedAt
+	submission.Error = ""
 	if !result.Success {
 		var errorMsg string
 		for _, action := range result.Actions {
@@ -145,53 +302,56 @@ func (fs *FormService) ProcessSubmission(submission *models.FormSubmission) (*mo
 		}
 		submission.Error = errorMsg
 	}
-	
-	if err := fs.updateSubmission(submission); err != nil {
-		log.Printf("Failed to update submission status: %v", err)
-	}
-	
-	// Store submission to file system for backup
-	if err := fs.storeSubmissionFile(submission); err != nil {
-		log.Printf("Failed to store submission file: %v", err)
-	}
-	
-	return result, nil
 }
 
 func (fs *FormService) validateSubmission(submission *models.FormSubmission, formConfig config.FormConfig) error {
-	// Check required fields
-	for _, field := range formConfig.Fields {
-		if field.Required {
-			if value, exists := submission.Data[field.Name]; !exists || value == "" {
-				return fmt.Errorf("required field '%s' is missing", field.Name)
-			}
+	validationErr := &ValidationError{}
+	
+	for _, validator := range fs.validators[submission.FormID] {
+		value, exists := submission.Data[validator.field.Name]
+		if message := validator.validate(value, exists); message != "" {
+			validationErr.Fields = append(validationErr.Fields, models.FieldError{
+				Field:   validator.field.Name,
+				Message: message,
+			})
 		}
 	}
 	
-	// Add additional validation logic here (regex, length, etc.)
+	if len(validationErr.Fields) > 0 {
+		return validationErr
+	}
 	
 	return nil
 }
 
-func (fs *FormService) storeSubmission(submission *models.FormSubmission) error {
+func (fs *FormService) storeSubmission(exec sqlExecer, submission *models.FormSubmission) error {
 	dataJSON, err := json.Marshal(submission.Data)
 	if err != nil {
 		return err
 	}
 	
+	reasonsJSON, err := json.Marshal(submission.SpamReasons)
+	if err != nil {
+		return err
+	}
+	
+	if submission.Status == "" {
+		submission.Status = models.SubmissionStatusReceived
+	}
+	
 	query := `
-		INSERT INTO form_submissions (id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO form_submissions (id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error, status, spam_score, spam_reasons, content_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	
 	if fs.config.Database.Type == "postgres" {
 		query = `
-			INSERT INTO form_submissions (id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			INSERT INTO form_submissions (id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error, status, spam_score, spam_reasons, content_hash)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		`
 	}
 	
-	_, err = fs.db.Exec(query,
+	_, err = exec.Exec(query,
 		submission.ID,
 		submission.FormID,
 		string(dataJSON),
@@ -201,6 +361,10 @@ func (fs *FormService) storeSubmission(submission *models.FormSubmission) error
 		submission.Processed,
 		submission.ProcessedAt,
 		submission.Error,
+		submission.Status,
+		submission.SpamScore,
+		string(reasonsJSON),
+		submission.ContentHash,
 	)
 	
 	return err
@@ -209,15 +373,15 @@ func (fs *FormService) storeSubmission(submission *models.FormSubmission) error
 func (fs *FormService) updateSubmission(submission *models.FormSubmission) error {
 	query := `
 		UPDATE form_submissions 
-		SET processed = ?, processed_at = ?, error = ?
+		SET processed = ?, processed_at = ?, error = ?, status = ?
 		WHERE id = ?
 	`
 	
 	if fs.config.Database.Type == "postgres" {
 		query = `
 			UPDATE form_submissions 
-			SET processed = $1, processed_at = $2, error = $3
-			WHERE id = $4
+			SET processed = $1, processed_at = $2, error = $3, status = $4
+			WHERE id = $5
 		`
 	}
 	
@@ -225,12 +389,52 @@ func (fs *FormService) updateSubmission(submission *models.FormSubmission) error
 		submission.Processed,
 		submission.ProcessedAt,
 		submission.Error,
+		submission.Status,
 		submission.ID,
 	)
 	
 	return err
 }
 
+// updateProcessingResult stores the outcome of a submission's actions without touching its
+// status, which may have been changed by an admin while the actions ran
+func (fs *FormService) updateProcessingResult(submission *models.FormSubmission) error {
+	query := `UPDATE form_submissions SET processed = ?, processed_at = ?, error = ? WHERE id = ?`
+	if fs.config.Database.Type == "postgres" {
+		query = `UPDATE form_submissions SET processed = $1, processed_at = $2, error = $3 WHERE id = $4`
+	}
+
+	_, err := fs.db.Exec(query, submission.Processed, submission.ProcessedAt, submission.Error, submission.ID)
+	return err
+}
+
+// transitionSubmission moves a submission to status if it is currently in one of from. It
+// reports false when the submission was in another status, e.g. because a concurrent request
+// changed it first.
+func (fs *FormService) transitionSubmission(submissionID, status string, from ...string) (bool, error) {
+	args := []interface{}{status, submissionID}
+	placeholders := make([]string, len(from))
+	for i, current := range from {
+		args = append(args, current)
+		placeholders[i] = "?"
+		if fs.config.Database.Type == "postgres" {
+			placeholders[i] = fmt.Sprintf("$%d", i+3)
+		}
+	}
+
+	query := `UPDATE form_submissions SET status = ? WHERE id = ? AND status IN (` + strings.Join(placeholders, ", ") + `)`
+	if fs.config.Database.Type == "postgres" {
+		query = `UPDATE form_submissions SET status = $1 WHERE id = $2 AND status IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+
+	res, err := fs.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	updated, err := res.RowsAffected()
+	return updated > 0, err
+}
+
 func (fs *FormService) storeSubmissionFile(submission *models.FormSubmission) error {
 	// Create storage directory if it doesn't exist
 	storageDir := fs.config.Forms.StorageDir
@@ -276,9 +480,12 @@ func (fs *FormService) GetAvailableForms() []models.FormInfo {
 	return forms
 }
 
+// submissionColumns is the column list read by querySubmissions
+const submissionColumns = `id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error, status, spam_score, spam_reasons`
+
 func (fs *FormService) GetFormSubmissions(formID string, limit, offset int) ([]models.FormSubmission, error) {
 	query := `
-		SELECT id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error
+		SELECT `+submissionColumns+`
 		FROM form_submissions 
 		WHERE form_id = ?
 		ORDER BY submitted_at DESC
@@ -287,7 +494,7 @@ func (fs *FormService) GetFormSubmissions(formID string, limit, offset int) ([]m
 	
 	if fs.config.Database.Type == "postgres" {
 		query = `
-			SELECT id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error
+			SELECT `+submissionColumns+`
 			FROM form_submissions 
 			WHERE form_id = $1
 			ORDER BY submitted_at DESC
@@ -300,7 +507,7 @@ func (fs *FormService) GetFormSubmissions(formID string, limit, offset int) ([]m
 
 func (fs *FormService) GetAllSubmissions(limit, offset int) ([]models.FormSubmission, error) {
 	query := `
-		SELECT id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error
+		SELECT `+submissionColumns+`
 		FROM form_submissions 
 		ORDER BY submitted_at DESC
 		LIMIT ? OFFSET ?
@@ -308,7 +515,7 @@ func (fs *FormService) GetAllSubmissions(limit, offset int) ([]models.FormSubmis
 	
 	if fs.config.Database.Type == "postgres" {
 		query = `
-			SELECT id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error
+			SELECT `+submissionColumns+`
 			FROM form_submissions 
 			ORDER BY submitted_at DESC
 			LIMIT $1 OFFSET $2
@@ -320,14 +527,14 @@ func (fs *FormService) GetAllSubmissions(limit, offset int) ([]models.FormSubmis
 
 func (fs *FormService) GetSubmission(submissionID string) (*models.FormSubmission, error) {
 	query := `
-		SELECT id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error
+		SELECT `+submissionColumns+`
 		FROM form_submissions 
 		WHERE id = ?
 	`
 	
 	if fs.config.Database.Type == "postgres" {
 		query = `
-			SELECT id, form_id, data, ip_address, user_agent, submitted_at, processed, processed_at, error
+			SELECT `+submissionColumns+`
 			FROM form_submissions 
 			WHERE id = $1
 		`
@@ -346,6 +553,13 @@ func (fs *FormService) GetSubmission(submissionID string) (*models.FormSubmissio
 }
 
 func (fs *FormService) DeleteSubmission(submissionID string) error {
+	if err := fs.jobs.DeleteSubmissionJobs(submissionID); err != nil {
+		return err
+	}
+	if err := fs.deleteSubmissionExecutions(submissionID); err != nil {
+		return err
+	}
+	
 	query := `DELETE FROM form_submissions WHERE id = ?`
 	
 	if fs.config.Database.Type == "postgres" {
@@ -356,45 +570,148 @@ func (fs *FormService) DeleteSubmission(submissionID string) error {
 	return err
 }
 
+// ReprocessSubmission queues the form's actions for a submission again. They run through the
+// job queue with its retries and dead-letter handling, and the submission's result and
+// notifications are updated once every job has finished. It returns ErrActionsPending while
+// jobs of an earlier run haven't finished.
 func (fs *FormService) ReprocessSubmission(submission *models.FormSubmission) (*models.ProcessingResult, error) {
 	formConfig, exists := fs.GetFormConfig(submission.FormID)
 	if !exists {
 		return nil, fmt.Errorf("form '%s' not found", submission.FormID)
 	}
 	
+	pending, err := fs.jobs.countPendingJobs(submission.ID, models.ActionStageSubmission)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check queued actions: %w", err)
+	}
+	if pending > 0 {
+		return nil, fmt.Errorf("%w: %d action(s) of submission '%s' have not finished", ErrActionsPending, pending, submission.ID)
+	}
+	
 	// Reset submission status
 	submission.Processed = false
 	submission.ProcessedAt = nil
 	submission.Error = ""
+	if err := fs.updateProcessingResult(submission); err != nil {
+		return nil, fmt.Errorf("failed to update submission: %w", err)
+	}
 	
-	// Process actions
-	actionService := NewActionService(fs.config)
-	result := actionService.ProcessActions(submission, formConfig)
-	
-	// Update submission status
-	submission.Processed = result.Success
-	submission.ProcessedAt = &result.ProcessedAt
-	if !result.Success {
-		var errorMsg string
-		for _, action := range result.Actions {
-			if !action.Success && action.Error != "" {
-				errorMsg += action.Error + "; "
-			}
+	// The earlier jobs are replaced, their attempts stay in the action history
+	if err := fs.jobs.deleteStageJobs(submission.ID, models.ActionStageSubmission); err != nil {
+		return nil, fmt.Errorf("failed to clear previous actions: %w", err)
+	}
+	return fs.queueActions(submission, formConfig)
+}
+
+// queueActions queues the form's submission actions. A form without actions has nothing to
+// wait for, so the submission is processed straight away.
+func (fs *FormService) queueActions(submission *models.FormSubmission, formConfig config.FormConfig) (*models.ProcessingResult, error) {
+	result := &models.ProcessingResult{
+		SubmissionID: submission.ID,
+		FormID:       submission.FormID,
+		Success:      true,
+		Actions:      []models.ActionResult{},
+		ProcessedAt:  time.Now().UTC(),
+	}
+	
+	if len(formConfig.Actions) == 0 {
+		fs.applyProcessingResult(submission, result)
+		if err := fs.updateProcessingResult(submission); err != nil {
+			log.Printf("Failed to update submission status: %v", err)
 		}
-		submission.Error = errorMsg
+		// Nothing is queued, so the submission is processed already
+		fs.jobs.processed(submission, result)
+		return result, nil
 	}
 	
-	if err := fs.updateSubmission(submission); err != nil {
-		return nil, fmt.Errorf("failed to update submission: %w", err)
+	if err := fs.jobs.Enqueue(submission, formConfig, models.ActionStageSubmission); err != nil {
+		return nil, fmt.Errorf("failed to queue actions: %w", err)
 	}
 	
 	return result, nil
 }
 
+// GetSubmissionsByStatus returns submissions with the given status, newest first
+func (fs *FormService) GetSubmissionsByStatus(status string, limit, offset int) ([]models.FormSubmission, error) {
+	query := `
+		SELECT `+submissionColumns+`
+		FROM form_submissions 
+		WHERE status = ?
+		ORDER BY submitted_at DESC
+		LIMIT ? OFFSET ?
+	`
+	
+	if fs.config.Database.Type == "postgres" {
+		query = `
+			SELECT `+submissionColumns+`
+			FROM form_submissions 
+			WHERE status = $1
+			ORDER BY submitted_at DESC
+			LIMIT $2 OFFSET $3
+		`
+	}
+	
+	return fs.querySubmissions(query, status, limit, offset)
+}
+
+// ReleaseSubmission clears the spam flag on a submission and queues the actions that were
+// suppressed when it was received. The notifications follow once they have finished.
+func (fs *FormService) ReleaseSubmission(submission *models.FormSubmission) (*models.ProcessingResult, error) {
+	formConfig, exists := fs.GetFormConfig(submission.FormID)
+	if !exists {
+		return nil, fmt.Errorf("form '%s' not found", submission.FormID)
+	}
+	
+	status := fs.initialStatus(submission, formConfig)
+	released, err := fs.transitionSubmission(submission.ID, status, models.SubmissionStatusSpam)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update submission: %w", err)
+	}
+	if !released {
+		return nil, fmt.Errorf("%w: submission '%s' is not marked as spam", ErrNotSpam, submission.ID)
+	}
+	submission.Status = status
+	
+	return fs.queueActions(submission, formConfig)
+}
+
+// GetSubmissionJobs returns the queued action jobs of a submission
+func (fs *FormService) GetSubmissionJobs(submissionID string) ([]models.ActionJob, error) {
+	return fs.jobs.GetSubmissionJobs(submissionID)
+}
+
+// GetPlayTesters lists Google Play testers tracked by the google_play_add_tester action
+func (fs *FormService) GetPlayTesters(status string, limit, offset int) ([]models.PlayTester, error) {
+	return fs.actionService.googlePlay.GetTesters(status, limit, offset)
+}
+
+// OnSubmissionProcessed registers a callback fired when all queued actions of a submission have finished
+func (fs *FormService) OnSubmissionProcessed(fn SubmissionProcessedFunc) {
+	fs.jobs.OnSubmissionProcessed(fn)
+}
+
+// StartWorkers starts the background action workers and the email sender
+func (fs *FormService) StartWorkers() {
+	fs.jobs.Start()
+	fs.emailService.Start()
+}
+
+// StopWorkers stops the background action workers, waiting for running jobs to finish, and then
+// the email sender
+func (fs *FormService) StopWorkers() {
+	fs.jobs.Stop()
+	fs.emailService.Stop()
+}
+
 func (fs *FormService) GetDB() *sql.DB {
 	return fs.db
 }
 
+// EmailService returns the service that queues and sends every email
+func (fs *FormService) EmailService() *EmailService {
+	return fs.emailService
+}
+
 func (fs *FormService) querySubmissions(query string, args ...interface{}) ([]models.FormSubmission, error) {
 	rows, err := fs.db.Query(query, args...)
 	if err != nil {
@@ -408,6 +725,7 @@ func (fs *FormService) querySubmissions(query string, args ...interface{}) ([]mo
 		var dataJSON string
 		var processedAt sql.NullTime
 		var errorStr sql.NullString
+		var reasonsJSON sql.NullString
 		
 		err := rows.Scan(
 			&submission.ID,
@@ -419,6 +737,9 @@ func (fs *FormService) querySubmissions(query string, args ...interface{}) ([]mo
 			&submission.Processed,
 			&processedAt,
 			&errorStr,
+			&submission.Status,
+			&submission.SpamScore,
+			&reasonsJSON,
 		)
 		if err != nil {
 			return nil, err
@@ -436,6 +757,12 @@ func (fs *FormService) querySubmissions(query string, args ...interface{}) ([]mo
 			submission.Error = errorStr.String
 		}
 		
+		if reasonsJSON.Valid && reasonsJSON.String != "" {
+			if err := json.Unmarshal([]byte(reasonsJSON.String), &submission.SpamReasons); err != nil {
+				return nil, err
+			}
+		}
+		
 		submissions = append(submissions, submission)
 	}
 	
@@ -0,0 +1,515 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+const (
+	androidPublisherScope = "https://www.googleapis.com/auth/androidpublisher"
+	defaultGoogleTokenURL = "https://oauth2.googleapis.com/token"
+)
+
+// serviceAccountKey is the subset of a Google service account JSON key file we need
+type serviceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// GooglePlayService manages testers of the configured app through the Android Publisher API.
+// It authenticates with a service account key, exchanging a signed JWT for an access token.
+type GooglePlayService struct {
+	config *config.Config
+	db     *sql.DB
+	client *http.Client
+
+	mu          sync.Mutex
+	account     *serviceAccountKey
+	key         *rsa.PrivateKey
+	accessToken string
+	expiresAt   time.Time
+
+	// editMu serialises edits, as Play only allows one open edit per app to be committed
+	editMu sync.Mutex
+}
+
+func NewGooglePlayService(cfg *config.Config, db *sql.DB) *GooglePlayService {
+	return &GooglePlayService{
+		config: cfg,
+		db:     db,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Configured reports whether a service account and package name are set
+func (gs *GooglePlayService) Configured() bool {
+	return gs.config.GooglePlay.ServiceAccountFile != "" && gs.config.GooglePlay.PackageName != ""
+}
+
+func (gs *GooglePlayService) createTables() error {
+	var createTableSQL string
+
+	switch gs.config.Database.Type {
+	case "sqlite":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS play_testers (
+			id TEXT PRIMARY KEY,
+			email TEXT NOT NULL,
+			package_name TEXT NOT NULL,
+			track TEXT NOT NULL,
+			status TEXT NOT NULL,
+			submission_id TEXT,
+			error TEXT,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			UNIQUE (package_name, track, email)
+		);
+		CREATE INDEX IF NOT EXISTS idx_play_testers_status ON play_testers(status);
+		`
+	case "postgres":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS play_testers (
+			id TEXT PRIMARY KEY,
+			email TEXT NOT NULL,
+			package_name TEXT NOT NULL,
+			track TEXT NOT NULL,
+			status TEXT NOT NULL,
+			submission_id TEXT,
+			error TEXT,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			UNIQUE (package_name, track, email)
+		);
+		CREATE INDEX IF NOT EXISTS idx_play_testers_status ON play_testers(status);
+		`
+	}
+
+	_, err := gs.db.Exec(createTableSQL)
+	return err
+}
+
+// AddTester records a tester for the given track in the play_testers table. Test tracks only
+// accept Google Groups, so when Google Play is configured the track is made to list
+// google_play.google_group and the tester is left to join it; the welcome email links to the
+// group. Without Google Play the tester is left pending for manual addition in the Play Console.
+// On failure the returned tester carries the error.
+func (gs *GooglePlayService) AddTester(ctx context.Context, submissionID, email, track string) (*models.PlayTester, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	group := gs.config.GooglePlay.GoogleGroup
+	if !gs.Configured() || group == "" {
+		tester, err := gs.saveTester(email, track, models.PlayTesterStatusPending, submissionID, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed to record tester: %w", err)
+		}
+		return tester, nil
+	}
+
+	if err := gs.addGroupToTrack(ctx, track, group); err != nil {
+		tester, saveErr := gs.saveTester(email, track, models.PlayTesterStatusFailed, submissionID, err.Error())
+		if saveErr != nil {
+			fmt.Printf("[GOOGLE PLAY] Failed to record tester state for %s: %v\n", email, saveErr)
+		}
+		return tester, err
+	}
+
+	return gs.saveTester(email, track, models.PlayTesterStatusJoinPending, submissionID, "")
+}
+
+// GetTesters lists tracked testers, optionally filtered by status, newest first
+func (gs *GooglePlayService) GetTesters(status string, limit, offset int) ([]models.PlayTester, error) {
+	where, args := "", []interface{}{}
+	if status != "" {
+		where = `WHERE status = ?`
+		args = append(args, status)
+	}
+
+	query := `
+		SELECT id, email, package_name, track, status, submission_id, error, created_at, updated_at
+		FROM play_testers ` + where + `
+		ORDER BY updated_at DESC
+		LIMIT ? OFFSET ?
+	`
+	if gs.config.Database.Type == "postgres" {
+		where = ""
+		if status != "" {
+			where = `WHERE status = $1`
+		}
+		query = fmt.Sprintf(`
+			SELECT id, email, package_name, track, status, submission_id, error, created_at, updated_at
+			FROM play_testers %s
+			ORDER BY updated_at DESC
+			LIMIT $%d OFFSET $%d
+		`, where, len(args)+1, len(args)+2)
+	}
+	args = append(args, limit, offset)
+
+	rows, err := gs.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	testers := []models.PlayTester{}
+	for rows.Next() {
+		tester, err := scanPlayTester(rows)
+		if err != nil {
+			return nil, err
+		}
+		testers = append(testers, *tester)
+	}
+
+	return testers, rows.Err()
+}
+
+// saveTester inserts or updates the tester's row for the configured package and track
+func (gs *GooglePlayService) saveTester(email, track, status, submissionID, errMsg string) (*models.PlayTester, error) {
+	now := time.Now().UTC()
+	packageName := gs.config.GooglePlay.PackageName
+
+	upsert := `
+		INSERT INTO play_testers (id, email, package_name, track, status, submission_id, error, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (package_name, track, email) DO UPDATE SET
+			status = excluded.status, submission_id = excluded.submission_id, error = excluded.error, updated_at = excluded.updated_at
+	`
+	selectQuery := `
+		SELECT id, email, package_name, track, status, submission_id, error, created_at, updated_at
+		FROM play_testers WHERE package_name = ? AND track = ? AND email = ?
+	`
+	if gs.config.Database.Type == "postgres" {
+		upsert = `
+			INSERT INTO play_testers (id, email, package_name, track, status, submission_id, error, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (package_name, track, email) DO UPDATE SET
+				status = excluded.status, submission_id = excluded.submission_id, error = excluded.error, updated_at = excluded.updated_at
+		`
+		selectQuery = `
+			SELECT id, email, package_name, track, status, submission_id, error, created_at, updated_at
+			FROM play_testers WHERE package_name = $1 AND track = $2 AND email = $3
+		`
+	}
+
+	if _, err := gs.db.Exec(upsert, uuid.New().String(), email, packageName, track, status, submissionID, errMsg, now, now); err != nil {
+		return nil, err
+	}
+
+	return scanPlayTester(gs.db.QueryRow(selectQuery, packageName, track, email))
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanPlayTester(row rowScanner) (*models.PlayTester, error) {
+	var tester models.PlayTester
+	var submissionID, errorStr sql.NullString
+
+	err := row.Scan(
+		&tester.ID,
+		&tester.Email,
+		&tester.PackageName,
+		&tester.Track,
+		&tester.Status,
+		&submissionID,
+		&errorStr,
+		&tester.CreatedAt,
+		&tester.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tester.SubmissionID = submissionID.String
+	tester.Error = errorStr.String
+	return &tester, nil
+}
+
+// googleGroupURL returns the page where people ask to join a Google Group, e.g.
+// https://groups.google.com/g/testers for testers@googlegroups.com
+func googleGroupURL(group string) string {
+	name, domain, ok := strings.Cut(group, "@")
+	if !ok || name == "" {
+		return ""
+	}
+	if strings.EqualFold(domain, "googlegroups.com") {
+		return "https://groups.google.com/g/" + url.PathEscape(name)
+	}
+	// Google Workspace groups live under their domain
+	return "https://groups.google.com/a/" + url.PathEscape(domain) + "/g/" + url.PathEscape(name)
+}
+
+type playTesters struct {
+	GoogleGroups []string `json:"googleGroups"`
+}
+
+// addGroupToTrack makes a track's testers include a Google Group through an edit: open an edit,
+// read the track's testers, append the group and commit. Nothing changes when the group is
+// already listed, which is the case for every tester after the first.
+func (gs *GooglePlayService) addGroupToTrack(ctx context.Context, track, group string) error {
+	gs.editMu.Lock()
+	defer gs.editMu.Unlock()
+
+	appPath := "/androidpublisher/v3/applications/" + url.PathEscape(gs.config.GooglePlay.PackageName)
+
+	var edit struct {
+		ID string `json:"id"`
+	}
+	if err := gs.call(ctx, http.MethodPost, appPath+"/edits", struct{}{}, &edit); err != nil {
+		return fmt.Errorf("failed to open edit: %w", err)
+	}
+	editPath := appPath + "/edits/" + url.PathEscape(edit.ID)
+
+	committed := false
+	defer func() {
+		if !committed {
+			// Discard the edit so it doesn't block later ones
+			if err := gs.call(context.Background(), http.MethodDelete, editPath, nil, nil); err != nil {
+				fmt.Printf("[GOOGLE PLAY] Failed to delete edit %s: %v\n", edit.ID, err)
+			}
+		}
+	}()
+
+	testersPath := editPath + "/testers/" + url.PathEscape(track)
+
+	var testers playTesters
+	if err := gs.call(ctx, http.MethodGet, testersPath, nil, &testers); err != nil {
+		return fmt.Errorf("failed to read %s testers: %w", track, err)
+	}
+
+	for _, existing := range testers.GoogleGroups {
+		if strings.EqualFold(existing, group) {
+			return nil
+		}
+	}
+
+	testers.GoogleGroups = append(testers.GoogleGroups, group)
+	if err := gs.call(ctx, http.MethodPut, testersPath, testers, nil); err != nil {
+		return fmt.Errorf("failed to update %s testers: %w", track, err)
+	}
+
+	if err := gs.call(ctx, http.MethodPost, editPath+":commit", nil, nil); err != nil {
+		return fmt.Errorf("failed to commit edit: %w", err)
+	}
+	committed = true
+
+	return nil
+}
+
+// call sends an authenticated JSON request to the Android Publisher API
+func (gs *GooglePlayService) call(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := gs.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(gs.config.GooglePlay.APIBaseURL, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := gs.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return googleAPIError(resp)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// googleAPIError turns a Google API error response into a readable error
+func googleAPIError(resp *http.Response) error {
+	var apiErr struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Status  string `json:"status"`
+		} `json:"error"`
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err := json.Unmarshal(body, &apiErr); err == nil && apiErr.Error.Message != "" {
+		return fmt.Errorf("google play API returned %d %s: %s", resp.StatusCode, apiErr.Error.Status, apiErr.Error.Message)
+	}
+	return fmt.Errorf("google play API returned status %d", resp.StatusCode)
+}
+
+// token returns a cached access token, requesting a new one shortly before it expires
+func (gs *GooglePlayService) token(ctx context.Context) (string, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if gs.accessToken != "" && time.Now().Before(gs.expiresAt.Add(-time.Minute)) {
+		return gs.accessToken, nil
+	}
+
+	if err := gs.loadServiceAccount(); err != nil {
+		return "", err
+	}
+
+	tokenURL := gs.config.GooglePlay.TokenURL
+	if tokenURL == "" {
+		tokenURL = gs.account.TokenURI
+	}
+	if tokenURL == "" {
+		tokenURL = defaultGoogleTokenURL
+	}
+
+	now := time.Now()
+	assertion, err := signJWT(gs.key, gs.account.PrivateKeyID, map[string]interface{}{
+		"iss":   gs.account.ClientEmail,
+		"scope": androidPublisherScope,
+		"aud":   tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token request: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := gs.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request access token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return "", fmt.Errorf("token request failed with status %d: %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+
+	gs.accessToken = result.AccessToken
+	gs.expiresAt = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return gs.accessToken, nil
+}
+
+// loadServiceAccount reads and parses the service account key file once
+func (gs *GooglePlayService) loadServiceAccount() error {
+	if gs.key != nil {
+		return nil
+	}
+
+	data, err := os.ReadFile(gs.config.GooglePlay.ServiceAccountFile)
+	if err != nil {
+		return fmt.Errorf("failed to read service account file: %w", err)
+	}
+
+	var account serviceAccountKey
+	if err := json.Unmarshal(data, &account); err != nil {
+		return fmt.Errorf("failed to parse service account file: %w", err)
+	}
+	if account.ClientEmail == "" || account.PrivateKey == "" {
+		return fmt.Errorf("service account file is missing client_email or private_key")
+	}
+
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return fmt.Errorf("service account private_key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return fmt.Errorf("service account private_key is not an RSA key")
+		}
+		key = rsaKey
+	} else if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return fmt.Errorf("failed to parse service account private_key: %w", err)
+	}
+
+	gs.account = &account
+	gs.key = key
+	return nil
+}
+
+// signJWT builds an RS256 signed JSON Web Token
+func signJWT(key *rsa.PrivateKey, keyID string, claims map[string]interface{}) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
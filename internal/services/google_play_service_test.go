@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+const testPackageName = "com.example.app"
+
+// fakePlayAPI stands in for the Google token endpoint and the Android Publisher edits API,
+// keeping the testers of each track in memory
+type fakePlayAPI struct {
+	t   *testing.T
+	key *rsa.PublicKey
+
+	mu          sync.Mutex
+	groups      map[string][]string // Google Groups listed on each track
+	tokens      int                 // Access tokens handed out
+	requests    []string            // "METHOD path" of every API request
+	failUpdates bool                // Reject updates to the testers as the service account lacks permission
+}
+
+func (api *fakePlayAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if r.URL.Path == "/token" {
+		api.issueToken(w, r)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer play-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	api.requests = append(api.requests, r.Method+" "+r.URL.Path)
+	appPath := "/androidpublisher/v3/applications/" + testPackageName
+	editPath := appPath + "/edits/edit-1"
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == appPath+"/edits":
+		json.NewEncoder(w).Encode(map[string]string{"id": "edit-1"})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, editPath+"/testers/"):
+		track := strings.TrimPrefix(r.URL.Path, editPath+"/testers/")
+		json.NewEncoder(w).Encode(playTesters{GoogleGroups: api.groups[track]})
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, editPath+"/testers/"):
+		if api.failUpdates {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{
+				"code": 403, "status": "PERMISSION_DENIED", "message": "The caller does not have permission",
+			}})
+			return
+		}
+		var testers playTesters
+		if err := json.NewDecoder(r.Body).Decode(&testers); err != nil {
+			api.t.Errorf("testers update isn't JSON: %v", err)
+		}
+		api.groups[strings.TrimPrefix(r.URL.Path, editPath+"/testers/")] = testers.GoogleGroups
+		w.Write([]byte("{}"))
+	case r.Method == http.MethodPost && r.URL.Path == editPath+":commit":
+		w.Write([]byte("{}"))
+	case r.Method == http.MethodDelete && r.URL.Path == editPath:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// issueToken checks the signed JWT assertion the way Google would before handing out a token
+func (api *fakePlayAPI) issueToken(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	parts := strings.Split(r.PostForm.Get("assertion"), ".")
+	if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if err := rsa.VerifyPKCS1v15(api.key, crypto.SHA256, digest[:], signature); err != nil {
+		api.t.Errorf("token request assertion has a bad signature: %v", err)
+	}
+
+	var claims map[string]interface{}
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		api.t.Errorf("token request assertion claims aren't JSON: %v", err)
+	}
+	if claims["iss"] != "forms@example.iam.gserviceaccount.com" || claims["scope"] != androidPublisherScope {
+		api.t.Errorf("token request claims = %v, want the service account and the androidpublisher scope", claims)
+	}
+
+	api.tokens++
+	json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "play-token", "expires_in": 3600})
+}
+
+// newGooglePlayTestService returns a GooglePlayService talking to a fake Play API, with a
+// service account key written to a temporary file and the testers table in SQLite
+func newGooglePlayTestService(t *testing.T) (*GooglePlayService, *fakePlayAPI) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &fakePlayAPI{t: t, key: &key.PublicKey, groups: make(map[string][]string)}
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	account, err := json.Marshal(serviceAccountKey{
+		Type:         "service_account",
+		ClientEmail:  "forms@example.iam.gserviceaccount.com",
+		PrivateKeyID: "key-1",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:     server.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	accountFile := filepath.Join(t.TempDir(), "service-account.json")
+	if err := os.WriteFile(accountFile, account, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{}
+	cfg.Database.Type = "sqlite"
+	cfg.GooglePlay = config.GooglePlayConfig{
+		ServiceAccountFile: accountFile,
+		PackageName:        testPackageName,
+		APIBaseURL:         server.URL,
+		GoogleGroup:        "testers@googlegroups.com",
+	}
+
+	gs := NewGooglePlayService(cfg, db)
+	if err := gs.createTables(); err != nil {
+		t.Fatal(err)
+	}
+	return gs, api
+}
+
+func TestGooglePlayAddTester(t *testing.T) {
+	gs, api := newGooglePlayTestService(t)
+	api.groups["internal"] = []string{"staff@googlegroups.com"}
+
+	tester, err := gs.AddTester(context.Background(), "sub-1", " Tester@Example.com ", "internal")
+	if err != nil {
+		t.Fatalf("AddTester failed: %v", err)
+	}
+	if tester.Status != models.PlayTesterStatusJoinPending || tester.Email != "tester@example.com" || tester.SubmissionID != "sub-1" {
+		t.Errorf("tester = %+v, want tester@example.com waiting to join the group", tester)
+	}
+	if groups := api.groups["internal"]; len(groups) != 2 || groups[1] != "testers@googlegroups.com" {
+		t.Errorf("internal track groups = %v, want the group added after the existing one", groups)
+	}
+
+	// The group is listed now, so the edit is discarded without changing the track
+	api.requests = nil
+	if _, err := gs.AddTester(context.Background(), "sub-2", "other@example.com", "internal"); err != nil {
+		t.Fatalf("second AddTester failed: %v", err)
+	}
+	for _, request := range api.requests {
+		if strings.HasPrefix(request, http.MethodPut) || strings.HasSuffix(request, ":commit") {
+			t.Errorf("second tester sent %s, want the track left alone", request)
+		}
+	}
+	if last := api.requests[len(api.requests)-1]; last != http.MethodDelete+" /androidpublisher/v3/applications/"+testPackageName+"/edits/edit-1" {
+		t.Errorf("last request = %s, want the unused edit deleted", last)
+	}
+
+	// The access token is reused until it is about to expire
+	if api.tokens != 1 {
+		t.Errorf("requested %d access tokens, want 1", api.tokens)
+	}
+
+	testers, err := gs.GetTesters(models.PlayTesterStatusJoinPending, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(testers) != 2 {
+		t.Errorf("listed %d testers waiting to join, want 2", len(testers))
+	}
+}
+
+func TestGooglePlayAddTesterAPIError(t *testing.T) {
+	gs, api := newGooglePlayTestService(t)
+	api.failUpdates = true
+
+	tester, err := gs.AddTester(context.Background(), "sub-1", "tester@example.com", "internal")
+	if err == nil || !strings.Contains(err.Error(), "403 PERMISSION_DENIED: The caller does not have permission") {
+		t.Fatalf("AddTester error = %v, want the API's permission error", err)
+	}
+	if tester == nil || tester.Status != models.PlayTesterStatusFailed || tester.Error == "" {
+		t.Errorf("tester = %+v, want it recorded as failed with the error", tester)
+	}
+	// An edit left open would block the next one
+	if last := api.requests[len(api.requests)-1]; !strings.HasPrefix(last, http.MethodDelete) {
+		t.Errorf("last request = %s, want the failed edit deleted", last)
+	}
+}
+
+func TestGooglePlayAddTesterNotConfigured(t *testing.T) {
+	gs, api := newGooglePlayTestService(t)
+	gs.config.GooglePlay.GoogleGroup = ""
+
+	tester, err := gs.AddTester(context.Background(), "sub-1", "tester@example.com", "internal")
+	if err != nil {
+		t.Fatalf("AddTester failed: %v", err)
+	}
+	// Without a group to list on the track, the tester is added by hand in the Play Console
+	if tester.Status != models.PlayTesterStatusPending {
+		t.Errorf("tester status = %s, want %s", tester.Status, models.PlayTesterStatusPending)
+	}
+	if len(api.requests) != 0 || api.tokens != 0 {
+		t.Errorf("sent %d API request(s) and %d token request(s), want none", len(api.requests), api.tokens)
+	}
+}
+
+func TestGoogleGroupURL(t *testing.T) {
+	tests := []struct {
+		group string
+		want  string
+	}{
+		{"testers@googlegroups.com", "https://groups.google.com/g/testers"},
+		{"testers@GoogleGroups.com", "https://groups.google.com/g/testers"},
+		{"beta@example.com", "https://groups.google.com/a/example.com/g/beta"},
+		{"", ""},
+		{"@googlegroups.com", ""},
+		{"not-a-group", ""},
+	}
+
+	for _, tt := range tests {
+		if got := googleGroupURL(tt.group); got != tt.want {
+			t.Errorf("googleGroupURL(%q) = %q, want %q", tt.group, got, tt.want)
+		}
+	}
+}
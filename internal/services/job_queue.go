@@ -0,0 +1,768 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// SubmissionProcessedFunc is called once every action job of a submission has finished,
+// either successfully or by reaching the dead-letter state
+type SubmissionProcessedFunc func(submission *models.FormSubmission, result *models.ProcessingResult)
+
+// JobQueue runs form actions in the background. Jobs live in the action_jobs table so pending
+// work survives restarts; failed jobs are retried with exponential backoff until they reach
+// max_attempts, after which they are left in the dead state for inspection.
+type JobQueue struct {
+	config        *config.Config
+	db            *sql.DB
+	formService   *FormService
+	actionService *ActionService
+
+	workers      int
+	maxAttempts  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	pollInterval time.Duration
+
+	// finishMu serialises job completion so a submission's completion callback fires once
+	finishMu    sync.Mutex
+	onProcessed []SubmissionProcessedFunc
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewJobQueue(cfg *config.Config, formService *FormService, actionService *ActionService) *JobQueue {
+	queue := &JobQueue{
+		config:        cfg,
+		db:            formService.GetDB(),
+		formService:   formService,
+		actionService: actionService,
+		workers:       cfg.Jobs.Workers,
+		maxAttempts:   cfg.Jobs.MaxAttempts,
+		baseBackoff:   parseDurationOr(cfg.Jobs.BaseBackoff, 30*time.Second),
+		maxBackoff:    parseDurationOr(cfg.Jobs.MaxBackoff, time.Hour),
+		pollInterval:  parseDurationOr(cfg.Jobs.PollInterval, 2*time.Second),
+		wake:          make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+
+	if queue.workers < 1 {
+		queue.workers = 1
+	}
+	if queue.maxAttempts < 1 {
+		queue.maxAttempts = 1
+	}
+	actionService.email.OnEmailFinished(queue.emailFinished)
+
+	return queue
+}
+
+func (q *JobQueue) createTables() error {
+	var createTableSQL string
+
+	switch q.config.Database.Type {
+	case "sqlite":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS action_jobs (
+			id TEXT PRIMARY KEY,
+			submission_id TEXT NOT NULL,
+			form_id TEXT NOT NULL,
+			stage TEXT NOT NULL DEFAULT 'submission',
+			action_index INTEGER NOT NULL,
+			action_type TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			next_run_at DATETIME NOT NULL,
+			last_message TEXT,
+			last_error TEXT,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_action_jobs_status_next_run ON action_jobs(status, next_run_at);
+		CREATE INDEX IF NOT EXISTS idx_action_jobs_submission_id ON action_jobs(submission_id);
+
+		`
+	case "postgres":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS action_jobs (
+			id TEXT PRIMARY KEY,
+			submission_id TEXT NOT NULL,
+			form_id TEXT NOT NULL,
+			stage TEXT NOT NULL DEFAULT 'submission',
+			action_index INTEGER NOT NULL,
+			action_type TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			next_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			last_message TEXT,
+			last_error TEXT,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_action_jobs_status_next_run ON action_jobs(status, next_run_at);
+		CREATE INDEX IF NOT EXISTS idx_action_jobs_submission_id ON action_jobs(submission_id);
+
+		`
+	}
+
+	if _, err := q.db.Exec(createTableSQL); err != nil {
+		return err
+	}
+	return addMissingColumns(q.db, q.config.Database.Type, jobColumnMigrations)
+}
+
+// jobColumnMigrations lists action_jobs columns added after the table was introduced
+var jobColumnMigrations = []tableColumn{
+	{"action_jobs", "stage", "TEXT NOT NULL DEFAULT 'submission'", "TEXT NOT NULL DEFAULT 'submission'"},
+}
+
+// OnSubmissionProcessed registers a callback fired when all jobs of a submission have finished
+func (q *JobQueue) OnSubmissionProcessed(fn SubmissionProcessedFunc) {
+	q.onProcessed = append(q.onProcessed, fn)
+}
+
+// Start launches the worker pool. Jobs left running by a previous process are requeued, and
+// jobs whose email finished in the meantime are completed.
+func (q *JobQueue) Start() {
+	query := `UPDATE action_jobs SET status = ?, updated_at = ? WHERE status = ?`
+	if q.config.Database.Type == "postgres" {
+		query = `UPDATE action_jobs SET status = $1, updated_at = $2 WHERE status = $3`
+	}
+	if _, err := q.db.Exec(query, models.JobStatusQueued, time.Now().UTC(), models.JobStatusRunning); err != nil {
+		log.Printf("[JOBS] Failed to requeue interrupted jobs: %v", err)
+	}
+	q.resumeWaiting()
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	log.Printf("[JOBS] Started %d action worker(s)", q.workers)
+}
+
+// Stop signals the workers to exit and waits for running jobs to finish
+func (q *JobQueue) Stop() {
+	close(q.stop)
+	q.wg.Wait()
+}
+
+// Enqueue stores one job per action the submission's form runs at the given stage. Approval
+// actions run in order: only the first is queued, the others stay blocked until the action
+// before them succeeds.
+func (q *JobQueue) Enqueue(submission *models.FormSubmission, formConfig config.FormConfig, stage string) error {
+	now := time.Now().UTC()
+
+	query := `
+		INSERT INTO action_jobs (id, submission_id, form_id, stage, action_index, action_type, status, attempts, max_attempts, next_run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?, ?)
+	`
+	if q.config.Database.Type == "postgres" {
+		query = `
+			INSERT INTO action_jobs (id, submission_id, form_id, stage, action_index, action_type, status, attempts, max_attempts, next_run_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, 0, $8, $9, $10, $11)
+		`
+	}
+
+	for index, actionConfig := range stageActions(formConfig, stage) {
+		status := models.JobStatusQueued
+		if index > 0 && sequentialStage(stage) {
+			status = models.JobStatusBlocked
+		}
+
+		maxAttempts := q.maxAttempts
+		if attempts, _ := actionRetryPolicy(actionConfig); attempts > 0 {
+			maxAttempts = attempts
+		}
+
+		_, err := q.db.Exec(query,
+			uuid.New().String(),
+			submission.ID,
+			submission.FormID,
+			stage,
+			index,
+			actionConfig.Type,
+			status,
+			maxAttempts,
+			now,
+			now,
+			now,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to enqueue %s action: %w", actionConfig.Type, err)
+		}
+	}
+
+	q.notify()
+	return nil
+}
+
+// notify wakes an idle worker instead of waiting for the next poll
+func (q *JobQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sequentialStage reports whether a stage's actions run one after another, stopping at the
+// first failure. Approval actions depend on each other, e.g. a welcome email should only go out
+// once the tester has been added.
+func sequentialStage(stage string) bool {
+	return stage == models.ActionStageApproval
+}
+
+func (q *JobQueue) worker() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain everything that is due before going back to sleep
+		for {
+			select {
+			case <-q.stop:
+				return
+			default:
+			}
+
+			job, err := q.claimNext()
+			if err != nil {
+				log.Printf("[JOBS] Failed to claim job: %v", err)
+				break
+			}
+			if job == nil {
+				break
+			}
+			q.run(job)
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimNext atomically moves the next due job from queued to running
+func (q *JobQueue) claimNext() (*models.ActionJob, error) {
+	selectQuery := `SELECT id FROM action_jobs WHERE status = ? AND next_run_at <= ? ORDER BY next_run_at LIMIT 1`
+	claimQuery := `UPDATE action_jobs SET status = ?, attempts = attempts + 1, updated_at = ? WHERE id = ? AND status = ?`
+	if q.config.Database.Type == "postgres" {
+		selectQuery = `SELECT id FROM action_jobs WHERE status = $1 AND next_run_at <= $2 ORDER BY next_run_at LIMIT 1`
+		claimQuery = `UPDATE action_jobs SET status = $1, attempts = attempts + 1, updated_at = $2 WHERE id = $3 AND status = $4`
+	}
+
+	for {
+		now := time.Now().UTC()
+
+		var jobID string
+		err := q.db.QueryRow(selectQuery, models.JobStatusQueued, now).Scan(&jobID)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := q.db.Exec(claimQuery, models.JobStatusRunning, now, jobID, models.JobStatusQueued)
+		if err != nil {
+			return nil, err
+		}
+		if claimed, _ := res.RowsAffected(); claimed == 0 {
+			// Another worker got there first
+			continue
+		}
+
+		jobs, err := q.queryJobs(`WHERE id = ?`, `WHERE id = $1`, jobID)
+		if err != nil {
+			return nil, err
+		}
+		if len(jobs) == 0 {
+			return nil, nil
+		}
+		return &jobs[0], nil
+	}
+}
+
+func (q *JobQueue) run(job *models.ActionJob) {
+	startedAt := time.Now().UTC()
+	result, actionConfig := q.execute(job)
+	finishedAt := time.Now().UTC()
+
+	execution := &models.ActionExecution{
+		SubmissionID: job.SubmissionID,
+		JobID:        job.ID,
+		Stage:        job.Stage,
+		ActionIndex:  job.ActionIndex,
+		ActionType:   job.ActionType,
+		Success:      result.Success,
+		Message:      result.Message,
+		Error:        result.Error,
+		DurationMs:   finishedAt.Sub(startedAt).Milliseconds(),
+		Attempt:      job.Attempts,
+		ExecutedAt:   startedAt,
+	}
+	if actionConfig != nil {
+		execution.Config = snapshotActionConfig(*actionConfig)
+	}
+	q.formService.recordExecution(execution)
+
+	q.finishJob(job, result, q.retryBackoff(actionConfig), finishedAt)
+
+	if job.Status == models.JobStatusWaiting {
+		// The email may have gone out before the job started waiting for it
+		delivery, err := q.actionService.email.GetEmailDelivery(result.EmailID)
+		if err != nil {
+			log.Printf("[JOBS] Failed to load email %s of job %s: %v", result.EmailID, job.ID, err)
+			return
+		}
+		q.finishWaiting(job.ID, delivery)
+	}
+}
+
+// finishJob stores the outcome of a job's run and moves the stage on. A failed job that can
+// still be retried runs again after base * 2^(attempt-1).
+func (q *JobQueue) finishJob(job *models.ActionJob, result models.ActionResult, base time.Duration, finishedAt time.Time) {
+	q.finishMu.Lock()
+	defer q.finishMu.Unlock()
+
+	job.LastMessage = result.Message
+	job.LastError = result.Error
+	job.UpdatedAt = finishedAt
+
+	switch {
+	case result.Success && result.EmailID != "":
+		job.Status = models.JobStatusWaiting
+	case result.Success:
+		job.Status = models.JobStatusSucceeded
+	case result.Permanent || job.Attempts >= job.MaxAttempts:
+		job.Status = models.JobStatusDead
+		log.Printf("[JOBS] Job %s (%s for submission %s) failed permanently after %d attempt(s): %s",
+			job.ID, job.ActionType, job.SubmissionID, job.Attempts, result.Error)
+	default:
+		job.Status = models.JobStatusQueued
+		job.NextRunAt = finishedAt.Add(q.backoff(base, job.Attempts))
+		log.Printf("[JOBS] Job %s (%s for submission %s) failed on attempt %d, retrying at %s: %s",
+			job.ID, job.ActionType, job.SubmissionID, job.Attempts, job.NextRunAt.Format(time.RFC3339), result.Error)
+	}
+
+	if err := q.updateJob(job); err != nil {
+		log.Printf("[JOBS] Failed to update job %s: %v", job.ID, err)
+		return
+	}
+
+	q.jobFinished(job)
+}
+
+// jobFinished releases the next action of a sequential stage after a job succeeded and
+// completes the submission once nothing of the stage is left to run
+func (q *JobQueue) jobFinished(job *models.ActionJob) {
+	if job.Status == models.JobStatusSucceeded && sequentialStage(job.Stage) {
+		if err := q.releaseNext(job); err != nil {
+			log.Printf("[JOBS] Failed to queue the action after job %s: %v", job.ID, err)
+		}
+	}
+	if job.Status == models.JobStatusSucceeded || job.Status == models.JobStatusDead {
+		q.completeSubmission(job.SubmissionID, job.Stage)
+	}
+}
+
+// emailFinished is called by the email sender when an email queued by an action job was sent
+// or failed for good
+func (q *JobQueue) emailFinished(delivery *models.EmailDelivery) {
+	if delivery.JobID == "" {
+		return
+	}
+	q.finishWaiting(delivery.JobID, delivery)
+}
+
+// finishWaiting finishes a job that is waiting for its email: it succeeds once the email was sent
+// and is dead once the email failed, since the email sender already retried it. Both the worker
+// that ran the action and the email sender call it, and only the first call for a finished email
+// changes the job.
+func (q *JobQueue) finishWaiting(jobID string, delivery *models.EmailDelivery) {
+	if delivery.Status != models.EmailStatusSent && delivery.Status != models.EmailStatusFailed {
+		return
+	}
+
+	q.finishMu.Lock()
+	defer q.finishMu.Unlock()
+
+	jobs, err := q.queryJobs(`WHERE id = ?`, `WHERE id = $1`, jobID)
+	if err != nil {
+		log.Printf("[JOBS] Failed to load job %s: %v", jobID, err)
+		return
+	}
+	if len(jobs) == 0 || jobs[0].Status != models.JobStatusWaiting {
+		return
+	}
+	job := &jobs[0]
+
+	job.UpdatedAt = time.Now().UTC()
+	if delivery.Status == models.EmailStatusSent {
+		job.Status = models.JobStatusSucceeded
+		job.LastMessage = fmt.Sprintf("Email delivered to %s", delivery.To)
+		job.LastError = ""
+	} else {
+		job.Status = models.JobStatusDead
+		job.LastMessage = fmt.Sprintf("Email to %s failed after %d attempt(s)", delivery.To, delivery.Attempts)
+		job.LastError = delivery.LastError
+		log.Printf("[JOBS] Job %s (%s for submission %s) failed: email %s could not be delivered: %s",
+			job.ID, job.ActionType, job.SubmissionID, delivery.ID, delivery.LastError)
+	}
+
+	query := `UPDATE action_jobs SET status = ?, last_message = ?, last_error = ?, updated_at = ? WHERE id = ? AND status = ?`
+	if q.config.Database.Type == "postgres" {
+		query = `UPDATE action_jobs SET status = $1, last_message = $2, last_error = $3, updated_at = $4 WHERE id = $5 AND status = $6`
+	}
+	res, err := q.db.Exec(query, job.Status, job.LastMessage, job.LastError, job.UpdatedAt, job.ID, models.JobStatusWaiting)
+	if err != nil {
+		log.Printf("[JOBS] Failed to update job %s: %v", job.ID, err)
+		return
+	}
+	if updated, _ := res.RowsAffected(); updated == 0 {
+		// Another server finished it first
+		return
+	}
+
+	q.formService.completeExecution(job, job.Status == models.JobStatusSucceeded)
+	q.jobFinished(job)
+}
+
+// resumeWaiting finishes jobs whose email was delivered or failed while the server was down
+func (q *JobQueue) resumeWaiting() {
+	jobs, err := q.queryJobs(`WHERE status = ?`, `WHERE status = $1`, models.JobStatusWaiting)
+	if err != nil {
+		log.Printf("[JOBS] Failed to load waiting jobs: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		delivery, err := q.actionService.email.latestJobEmail(job.ID)
+		if err != nil {
+			log.Printf("[JOBS] Failed to load the email of job %s: %v", job.ID, err)
+			continue
+		}
+		if delivery != nil {
+			q.finishWaiting(job.ID, delivery)
+		}
+	}
+}
+
+// releaseNext queues the blocked job that follows job in a sequential stage
+func (q *JobQueue) releaseNext(job *models.ActionJob) error {
+	query := `UPDATE action_jobs SET status = ?, next_run_at = ?, updated_at = ? WHERE submission_id = ? AND stage = ? AND action_index = ? AND status = ?`
+	if q.config.Database.Type == "postgres" {
+		query = `UPDATE action_jobs SET status = $1, next_run_at = $2, updated_at = $3 WHERE submission_id = $4 AND stage = $5 AND action_index = $6 AND status = $7`
+	}
+
+	now := time.Now().UTC()
+	res, err := q.db.Exec(query, models.JobStatusQueued, now, now, job.SubmissionID, job.Stage, job.ActionIndex+1, models.JobStatusBlocked)
+	if err != nil {
+		return err
+	}
+	if released, _ := res.RowsAffected(); released > 0 {
+		q.notify()
+	}
+	return nil
+}
+
+// execute runs the job's action against the current form configuration. The action config is
+// returned for the history, or nil when the job could not be matched to one.
+func (q *JobQueue) execute(job *models.ActionJob) (models.ActionResult, *config.ActionConfig) {
+	failed := func(message, errMsg string, permanent bool) (models.ActionResult, *config.ActionConfig) {
+		return models.ActionResult{ActionType: job.ActionType, Success: false, Message: message, Error: errMsg, Permanent: permanent}, nil
+	}
+
+	submission, err := q.formService.GetSubmission(job.SubmissionID)
+	if err != nil {
+		return failed("Submission could not be loaded", err.Error(), false)
+	}
+
+	formConfig, exists := q.formService.GetFormConfig(job.FormID)
+	if !exists {
+		return failed("Form configuration not found", fmt.Sprintf("form '%s' is no longer configured", job.FormID), true)
+	}
+
+	actions := stageActions(formConfig, job.Stage)
+	if job.ActionIndex >= len(actions) || actions[job.ActionIndex].Type != job.ActionType {
+		return failed("Action configuration changed", fmt.Sprintf("%s of form '%s' is no longer '%s'", actionLabel(job.Stage, job.ActionIndex), job.FormID, job.ActionType), true)
+	}
+
+	actionConfig := actions[job.ActionIndex]
+	return q.actionService.executeAction(context.Background(), submission, actionConfig, job.ID, job.Attempts), &actionConfig
+}
+
+// retryBackoff returns the base backoff of a job's action: its own retry policy when it has one,
+// otherwise jobs.base_backoff
+func (q *JobQueue) retryBackoff(actionConfig *config.ActionConfig) time.Duration {
+	if actionConfig != nil {
+		if _, backoff := actionRetryPolicy(*actionConfig); backoff > 0 {
+			return backoff
+		}
+	}
+	return q.baseBackoff
+}
+
+// backoff returns the delay before the next attempt: base * 2^(attempt-1), capped at maxBackoff
+func (q *JobQueue) backoff(base time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= q.maxBackoff {
+			return q.maxBackoff
+		}
+	}
+	return delay
+}
+
+func (q *JobQueue) updateJob(job *models.ActionJob) error {
+	query := `
+		UPDATE action_jobs
+		SET status = ?, next_run_at = ?, last_message = ?, last_error = ?, updated_at = ?
+		WHERE id = ?
+	`
+	if q.config.Database.Type == "postgres" {
+		query = `
+			UPDATE action_jobs
+			SET status = $1, next_run_at = $2, last_message = $3, last_error = $4, updated_at = $5
+			WHERE id = $6
+		`
+	}
+
+	_, err := q.db.Exec(query, job.Status, job.NextRunAt, job.LastMessage, job.LastError, job.UpdatedAt, job.ID)
+	return err
+}
+
+// completeSubmission updates the submission once none of its jobs for the stage are pending any
+// more. Finishing the submission stage fires the OnSubmissionProcessed callbacks; finishing the
+// approval stage marks the submission invited when every approval action succeeded.
+func (q *JobQueue) completeSubmission(submissionID, stage string) {
+	jobs, err := q.queryJobs(`WHERE submission_id = ? AND stage = ? ORDER BY action_index`, `WHERE submission_id = $1 AND stage = $2 ORDER BY action_index`, submissionID, stage)
+	if err != nil {
+		log.Printf("[JOBS] Failed to load jobs for submission %s: %v", submissionID, err)
+		return
+	}
+
+	result := &models.ProcessingResult{
+		SubmissionID: submissionID,
+		Success:      true,
+		Actions:      []models.ActionResult{},
+		ProcessedAt:  time.Now().UTC(),
+	}
+
+	for _, job := range jobs {
+		switch job.Status {
+		case models.JobStatusQueued, models.JobStatusRunning, models.JobStatusWaiting:
+			return
+		}
+
+		result.FormID = job.FormID
+		actionResult := models.ActionResult{
+			ActionType: job.ActionType,
+			Success:    job.Status == models.JobStatusSucceeded,
+			Message:    job.LastMessage,
+			Error:      job.LastError,
+		}
+		if job.Status == models.JobStatusBlocked {
+			// Nothing is queued or running, so an earlier action of the stage failed
+			actionResult.Message = "Not run because an earlier action failed"
+		}
+		result.Actions = append(result.Actions, actionResult)
+		if !actionResult.Success {
+			result.Success = false
+		}
+	}
+
+	submission, err := q.formService.GetSubmission(submissionID)
+	if err != nil {
+		log.Printf("[JOBS] Failed to load submission %s: %v", submissionID, err)
+		return
+	}
+
+	q.formService.applyProcessingResult(submission, result)
+	if err := q.formService.updateProcessingResult(submission); err != nil {
+		log.Printf("[JOBS] Failed to update submission %s: %v", submissionID, err)
+	}
+	if stage == models.ActionStageApproval {
+		if !result.Success {
+			// Give the welcome email button that approved the submission back, pressing it
+			// again retries the failed action
+			q.formService.releaseActionTokens(submissionID, ActionTokenWelcomeEmail)
+		}
+		if result.Success {
+			invited, err := q.formService.transitionSubmission(submissionID, models.SubmissionStatusInvited, models.SubmissionStatusApproved)
+			if err != nil {
+				log.Printf("[JOBS] Failed to mark submission %s invited: %v", submissionID, err)
+			} else if invited {
+				submission.Status = models.SubmissionStatusInvited
+			}
+		}
+		log.Printf("[APPROVAL] Approval actions for submission %s finished (success: %t), status %s", submissionID, result.Success, submission.Status)
+	}
+	if err := q.formService.storeSubmissionFile(submission); err != nil {
+		log.Printf("[JOBS] Failed to store submission file: %v", err)
+	}
+
+	if stage != models.ActionStageSubmission {
+		return
+	}
+	q.processed(submission, result)
+}
+
+// processed fires the OnSubmissionProcessed callbacks
+func (q *JobQueue) processed(submission *models.FormSubmission, result *models.ProcessingResult) {
+	for _, fn := range q.onProcessed {
+		go fn(submission, result)
+	}
+}
+
+// GetSubmissionJobs returns a submission's jobs ordered by stage and action
+func (q *JobQueue) GetSubmissionJobs(submissionID string) ([]models.ActionJob, error) {
+	jobs, err := q.queryJobs(`WHERE submission_id = ? ORDER BY stage DESC, action_index`, `WHERE submission_id = $1 ORDER BY stage DESC, action_index`, submissionID)
+	if err != nil {
+		return nil, err
+	}
+	if jobs == nil {
+		jobs = []models.ActionJob{}
+	}
+	return jobs, nil
+}
+
+// DeleteSubmissionJobs removes all jobs belonging to a submission
+func (q *JobQueue) DeleteSubmissionJobs(submissionID string) error {
+	query := `DELETE FROM action_jobs WHERE submission_id = ?`
+	if q.config.Database.Type == "postgres" {
+		query = `DELETE FROM action_jobs WHERE submission_id = $1`
+	}
+
+	_, err := q.db.Exec(query, submissionID)
+	return err
+}
+
+// countStageJobs counts a submission's jobs for the stage
+func (q *JobQueue) countStageJobs(submissionID, stage string) (int, error) {
+	query := `SELECT COUNT(*) FROM action_jobs WHERE submission_id = ? AND stage = ?`
+	if q.config.Database.Type == "postgres" {
+		query = `SELECT COUNT(*) FROM action_jobs WHERE submission_id = $1 AND stage = $2`
+	}
+
+	var count int
+	err := q.db.QueryRow(query, submissionID, stage).Scan(&count)
+	return count, err
+}
+
+// countPendingJobs counts a submission's jobs for the stage that haven't finished yet
+func (q *JobQueue) countPendingJobs(submissionID, stage string) (int, error) {
+	query := `SELECT COUNT(*) FROM action_jobs WHERE submission_id = ? AND stage = ? AND status IN (?, ?, ?)`
+	if q.config.Database.Type == "postgres" {
+		query = `SELECT COUNT(*) FROM action_jobs WHERE submission_id = $1 AND stage = $2 AND status IN ($3, $4, $5)`
+	}
+
+	var count int
+	err := q.db.QueryRow(query, submissionID, stage, models.JobStatusQueued, models.JobStatusRunning, models.JobStatusWaiting).Scan(&count)
+	return count, err
+}
+
+// deleteStageJobs removes a submission's jobs for the stage so it can be queued again
+func (q *JobQueue) deleteStageJobs(submissionID, stage string) error {
+	query := `DELETE FROM action_jobs WHERE submission_id = ? AND stage = ?`
+	if q.config.Database.Type == "postgres" {
+		query = `DELETE FROM action_jobs WHERE submission_id = $1 AND stage = $2`
+	}
+
+	_, err := q.db.Exec(query, submissionID, stage)
+	return err
+}
+
+// retryDeadJobs queues a submission's dead jobs for the stage again with a fresh set of attempts
+// and returns how many there were. Jobs that succeeded are not run again, and jobs blocked behind
+// a dead one are released as the stage makes progress.
+func (q *JobQueue) retryDeadJobs(submissionID, stage string) (int64, error) {
+	query := `UPDATE action_jobs SET status = ?, attempts = 0, next_run_at = ?, updated_at = ? WHERE submission_id = ? AND stage = ? AND status = ?`
+	if q.config.Database.Type == "postgres" {
+		query = `UPDATE action_jobs SET status = $1, attempts = 0, next_run_at = $2, updated_at = $3 WHERE submission_id = $4 AND stage = $5 AND status = $6`
+	}
+
+	now := time.Now().UTC()
+	res, err := q.db.Exec(query, models.JobStatusQueued, now, now, submissionID, stage, models.JobStatusDead)
+	if err != nil {
+		return 0, err
+	}
+	retried, err := res.RowsAffected()
+	if retried > 0 {
+		q.notify()
+	}
+	return retried, err
+}
+
+func (q *JobQueue) queryJobs(sqliteWhere, postgresWhere string, args ...interface{}) ([]models.ActionJob, error) {
+	query := `
+		SELECT id, submission_id, form_id, stage, action_index, action_type, status, attempts, max_attempts, next_run_at, last_message, last_error, created_at, updated_at
+		FROM action_jobs ` + sqliteWhere
+	if q.config.Database.Type == "postgres" {
+		query = `
+			SELECT id, submission_id, form_id, stage, action_index, action_type, status, attempts, max_attempts, next_run_at, last_message, last_error, created_at, updated_at
+			FROM action_jobs ` + postgresWhere
+	}
+
+	rows, err := q.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []models.ActionJob
+	for rows.Next() {
+		var job models.ActionJob
+		var lastMessage, lastError sql.NullString
+
+		err := rows.Scan(
+			&job.ID,
+			&job.SubmissionID,
+			&job.FormID,
+			&job.Stage,
+			&job.ActionIndex,
+			&job.ActionType,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.NextRunAt,
+			&lastMessage,
+			&lastError,
+			&job.CreatedAt,
+			&job.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		job.LastMessage = lastMessage.String
+		job.LastError = lastError.String
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func parseDurationOr(value string, defaultValue time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return defaultValue
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// newJobTestService returns a FormService for forms with every table in an in-memory SQLite
+// database. The workers aren't started: tests run due jobs with runDueJobs.
+func newJobTestService(t *testing.T, forms map[string]config.FormConfig) *FormService {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Database.Type = "sqlite"
+	cfg.Database.Database = ":memory:"
+	cfg.Server.SecretKey = testTokenSecret
+	cfg.Forms.Forms = forms
+	cfg.Forms.StorageDir = t.TempDir()
+	cfg.Jobs.MaxAttempts = 3
+
+	fs := NewFormService(cfg)
+	t.Cleanup(func() { fs.GetDB().Close() })
+	return fs
+}
+
+// runDueJobs runs every job that is due, like an idle worker, and returns how many ran
+func runDueJobs(t *testing.T, fs *FormService) int {
+	t.Helper()
+
+	ran := 0
+	for {
+		job, err := fs.jobs.claimNext()
+		if err != nil {
+			t.Fatalf("claimNext failed: %v", err)
+		}
+		if job == nil {
+			return ran
+		}
+		fs.jobs.run(job)
+		ran++
+	}
+}
+
+// newWebhookStub returns a webhook receiver answering with the given statuses in turn, repeating
+// the last one, and a counter of the requests it received
+func newWebhookStub(t *testing.T, statuses ...int) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(atomic.AddInt32(&calls, 1))
+		if call > len(statuses) {
+			call = len(statuses)
+		}
+		w.WriteHeader(statuses[call-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newJobTestSubmission(data map[string]interface{}) *models.FormSubmission {
+	return &models.FormSubmission{
+		FormID:      "contact-form",
+		Data:        data,
+		IPAddress:   "192.0.2.1",
+		SubmittedAt: time.Now().UTC(),
+	}
+}
+
+func TestJobQueueBackoff(t *testing.T) {
+	q := &JobQueue{maxBackoff: time.Hour}
+
+	tests := []struct {
+		base    time.Duration
+		attempt int
+		want    time.Duration
+	}{
+		{30 * time.Second, 1, 30 * time.Second},
+		{30 * time.Second, 2, time.Minute},
+		{30 * time.Second, 4, 4 * time.Minute},
+		{30 * time.Second, 8, time.Hour},
+		{30 * time.Second, 100, time.Hour},
+		{time.Second, 3, 4 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := q.backoff(tt.base, tt.attempt); got != tt.want {
+			t.Errorf("backoff(%s, %d) = %s, want %s", tt.base, tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestJobQueueRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxRetries   int
+		wantCalls    int32
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"succeeds first time", []int{http.StatusOK}, 2, 1, models.JobStatusSucceeded, 1},
+		{"succeeds on a retry", []int{http.StatusServiceUnavailable, http.StatusOK}, 2, 2, models.JobStatusSucceeded, 2},
+		{"retries used up", []int{http.StatusServiceUnavailable}, 2, 3, models.JobStatusDead, 3},
+		{"no retries", []int{http.StatusServiceUnavailable}, 0, 1, models.JobStatusDead, 1},
+		{"rejected delivery isn't retried", []int{http.StatusBadRequest}, 2, 1, models.JobStatusDead, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := newWebhookStub(t, tt.statuses...)
+			fs := newJobTestService(t, map[string]config.FormConfig{
+				"contact-form": {Actions: []config.ActionConfig{{Type: "webhook", Config: map[string]interface{}{
+					"url":           server.URL,
+					"max_retries":   tt.maxRetries,
+					"retry_backoff": "1ms",
+				}}}},
+			})
+
+			processed := make(chan *models.ProcessingResult, 1)
+			fs.OnSubmissionProcessed(func(submission *models.FormSubmission, result *models.ProcessingResult) {
+				processed <- result
+			})
+
+			submission := newJobTestSubmission(map[string]interface{}{"name": "Jane"})
+			if _, err := fs.ProcessSubmission(submission); err != nil {
+				t.Fatalf("ProcessSubmission failed: %v", err)
+			}
+
+			// Each retry waits out retry_backoff before it is due
+			for i := 0; i < 10 && runDueJobs(t, fs) > 0; i++ {
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			jobs, err := fs.GetSubmissionJobs(submission.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(jobs) != 1 {
+				t.Fatalf("submission has %d jobs, want 1", len(jobs))
+			}
+			job := jobs[0]
+			if job.Status != tt.wantStatus || job.Attempts != tt.wantAttempts || job.MaxAttempts != tt.maxRetries+1 {
+				t.Errorf("job = %s after %d/%d attempt(s), want %s after %d/%d", job.Status, job.Attempts, job.MaxAttempts, tt.wantStatus, tt.wantAttempts, tt.maxRetries+1)
+			}
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Errorf("webhook called %d time(s), want %d", got, tt.wantCalls)
+			}
+
+			select {
+			case result := <-processed:
+				if result.Success != (tt.wantStatus == models.JobStatusSucceeded) {
+					t.Errorf("processed result success = %t, want %t", result.Success, tt.wantStatus == models.JobStatusSucceeded)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("OnSubmissionProcessed wasn't called")
+			}
+
+			stored, err := fs.GetSubmission(submission.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.Processed != (tt.wantStatus == models.JobStatusSucceeded) {
+				t.Errorf("submission processed = %t (%s), want %t", stored.Processed, stored.Error, tt.wantStatus == models.JobStatusSucceeded)
+			}
+		})
+	}
+}
+
+func TestReprocessSubmission(t *testing.T) {
+	server, calls := newWebhookStub(t, http.StatusOK)
+	fs := newJobTestService(t, map[string]config.FormConfig{
+		"contact-form": {Actions: []config.ActionConfig{{Type: "webhook", Config: map[string]interface{}{"url": server.URL}}}},
+	})
+
+	submission := newJobTestSubmission(map[string]interface{}{"name": "Jane"})
+	if _, err := fs.ProcessSubmission(submission); err != nil {
+		t.Fatalf("ProcessSubmission failed: %v", err)
+	}
+
+	// Reprocessing while the first run is queued would run the actions twice
+	if _, err := fs.ReprocessSubmission(submission); !errors.Is(err, ErrActionsPending) {
+		t.Fatalf("ReprocessSubmission with queued jobs: error = %v, want ErrActionsPending", err)
+	}
+
+	runDueJobs(t, fs)
+	if _, err := fs.ReprocessSubmission(submission); err != nil {
+		t.Fatalf("ReprocessSubmission failed: %v", err)
+	}
+
+	// The finished job is replaced by a fresh one going through the queue
+	jobs, err := fs.GetSubmissionJobs(submission.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Status != models.JobStatusQueued || jobs[0].Attempts != 0 {
+		t.Fatalf("jobs after reprocessing = %+v, want one queued job", jobs)
+	}
+
+	runDueJobs(t, fs)
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("webhook called %d time(s), want 2", got)
+	}
+}
+
+func TestReleaseSubmission(t *testing.T) {
+	server, calls := newWebhookStub(t, http.StatusOK)
+	fs := newJobTestService(t, map[string]config.FormConfig{
+		"contact-form": {
+			Spam:    config.SpamConfig{Enabled: true, HoneypotFields: []string{"website"}},
+			Actions: []config.ActionConfig{{Type: "webhook", Config: map[string]interface{}{"url": server.URL}}},
+		},
+	})
+
+	submission := newJobTestSubmission(map[string]interface{}{"name": "Jane", "website": "http://spam.example"})
+	result, err := fs.ProcessSubmission(submission)
+	if err != nil {
+		t.Fatalf("ProcessSubmission failed: %v", err)
+	}
+	if !result.Spam {
+		t.Fatal("submission wasn't flagged as spam")
+	}
+
+	// Spam runs no actions until it is released
+	if ran := runDueJobs(t, fs); ran != 0 {
+		t.Fatalf("%d job(s) ran for a spam submission", ran)
+	}
+
+	if _, err := fs.ReleaseSubmission(submission); err != nil {
+		t.Fatalf("ReleaseSubmission failed: %v", err)
+	}
+	if submission.Status != models.SubmissionStatusReceived {
+		t.Errorf("released submission status = %s, want %s", submission.Status, models.SubmissionStatusReceived)
+	}
+	if ran := runDueJobs(t, fs); ran != 1 || atomic.LoadInt32(calls) != 1 {
+		t.Errorf("ran %d job(s) and called the webhook %d time(s) after the release, want 1 and 1", ran, atomic.LoadInt32(calls))
+	}
+
+	// A second release would queue the actions again
+	if _, err := fs.ReleaseSubmission(submission); !errors.Is(err, ErrNotSpam) {
+		t.Errorf("second ReleaseSubmission error = %v, want ErrNotSpam", err)
+	}
+}
@@ -0,0 +1,529 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// ErrNotificationNotResendable is returned when resending a notification that is still queued
+var ErrNotificationNotResendable = errors.New("notification can't be resent")
+
+// outboxPollInterval is how often the outbox worker looks for retries that have fallen due
+const outboxPollInterval = 5 * time.Second
+
+// outboxStaleAfter is how long a delivery may stay sending before it is treated as abandoned by a
+// server that stopped mid-send. It is far longer than any channel's request timeout, so a
+// delivery another server is still working on is left alone.
+const outboxStaleAfter = 10 * time.Minute
+
+func (ns *NotificationService) createOutboxTable() error {
+	var createTableSQL string
+
+	switch ns.config.Database.Type {
+	case "sqlite":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS notification_outbox (
+			id TEXT PRIMARY KEY,
+			channel TEXT NOT NULL,
+			form_id TEXT,
+			submission_id TEXT,
+			title TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			next_attempt_at DATETIME NOT NULL,
+			last_error TEXT,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL,
+			sent_at DATETIME
+		);
+		CREATE INDEX IF NOT EXISTS idx_notification_outbox_status_next_attempt ON notification_outbox(status, next_attempt_at);
+		`
+	case "postgres":
+		createTableSQL = `
+		CREATE TABLE IF NOT EXISTS notification_outbox (
+			id TEXT PRIMARY KEY,
+			channel TEXT NOT NULL,
+			form_id TEXT,
+			submission_id TEXT,
+			title TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL,
+			next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			last_error TEXT,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			sent_at TIMESTAMP WITH TIME ZONE
+		);
+		CREATE INDEX IF NOT EXISTS idx_notification_outbox_status_next_attempt ON notification_outbox(status, next_attempt_at);
+		`
+	}
+
+	_, err := ns.db.Exec(createTableSQL)
+	return err
+}
+
+// sqlExecer runs a statement on a database or inside a transaction
+type sqlExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// enqueue stores a notification for one channel and wakes the outbox worker to deliver it
+func (ns *NotificationService) enqueue(channel string, notification *Notification) error {
+	if err := ns.insertNotification(ns.db, channel, notification, models.NotificationStatusPending, time.Now().UTC()); err != nil {
+		return err
+	}
+	ns.wakeOutbox()
+	return nil
+}
+
+// buffer stores a notification for one channel that waits for a digest or the end of quiet
+// hours. dueAt is when the scheduler picks it up.
+func (ns *NotificationService) buffer(channel string, notification *Notification, status string, dueAt time.Time) error {
+	return ns.insertNotification(ns.db, channel, notification, status, dueAt.UTC())
+}
+
+func (ns *NotificationService) insertNotification(exec sqlExecer, channel string, notification *Notification, status string, nextAttemptAt time.Time) error {
+	id := uuid.New().String()
+
+	queued := *notification
+	queued.IdempotencyKey = id
+	payload, err := json.Marshal(&queued)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	query := `
+		INSERT INTO notification_outbox (id, channel, form_id, submission_id, title, payload, status, attempts, max_attempts, next_attempt_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?, ?)
+	`
+	if ns.config.Database.Type == "postgres" {
+		query = `
+			INSERT INTO notification_outbox (id, channel, form_id, submission_id, title, payload, status, attempts, max_attempts, next_attempt_at, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, 0, $8, $9, $10, $11)
+		`
+	}
+
+	now := time.Now().UTC()
+	_, err = exec.Exec(query,
+		id,
+		channel,
+		notification.FormID,
+		notification.SubmissionID,
+		notification.Title,
+		string(payload),
+		status,
+		ns.maxAttempts,
+		nextAttemptAt,
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to queue %s notification: %w", channel, err)
+	}
+	return nil
+}
+
+// releaseHeld queues the notifications held for quiet hours that have fallen due
+func (ns *NotificationService) releaseHeld(now time.Time) (int64, error) {
+	query := `UPDATE notification_outbox SET status = ?, next_attempt_at = ?, updated_at = ? WHERE status = ? AND next_attempt_at <= ?`
+	if ns.config.Database.Type == "postgres" {
+		query = `UPDATE notification_outbox SET status = $1, next_attempt_at = $2, updated_at = $3 WHERE status = $4 AND next_attempt_at <= $5`
+	}
+	now = now.UTC()
+	res, err := ns.db.Exec(query, models.NotificationStatusPending, now, now, models.NotificationStatusHeld, now)
+	if err != nil {
+		return 0, err
+	}
+	released, _ := res.RowsAffected()
+	if released > 0 {
+		ns.wakeOutbox()
+	}
+	return released, nil
+}
+
+// dueDigestEntries returns the digest entries that have fallen due by channel, oldest first
+func (ns *NotificationService) dueDigestEntries(now time.Time) (map[string][]digestEntry, error) {
+	query := `SELECT id, channel, payload, created_at FROM notification_outbox WHERE status = ? AND next_attempt_at <= ? ORDER BY created_at`
+	if ns.config.Database.Type == "postgres" {
+		query = `SELECT id, channel, payload, created_at FROM notification_outbox WHERE status = $1 AND next_attempt_at <= $2 ORDER BY created_at`
+	}
+
+	rows, err := ns.db.Query(query, models.NotificationStatusDigest, now.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make(map[string][]digestEntry)
+	for rows.Next() {
+		var entry digestEntry
+		var channel, payload string
+		if err := rows.Scan(&entry.id, &channel, &payload, &entry.receivedAt); err != nil {
+			return nil, err
+		}
+		entry.notification = &Notification{}
+		if err := json.Unmarshal([]byte(payload), entry.notification); err != nil {
+			return nil, fmt.Errorf("failed to decode notification %s: %w", entry.id, err)
+		}
+		entries[channel] = append(entries[channel], entry)
+	}
+	return entries, rows.Err()
+}
+
+// queueDigest marks entries as digested and queues their digest in one transaction, returning
+// how many entries it covers. Entries another server already digested are left out.
+func (ns *NotificationService) queueDigest(channel string, entries []digestEntry) (int, error) {
+	claimQuery := `UPDATE notification_outbox SET status = ?, updated_at = ? WHERE id = ? AND status = ?`
+	if ns.config.Database.Type == "postgres" {
+		claimQuery = `UPDATE notification_outbox SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4`
+	}
+
+	tx, err := ns.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var claimed []digestEntry
+	for _, entry := range entries {
+		res, err := tx.Exec(claimQuery, models.NotificationStatusDigested, now, entry.id, models.NotificationStatusDigest)
+		if err != nil {
+			return 0, err
+		}
+		if updated, _ := res.RowsAffected(); updated > 0 {
+			claimed = append(claimed, entry)
+		}
+	}
+	if len(claimed) == 0 {
+		return 0, nil
+	}
+
+	if err := ns.insertNotification(tx, channel, ns.digestNotification(claimed), models.NotificationStatusPending, now); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	ns.wakeOutbox()
+	return len(claimed), nil
+}
+
+func (ns *NotificationService) wakeOutbox() {
+	select {
+	case ns.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ns *NotificationService) outboxWorker() {
+	defer ns.wg.Done()
+
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Deliver everything that is due before going back to sleep
+		for {
+			select {
+			case <-ns.stop:
+				return
+			default:
+			}
+
+			delivery, notification, err := ns.claimNextDelivery()
+			if err != nil {
+				log.Printf("[NOTIFY] Failed to claim notification: %v", err)
+				break
+			}
+			if delivery == nil {
+				break
+			}
+			ns.attemptDelivery(delivery, notification)
+		}
+
+		select {
+		case <-ns.stop:
+			return
+		case <-ns.wake:
+		case <-ticker.C:
+			ns.requeueInterrupted()
+		}
+	}
+}
+
+// requeueInterrupted returns deliveries that have been sending for longer than outboxStaleAfter
+// to the queue. Only a server that stopped or crashed mid-send leaves them behind.
+func (ns *NotificationService) requeueInterrupted() {
+	query := `UPDATE notification_outbox SET status = ?, updated_at = ? WHERE status = ? AND updated_at < ?`
+	if ns.config.Database.Type == "postgres" {
+		query = `UPDATE notification_outbox SET status = $1, updated_at = $2 WHERE status = $3 AND updated_at < $4`
+	}
+	now := time.Now().UTC()
+	if _, err := ns.db.Exec(query, models.NotificationStatusPending, now, models.NotificationStatusSending, now.Add(-outboxStaleAfter)); err != nil {
+		log.Printf("[NOTIFY] Failed to requeue interrupted notifications: %v", err)
+	}
+}
+
+// claimNextDelivery atomically moves the next due delivery from pending to sending
+func (ns *NotificationService) claimNextDelivery() (*models.NotificationDelivery, *Notification, error) {
+	selectQuery := `SELECT id FROM notification_outbox WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT 1`
+	claimQuery := `UPDATE notification_outbox SET status = ?, attempts = attempts + 1, updated_at = ? WHERE id = ? AND status = ?`
+	if ns.config.Database.Type == "postgres" {
+		selectQuery = `SELECT id FROM notification_outbox WHERE status = $1 AND next_attempt_at <= $2 ORDER BY next_attempt_at LIMIT 1`
+		claimQuery = `UPDATE notification_outbox SET status = $1, attempts = attempts + 1, updated_at = $2 WHERE id = $3 AND status = $4`
+	}
+
+	for {
+		now := time.Now().UTC()
+
+		var id string
+		err := ns.db.QueryRow(selectQuery, models.NotificationStatusPending, now).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		res, err := ns.db.Exec(claimQuery, models.NotificationStatusSending, now, id, models.NotificationStatusPending)
+		if err != nil {
+			return nil, nil, err
+		}
+		if claimed, _ := res.RowsAffected(); claimed == 0 {
+			// Another server got there first
+			continue
+		}
+
+		return ns.getDelivery(id)
+	}
+}
+
+// attemptDelivery sends a claimed notification and records the outcome: sent, pending with a
+// backoff, or failed once it has used up its attempts
+func (ns *NotificationService) attemptDelivery(delivery *models.NotificationDelivery, notification *Notification) {
+	var err error
+	notifier, enabled := ns.notifiers[delivery.Channel]
+	if enabled {
+		err = notifier.Send(context.Background(), notification)
+	} else {
+		err = fmt.Errorf("channel '%s' is not enabled", delivery.Channel)
+	}
+
+	now := time.Now().UTC()
+	delivery.UpdatedAt = now
+	delivery.LastError = ""
+
+	switch {
+	case err == nil:
+		delivery.Status = models.NotificationStatusSent
+		delivery.SentAt = &now
+	case !enabled || delivery.Attempts >= delivery.MaxAttempts:
+		delivery.Status = models.NotificationStatusFailed
+		delivery.LastError = err.Error()
+		log.Printf("[NOTIFY] %s notification %s failed permanently after %d attempt(s): %v",
+			delivery.Channel, delivery.ID, delivery.Attempts, err)
+	default:
+		delivery.Status = models.NotificationStatusPending
+		delivery.LastError = err.Error()
+		delivery.NextAttemptAt = now.Add(ns.backoff(delivery.Attempts))
+		log.Printf("[NOTIFY] %s notification %s failed on attempt %d, retrying at %s: %v",
+			delivery.Channel, delivery.ID, delivery.Attempts, delivery.NextAttemptAt.Format(time.RFC3339), err)
+	}
+
+	query := `
+		UPDATE notification_outbox
+		SET status = ?, next_attempt_at = ?, last_error = ?, updated_at = ?, sent_at = ?
+		WHERE id = ?
+	`
+	if ns.config.Database.Type == "postgres" {
+		query = `
+			UPDATE notification_outbox
+			SET status = $1, next_attempt_at = $2, last_error = $3, updated_at = $4, sent_at = $5
+			WHERE id = $6
+		`
+	}
+	if _, err := ns.db.Exec(query, delivery.Status, delivery.NextAttemptAt, delivery.LastError, delivery.UpdatedAt, delivery.SentAt, delivery.ID); err != nil {
+		log.Printf("[NOTIFY] Failed to update notification %s: %v", delivery.ID, err)
+	}
+}
+
+// backoff returns the delay before the next attempt: base * 2^(attempt-1), capped at maxBackoff
+func (ns *NotificationService) backoff(attempt int) time.Duration {
+	delay := ns.baseBackoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= ns.maxBackoff {
+			return ns.maxBackoff
+		}
+	}
+	return delay
+}
+
+// GetNotificationDeliveries lists outbox entries, most recently updated first, optionally
+// filtered by status
+func (ns *NotificationService) GetNotificationDeliveries(status string, limit, offset int) ([]models.NotificationDelivery, error) {
+	where, args := "", []interface{}{}
+	if status != "" {
+		where = `WHERE status = ?`
+		args = append(args, status)
+	}
+
+	query := `
+		SELECT id, channel, form_id, submission_id, title, payload, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at
+		FROM notification_outbox ` + where + `
+		ORDER BY updated_at DESC
+		LIMIT ? OFFSET ?
+	`
+	if ns.config.Database.Type == "postgres" {
+		where = ""
+		if status != "" {
+			where = `WHERE status = $1`
+		}
+		query = fmt.Sprintf(`
+			SELECT id, channel, form_id, submission_id, title, payload, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at
+			FROM notification_outbox %s
+			ORDER BY updated_at DESC
+			LIMIT $%d OFFSET $%d
+		`, where, len(args)+1, len(args)+2)
+	}
+	args = append(args, limit, offset)
+
+	rows, err := ns.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.NotificationDelivery{}
+	for rows.Next() {
+		delivery, _, err := scanNotificationDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ResendNotification queues a sent or failed notification for delivery again, with a fresh set
+// of attempts
+func (ns *NotificationService) ResendNotification(id string) (*models.NotificationDelivery, error) {
+	delivery, notification, err := ns.getDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status != models.NotificationStatusFailed && delivery.Status != models.NotificationStatusSent {
+		return nil, fmt.Errorf("%w: notification is %s", ErrNotificationNotResendable, delivery.Status)
+	}
+
+	// A sent notification is posted again as a new message. A failed one keeps its key, in case an
+	// attempt reached the channel after all.
+	if delivery.Status == models.NotificationStatusSent {
+		notification.IdempotencyKey = uuid.New().String()
+	}
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	now := time.Now().UTC()
+	query := `
+		UPDATE notification_outbox
+		SET status = ?, attempts = 0, max_attempts = ?, next_attempt_at = ?, last_error = NULL, updated_at = ?, sent_at = NULL, payload = ?
+		WHERE id = ? AND status = ?
+	`
+	if ns.config.Database.Type == "postgres" {
+		query = `
+			UPDATE notification_outbox
+			SET status = $1, attempts = 0, max_attempts = $2, next_attempt_at = $3, last_error = NULL, updated_at = $4, sent_at = NULL, payload = $5
+			WHERE id = $6 AND status = $7
+		`
+	}
+
+	res, err := ns.db.Exec(query, models.NotificationStatusPending, ns.maxAttempts, now, now, string(payload), id, delivery.Status)
+	if err != nil {
+		return nil, err
+	}
+	if updated, _ := res.RowsAffected(); updated == 0 {
+		return nil, fmt.Errorf("%w: notification changed while resending", ErrNotificationNotResendable)
+	}
+	log.Printf("[NOTIFY] Resending %s notification %s", delivery.Channel, id)
+
+	ns.wakeOutbox()
+	delivery, _, err = ns.getDelivery(id)
+	return delivery, err
+}
+
+func (ns *NotificationService) getDelivery(id string) (*models.NotificationDelivery, *Notification, error) {
+	query := `
+		SELECT id, channel, form_id, submission_id, title, payload, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at
+		FROM notification_outbox WHERE id = ?
+	`
+	if ns.config.Database.Type == "postgres" {
+		query = `
+			SELECT id, channel, form_id, submission_id, title, payload, status, attempts, max_attempts, next_attempt_at, last_error, created_at, updated_at, sent_at
+			FROM notification_outbox WHERE id = $1
+		`
+	}
+	return scanNotificationDelivery(ns.db.QueryRow(query, id))
+}
+
+// scanNotificationDelivery reads an outbox row, returning it along with the notification it
+// carries
+func scanNotificationDelivery(row rowScanner) (*models.NotificationDelivery, *Notification, error) {
+	var delivery models.NotificationDelivery
+	var formID, submissionID, lastError sql.NullString
+	var sentAt sql.NullTime
+	var payload string
+
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.Channel,
+		&formID,
+		&submissionID,
+		&delivery.Title,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.MaxAttempts,
+		&delivery.NextAttemptAt,
+		&lastError,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+		&sentAt,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	delivery.FormID = formID.String
+	delivery.SubmissionID = submissionID.String
+	delivery.LastError = lastError.String
+	if sentAt.Valid {
+		delivery.SentAt = &sentAt.Time
+	}
+
+	var notification Notification
+	if err := json.Unmarshal([]byte(payload), &notification); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode notification %s: %w", delivery.ID, err)
+	}
+	if err := json.Unmarshal([]byte(payload), &delivery.Payload); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode notification %s: %w", delivery.ID, err)
+	}
+	return &delivery, &notification, nil
+}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// newMatrixStub returns a homeserver answering with the given statuses in turn, repeating the
+// last one, and the paths it received. Matrix puts the idempotency key in the path.
+func newMatrixStub(t *testing.T, statuses ...int) (*httptest.Server, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		call := len(paths)
+		if call > len(statuses) {
+			call = len(statuses)
+		}
+		w.WriteHeader(statuses[call-1])
+		w.Write([]byte("{}"))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), paths...)
+	}
+}
+
+// newNotificationTestService returns a NotificationService delivering to a Matrix homeserver at
+// url, with the outbox in an in-memory SQLite database. The outbox worker isn't started: tests
+// deliver due notifications with deliverDueNotifications.
+func newNotificationTestService(t *testing.T, url string, maxAttempts int) *NotificationService {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{}
+	cfg.Database.Type = "sqlite"
+	cfg.Notifications.Matrix = config.MatrixConfig{Enabled: true, HomeserverURL: url, AccessToken: "matrix-token", RoomID: "!room:example.com"}
+	cfg.Notifications.Retry = config.NotificationRetryConfig{MaxAttempts: maxAttempts, BaseBackoff: "1ms"}
+
+	ns, err := NewNotificationService(cfg, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ns
+}
+
+// deliverDueNotifications delivers every notification that is due, like an idle outbox worker,
+// and returns how many it attempted
+func deliverDueNotifications(t *testing.T, ns *NotificationService) int {
+	t.Helper()
+
+	attempted := 0
+	for {
+		delivery, notification, err := ns.claimNextDelivery()
+		if err != nil {
+			t.Fatalf("claimNextDelivery failed: %v", err)
+		}
+		if delivery == nil {
+			return attempted
+		}
+		ns.attemptDelivery(delivery, notification)
+		attempted++
+	}
+}
+
+// onlyDelivery returns the single row in the outbox
+func onlyDelivery(t *testing.T, ns *NotificationService) *models.NotificationDelivery {
+	t.Helper()
+
+	deliveries, err := ns.GetNotificationDeliveries("", 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("outbox has %d deliveries, want 1", len(deliveries))
+	}
+	return &deliveries[0]
+}
+
+func TestNotificationOutboxBackoff(t *testing.T) {
+	ns := &NotificationService{baseBackoff: 30 * time.Second, maxBackoff: 30 * time.Minute}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{7, 30 * time.Minute},
+		{100, 30 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := ns.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestNotificationOutboxDelivery(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   string
+		wantAttempts int
+	}{
+		{"sent first time", []int{http.StatusOK}, models.NotificationStatusSent, 1},
+		{"sent on a retry", []int{http.StatusBadGateway, http.StatusOK}, models.NotificationStatusSent, 2},
+		{"attempts used up", []int{http.StatusBadGateway}, models.NotificationStatusFailed, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, paths := newMatrixStub(t, tt.statuses...)
+			ns := newNotificationTestService(t, server.URL, 3)
+
+			if err := ns.SendCustomNotification("Hello", "World", nil, 3); err != nil {
+				t.Fatalf("SendCustomNotification failed: %v", err)
+			}
+
+			// Each retry waits out the backoff before it is due
+			for i := 0; i < 10 && deliverDueNotifications(t, ns) > 0; i++ {
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			delivery := onlyDelivery(t, ns)
+			if delivery.Channel != "matrix" || delivery.Status != tt.wantStatus || delivery.Attempts != tt.wantAttempts || delivery.MaxAttempts != 3 {
+				t.Errorf("delivery = %s %s after %d/%d attempt(s), want matrix %s after %d/3",
+					delivery.Channel, delivery.Status, delivery.Attempts, delivery.MaxAttempts, tt.wantStatus, tt.wantAttempts)
+			}
+			if (delivery.SentAt != nil) != (tt.wantStatus == models.NotificationStatusSent) {
+				t.Errorf("sent_at = %v for a %s delivery", delivery.SentAt, delivery.Status)
+			}
+			if tt.wantStatus == models.NotificationStatusFailed && !strings.Contains(delivery.LastError, "502") {
+				t.Errorf("last_error = %q, want the channel's status", delivery.LastError)
+			}
+
+			requests := paths()
+			if len(requests) != tt.wantAttempts {
+				t.Fatalf("homeserver received %d requests, want %d", len(requests), tt.wantAttempts)
+			}
+			// Every attempt reuses the outbox row's ID as the transaction ID
+			for _, path := range requests {
+				if !strings.HasSuffix(path, "/send/m.room.message/"+delivery.ID) {
+					t.Errorf("request path = %s, want the delivery ID %s as transaction ID", path, delivery.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestNotificationOutboxDisabledChannel(t *testing.T) {
+	server, paths := newMatrixStub(t, http.StatusOK)
+	ns := newNotificationTestService(t, server.URL, 3)
+
+	// A channel that was disabled after the notification was queued can't succeed on a retry
+	if err := ns.enqueue("slack", &Notification{Title: "Hello", Message: "World"}); err != nil {
+		t.Fatal(err)
+	}
+	if attempted := deliverDueNotifications(t, ns); attempted != 1 {
+		t.Fatalf("attempted %d deliveries, want 1", attempted)
+	}
+
+	delivery := onlyDelivery(t, ns)
+	if delivery.Status != models.NotificationStatusFailed || delivery.Attempts != 1 || !strings.Contains(delivery.LastError, "not enabled") {
+		t.Errorf("delivery = %s after %d attempt(s): %q, want failed after 1 as the channel is disabled", delivery.Status, delivery.Attempts, delivery.LastError)
+	}
+	if len(paths()) != 0 {
+		t.Errorf("homeserver received %d requests, want none", len(paths()))
+	}
+}
+
+func TestResendNotification(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []int
+		wantNewKey bool
+	}{
+		// A sent notification is posted again as a new message
+		{"sent", []int{http.StatusOK}, true},
+		// A failed one keeps its key, in case an attempt reached the channel after all
+		{"failed", []int{http.StatusBadGateway, http.StatusOK}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, paths := newMatrixStub(t, tt.statuses...)
+			ns := newNotificationTestService(t, server.URL, 1)
+
+			if err := ns.SendCustomNotification("Hello", "World", nil, 3); err != nil {
+				t.Fatal(err)
+			}
+			deliverDueNotifications(t, ns)
+			delivery := onlyDelivery(t, ns)
+
+			resent, err := ns.ResendNotification(delivery.ID)
+			if err != nil {
+				t.Fatalf("ResendNotification failed: %v", err)
+			}
+			if resent.Status != models.NotificationStatusPending || resent.Attempts != 0 || resent.LastError != "" || resent.SentAt != nil {
+				t.Errorf("resent delivery = %+v, want it pending with a fresh set of attempts", resent)
+			}
+
+			deliverDueNotifications(t, ns)
+			if delivery := onlyDelivery(t, ns); delivery.Status != models.NotificationStatusSent {
+				t.Errorf("resent delivery status = %s, want %s", delivery.Status, models.NotificationStatusSent)
+			}
+
+			requests := paths()
+			if len(requests) != 2 {
+				t.Fatalf("homeserver received %d requests, want 2", len(requests))
+			}
+			if newKey := requests[0] != requests[1]; newKey != tt.wantNewKey {
+				t.Errorf("transaction paths %s then %s, want a new key: %t", requests[0], requests[1], tt.wantNewKey)
+			}
+		})
+	}
+}
+
+func TestResendNotificationPending(t *testing.T) {
+	server, _ := newMatrixStub(t, http.StatusOK)
+	ns := newNotificationTestService(t, server.URL, 3)
+
+	if err := ns.SendCustomNotification("Hello", "World", nil, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resending a queued notification would deliver it twice
+	delivery := onlyDelivery(t, ns)
+	if _, err := ns.ResendNotification(delivery.ID); !errors.Is(err, ErrNotificationNotResendable) {
+		t.Errorf("ResendNotification error = %v, want ErrNotificationNotResendable", err)
+	}
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+)
+
+// Where a notification goes when it is sent to a channel
+const (
+	notificationSendNow = iota
+	notificationDigest
+	notificationHold
+)
+
+// notificationSchedule decides when notifications are delivered: straight away, batched into the
+// next digest, or held until quiet hours end. Buffered notifications are stored in the outbox
+// until they are due, so they survive a restart.
+type notificationSchedule struct {
+	digestEnabled  bool
+	digestInterval time.Duration
+	digestForms    map[string]bool
+	topEntries     int
+
+	quietEnabled bool
+	quietStart   int // Minutes after midnight
+	quietEnd     int
+	location     *time.Location
+
+	urgentPriority int
+}
+
+// digestEntry is a notification waiting for the next digest
+type digestEntry struct {
+	id           string
+	notification *Notification
+	receivedAt   time.Time
+}
+
+func newNotificationSchedule(cfg config.NotificationConfig) (*notificationSchedule, error) {
+	schedule := &notificationSchedule{
+		digestEnabled:  cfg.Digest.Enabled,
+		digestForms:    make(map[string]bool),
+		topEntries:     cfg.Digest.TopEntries,
+		quietEnabled:   cfg.QuietHours.Enabled,
+		location:       time.Local,
+		urgentPriority: cfg.UrgentPriority,
+	}
+	if schedule.urgentPriority <= 0 {
+		schedule.urgentPriority = 4
+	}
+	if schedule.topEntries <= 0 {
+		schedule.topEntries = 5
+	}
+
+	if cfg.Digest.Enabled {
+		interval, err := time.ParseDuration(cfg.Digest.Interval)
+		if err != nil || interval < time.Minute {
+			return nil, fmt.Errorf("notifications.digest.interval must be a duration of at least 1m, got '%s'", cfg.Digest.Interval)
+		}
+		schedule.digestInterval = interval
+		for _, formID := range cfg.Digest.Forms {
+			schedule.digestForms[formID] = true
+		}
+	}
+
+	if cfg.QuietHours.Enabled {
+		var err error
+		if schedule.quietStart, err = parseClock(cfg.QuietHours.Start); err != nil {
+			return nil, fmt.Errorf("notifications.quiet_hours.start: %w", err)
+		}
+		if schedule.quietEnd, err = parseClock(cfg.QuietHours.End); err != nil {
+			return nil, fmt.Errorf("notifications.quiet_hours.end: %w", err)
+		}
+		if schedule.quietStart == schedule.quietEnd {
+			return nil, fmt.Errorf("notifications.quiet_hours start and end must differ")
+		}
+		if cfg.QuietHours.Timezone != "" {
+			if schedule.location, err = time.LoadLocation(cfg.QuietHours.Timezone); err != nil {
+				return nil, fmt.Errorf("notifications.quiet_hours.timezone: %w", err)
+			}
+		}
+	}
+
+	return schedule, nil
+}
+
+// parseClock turns "HH:MM" into minutes after midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("expected a time such as \"22:00\", got '%s'", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// nextDigestTime is the first multiple of interval after now, so hourly digests go out on the
+// hour and daily ones at midnight UTC
+func nextDigestTime(now time.Time, interval time.Duration) time.Time {
+	return now.Truncate(interval).Add(interval)
+}
+
+// quiet reports whether now falls inside quiet hours. The window may span midnight.
+func (s *notificationSchedule) quiet(now time.Time) bool {
+	if !s.quietEnabled {
+		return false
+	}
+	local := now.In(s.location)
+	minute := local.Hour()*60 + local.Minute()
+	if s.quietStart < s.quietEnd {
+		return minute >= s.quietStart && minute < s.quietEnd
+	}
+	return minute >= s.quietStart || minute < s.quietEnd
+}
+
+// quietEndsAt is when the quiet hours that now falls inside end
+func (s *notificationSchedule) quietEndsAt(now time.Time) time.Time {
+	local := now.In(s.location)
+	end := time.Date(local.Year(), local.Month(), local.Day(), s.quietEnd/60, s.quietEnd%60, 0, 0, s.location)
+	if !end.After(local) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+// route decides what happens to a notification sent at now and, for one that is buffered, when
+// it falls due. Urgent notifications and those carrying action buttons are sent at once: a
+// button's token starts expiring when it is issued, so holding it until the morning could
+// deliver a button that no longer works.
+func (s *notificationSchedule) route(notification *Notification, now time.Time) (int, time.Time) {
+	if notification.Priority >= s.urgentPriority || len(notification.Actions) > 0 {
+		return notificationSendNow, now
+	}
+
+	if s.digestEnabled && notification.FormID != "" &&
+		(len(s.digestForms) == 0 || s.digestForms[notification.FormID]) {
+		return notificationDigest, nextDigestTime(now, s.digestInterval)
+	}
+	if s.quiet(now) {
+		return notificationHold, s.quietEndsAt(now)
+	}
+	return notificationSendNow, now
+}
+
+// digestFormSummary collects one form's entries for a digest
+type digestFormSummary struct {
+	name    string
+	failed  int
+	entries []digestEntry
+}
+
+// digestNotification summarises buffered notifications sharing a channel and topic: a count per
+// form, busiest form first, and each form's highest priority entries
+func (ns *NotificationService) digestNotification(entries []digestEntry) *Notification {
+	forms := make(map[string]*digestFormSummary)
+	var order []*digestFormSummary
+	for _, entry := range entries {
+		formID := entry.notification.FormID
+		summary, exists := forms[formID]
+		if !exists {
+			name := formID
+			if formConfig, ok := ns.config.Forms.Forms[formID]; ok && formConfig.Name != "" {
+				name = formConfig.Name
+			}
+			summary = &digestFormSummary{name: name}
+			forms[formID] = summary
+			order = append(order, summary)
+		}
+		if !entry.notification.Success {
+			summary.failed++
+		}
+		summary.entries = append(summary.entries, entry)
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(order[i].entries) > len(order[j].entries)
+	})
+
+	var message strings.Builder
+	since := entries[0].receivedAt.In(ns.schedule.location)
+	fmt.Fprintf(&message, "%d notification(s) since %s\n", len(entries), since.Format("2006-01-02 15:04"))
+
+	for _, summary := range order {
+		fmt.Fprintf(&message, "\n%s: %d", summary.name, len(summary.entries))
+		if summary.failed > 0 {
+			fmt.Fprintf(&message, " (%d failed)", summary.failed)
+		}
+		message.WriteString("\n")
+
+		top := append([]digestEntry(nil), summary.entries...)
+		sort.SliceStable(top, func(i, j int) bool {
+			return top[i].notification.Priority > top[j].notification.Priority
+		})
+		if len(top) > ns.schedule.topEntries {
+			top = top[:ns.schedule.topEntries]
+		}
+		for _, entry := range top {
+			fmt.Fprintf(&message, "• %s %s\n", entry.receivedAt.In(ns.schedule.location).Format("15:04"), entry.notification.Title)
+		}
+		if more := len(summary.entries) - len(top); more > 0 {
+			fmt.Fprintf(&message, "… and %d more\n", more)
+		}
+	}
+
+	notification := &Notification{
+		Title:    fmt.Sprintf("Notification digest: %d submission(s)", len(entries)),
+		Message:  message.String(),
+		Tags:     []string{"bookmark_tabs", "forms"},
+		Priority: 3,
+		Success:  true,
+		Topic:    entries[0].notification.Topic,
+	}
+	if ns.config.Server.PublicURL != "" {
+		notification.Click = ns.config.PublicLink("/admin-dashboard")
+	}
+	return notification
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+)
+
+// newTestSchedule returns a schedule with the given quiet hours in a fixed UTC+2 zone, so the
+// tests don't depend on the machine's timezone database
+func newTestSchedule(t *testing.T, start, end string) *notificationSchedule {
+	t.Helper()
+
+	schedule, err := newNotificationSchedule(config.NotificationConfig{
+		Digest:     config.DigestConfig{Enabled: true, Interval: "1h", Forms: []string{"feedback-form"}},
+		QuietHours: config.QuietHoursConfig{Enabled: true, Start: start, End: end},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule.location = time.FixedZone("UTC+2", 2*60*60)
+	return schedule
+}
+
+func TestNotificationScheduleQuiet(t *testing.T) {
+	overnight := newTestSchedule(t, "22:00", "07:00")
+	daytime := newTestSchedule(t, "09:00", "17:00")
+	zone := overnight.location
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, zone)
+	}
+
+	tests := []struct {
+		name     string
+		schedule *notificationSchedule
+		now      time.Time
+		want     bool
+		wantEnd  time.Time // When the quiet hours end, checked when want is true
+	}{
+		{"before overnight window", overnight, at(10, 21, 59), false, time.Time{}},
+		{"overnight window starts", overnight, at(10, 22, 0), true, at(11, 7, 0)},
+		{"before midnight", overnight, at(10, 23, 59), true, at(11, 7, 0)},
+		{"at midnight", overnight, at(11, 0, 0), true, at(11, 7, 0)},
+		{"after midnight", overnight, at(11, 6, 59), true, at(11, 7, 0)},
+		{"overnight window ends", overnight, at(11, 7, 0), false, time.Time{}},
+		{"midday", overnight, at(11, 12, 0), false, time.Time{}},
+		{"same-day window", daytime, at(10, 9, 0), true, at(10, 17, 0)},
+		{"same-day window ends", daytime, at(10, 17, 0), false, time.Time{}},
+		{"outside same-day window at night", daytime, at(10, 23, 0), false, time.Time{}},
+		// 21:30 UTC is 23:30 in the schedule's zone
+		{"other zone inside window", overnight, time.Date(2026, 3, 10, 21, 30, 0, 0, time.UTC), true, at(11, 7, 0)},
+		{"other zone outside window", overnight, time.Date(2026, 3, 10, 19, 30, 0, 0, time.UTC), false, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.quiet(tt.now); got != tt.want {
+				t.Fatalf("quiet(%s) = %t, want %t", tt.now, got, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			if end := tt.schedule.quietEndsAt(tt.now); !end.Equal(tt.wantEnd) {
+				t.Errorf("quietEndsAt(%s) = %s, want %s", tt.now, end, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestNextDigestTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		now      time.Time
+		interval time.Duration
+		want     time.Time
+	}{
+		{"hourly", time.Date(2026, 3, 10, 10, 15, 0, 0, time.UTC), time.Hour, time.Date(2026, 3, 10, 11, 0, 0, 0, time.UTC)},
+		{"hourly on the hour", time.Date(2026, 3, 10, 11, 0, 0, 0, time.UTC), time.Hour, time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)},
+		{"quarter hour", time.Date(2026, 3, 10, 10, 16, 0, 0, time.UTC), 15 * time.Minute, time.Date(2026, 3, 10, 10, 30, 0, 0, time.UTC)},
+		{"daily before midnight", time.Date(2026, 3, 10, 23, 59, 0, 0, time.UTC), 24 * time.Hour, time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)},
+		{"daily in another zone", time.Date(2026, 3, 11, 1, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)), 24 * time.Hour, time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nextDigestTime(tt.now, tt.interval); !got.Equal(tt.want) {
+				t.Errorf("nextDigestTime(%s, %s) = %s, want %s", tt.now, tt.interval, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotificationScheduleRoute(t *testing.T) {
+	schedule := newTestSchedule(t, "22:00", "07:00")
+	quiet := time.Date(2026, 3, 10, 23, 30, 0, 0, schedule.location)
+	day := time.Date(2026, 3, 10, 12, 30, 0, 0, schedule.location)
+	approve := []NotificationAction{{Label: "Approve", URL: "https://example.com/approve", Method: "POST"}}
+
+	tests := []struct {
+		name         string
+		notification *Notification
+		now          time.Time
+		want         int
+		wantDue      time.Time
+	}{
+		{"daytime", &Notification{FormID: "contact-form", Priority: 3}, day, notificationSendNow, day},
+		{"held during quiet hours", &Notification{FormID: "contact-form", Priority: 3}, quiet, notificationHold, time.Date(2026, 3, 11, 7, 0, 0, 0, schedule.location)},
+		{"urgent ignores quiet hours", &Notification{FormID: "contact-form", Priority: 4}, quiet, notificationSendNow, quiet},
+		{"digest form", &Notification{FormID: "feedback-form", Priority: 3}, day, notificationDigest, nextDigestTime(day, time.Hour)},
+		{"digest form during quiet hours", &Notification{FormID: "feedback-form", Priority: 3}, quiet, notificationDigest, nextDigestTime(quiet, time.Hour)},
+		// The button's token is already running down, so it isn't held until the morning
+		{"buttons skip digests and quiet hours", &Notification{FormID: "feedback-form", Priority: 3, Actions: approve}, quiet, notificationSendNow, quiet},
+		{"buttons in the daytime", &Notification{FormID: "contact-form", Priority: 3, Actions: approve}, day, notificationSendNow, day},
+		{"urgent digest form", &Notification{FormID: "feedback-form", Priority: 5}, day, notificationSendNow, day},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, due := schedule.route(tt.notification, tt.now)
+			if got != tt.want || !due.Equal(tt.wantDue) {
+				t.Errorf("route = %d due %s, want %d due %s", got, due, tt.want, tt.wantDue)
+			}
+		})
+	}
+}
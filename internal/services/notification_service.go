@@ -1,211 +1,331 @@
 package services
 
 import (
-	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"log"
+	"sync"
 	"time"
 
 	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
 	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
 )
 
+// NotificationService notifies admins about submissions. Notifications are written to the
+// notification_outbox table, one row per channel, and delivered by a background worker that
+// retries failures with exponential backoff.
 type NotificationService struct {
-	config *config.Config
-}
+	config    *config.Config
+	db        *sql.DB
+	notifiers map[string]Notifier
+	templates *actionTemplates
+	schedule  *notificationSchedule
 
-func NewNotificationService(cfg *config.Config) *NotificationService {
-	return &NotificationService{
-		config: cfg,
-	}
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
 }
 
-type NtfyMessage struct {
-	Topic    string            `json:"topic"`
-	Message  string            `json:"message"`
-	Title    string            `json:"title"`
-	Tags     []string          `json:"tags,omitempty"`
-	Priority int               `json:"priority,omitempty"`
-	Actions  []NtfyAction     `json:"actions,omitempty"`
-	Click    string           `json:"click,omitempty"`
-	Attach   string           `json:"attach,omitempty"`
-	Filename string           `json:"filename,omitempty"`
-	Email    string           `json:"email,omitempty"`
-	Delay    string           `json:"delay,omitempty"`
+// Notification is a message for admins. Each channel renders it in its own format.
+type Notification struct {
+	Title        string               `json:"title"`
+	Message      string               `json:"message"`
+	Tags         []string             `json:"tags,omitempty"` // ntfy tags, e.g. "white_check_mark"
+	Priority     int                  `json:"priority"`       // 1 (min) to 5 (max), as in ntfy
+	Success      bool                 `json:"success"`
+	FormID       string               `json:"form_id,omitempty"`
+	SubmissionID string               `json:"submission_id,omitempty"`
+	Click        string               `json:"click,omitempty"` // Opened when the notification is clicked
+	Topic        string               `json:"topic,omitempty"` // ntfy topic overriding notifications.ntfy.topic
+	Actions      []NotificationAction `json:"actions,omitempty"`
+	// Set by the outbox and kept across retries, so channels with idempotent sends such as
+	// Matrix don't post a notification twice when a response is lost
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
 }
 
-type NtfyAction struct {
-	Action string `json:"action"`
+// NotificationAction is a button that sends an HTTP request, such as approving a submission.
+// Channels that can't send requests from a button show the Click link instead.
+type NotificationAction struct {
 	Label  string `json:"label"`
-	URL    string `json:"url,omitempty"`
-	Method string `json:"method,omitempty"`
+	URL    string `json:"url"`
+	Method string `json:"method"`
 	Body   string `json:"body,omitempty"`
 }
 
-func (ns *NotificationService) SendSubmissionNotification(submission *models.FormSubmission, result *models.ProcessingResult) error {
-	if !ns.config.Notifications.Ntfy.Enabled {
-		return nil
+// NewNotificationService builds the enabled notification channels, checks the channels each
+// form asks for and creates the outbox table
+func NewNotificationService(cfg *config.Config, db *sql.DB) (*NotificationService, error) {
+	notifiers, err := newNotifiers(cfg.Notifications)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get form config for better notification content
-	formConfig, exists := ns.config.Forms.Forms[submission.FormID]
-	formName := submission.FormID
-	if exists {
-		formName = formConfig.Name
-	}
-
-	// Create notification message
-	var status string
-	var tags []string
-	var priority int
-	
-	if result.Success {
-		status = "✅ Successfully processed"
-		tags = []string{"white_check_mark", "forms"}
-		priority = 3
-	} else {
-		status = "❌ Processing failed"
-		tags = []string{"x", "forms", "error"}
-		priority = 4
-	}
-
-	// Format submission data for display
-	dataStr := ""
-	for key, value := range submission.Data {
-		if key == "platform" {
-			platform := "Android"
-			if value == "ios" {
-				platform = "iOS (TestFlight)"
+	known := make(map[string]bool)
+	for _, name := range notifierNames {
+		known[name] = true
+	}
+	for formID, form := range cfg.Forms.Forms {
+		for _, channel := range form.Notifications.Channels {
+			if !known[channel] {
+				return nil, fmt.Errorf("form '%s': unknown notification channel '%s'", formID, channel)
 			}
-			dataStr += fmt.Sprintf("%s: %s\n", key, platform)
-		} else if key == "wantsNews" {
-			wants := "No"
-			if value == true || value == "true" {
-				wants = "Yes"
+			if _, enabled := notifiers[channel]; !enabled {
+				return nil, fmt.Errorf("form '%s': notification channel '%s' is not enabled", formID, channel)
 			}
-			dataStr += fmt.Sprintf("News Updates: %s\n", wants)
-		} else {
-			dataStr += fmt.Sprintf("%s: %v\n", key, value)
 		}
 	}
+	if err := compileNotificationTemplates(cfg.Forms.Forms); err != nil {
+		return nil, err
+	}
+	schedule, err := newNotificationSchedule(cfg.Notifications)
+	if err != nil {
+		return nil, err
+	}
 
-	message := fmt.Sprintf(`%s
+	service := &NotificationService{
+		config:      cfg,
+		db:          db,
+		notifiers:   notifiers,
+		templates:   newActionTemplates(),
+		schedule:    schedule,
+		maxAttempts: cfg.Notifications.Retry.MaxAttempts,
+		baseBackoff: parseDurationOr(cfg.Notifications.Retry.BaseBackoff, 30*time.Second),
+		maxBackoff:  parseDurationOr(cfg.Notifications.Retry.MaxBackoff, 30*time.Minute),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	if service.maxAttempts < 1 {
+		service.maxAttempts = 1
+	}
 
-Form: %s
-Submission ID: %s
-Submitted: %s
-IP Address: %s
+	if err := service.createOutboxTable(); err != nil {
+		return nil, fmt.Errorf("failed to create notification outbox: %w", err)
+	}
+	return service, nil
+}
 
-Data:
-%s`, 
-		status,
-		formName,
-		submission.ID[:8],
-		submission.SubmittedAt.Format("2006-01-02 15:04:05"),
-		submission.IPAddress,
-		dataStr,
-	)
+// Enabled reports whether any notification channel is configured
+func (ns *NotificationService) Enabled() bool {
+	return len(ns.notifiers) > 0
+}
 
-	// Add action results if there were any failures
-	if !result.Success {
-		message += "\nAction Results:\n"
-		for _, action := range result.Actions {
-			statusIcon := "✅"
-			if !action.Success {
-				statusIcon = "❌"
-			}
-			message += fmt.Sprintf("%s %s: %s\n", statusIcon, action.ActionType, action.Message)
-			if action.Error != "" {
-				message += fmt.Sprintf("   Error: %s\n", action.Error)
-			}
-		}
+// channelsFor returns the notifiers for a form: the form's own channels, or every enabled one
+func (ns *NotificationService) channelsFor(formID string) []Notifier {
+	var channels []string
+	if formConfig, exists := ns.config.Forms.Forms[formID]; exists {
+		channels = formConfig.Notifications.Channels
+	}
+	if len(channels) == 0 {
+		channels = notifierNames
 	}
 
-	ntfyMsg := NtfyMessage{
-		Topic:    ns.config.Notifications.Ntfy.Topic,
-		Title:    fmt.Sprintf("Form Submission: %s", formName),
-		Message:  message,
-		Tags:     tags,
-		Priority: priority,
+	var notifiers []Notifier
+	for _, name := range channels {
+		if notifier, ok := ns.notifiers[name]; ok {
+			notifiers = append(notifiers, notifier)
+		}
 	}
+	return notifiers
+}
+
+// send queues a notification for every channel. Notifications batched into a digest or held for
+// quiet hours are stored in the outbox until the scheduler queues them.
+func (ns *NotificationService) send(notifiers []Notifier, notification *Notification) error {
+	route, dueAt := ns.schedule.route(notification, time.Now())
 
-	// Add action button for internal testing submissions (only for Android)
-	if submission.FormID == "internal-testing-signup" && result.Success {
-		// Check platform - only add action button for Android (iOS gets welcome email automatically)
-		platform, platformExists := submission.Data["platform"]
-		if platformExists && platform != "ios" {
-			// Extract email from submission for the action button
-			email := ""
-			if emailVal, exists := submission.Data["email"]; exists {
-				if emailStr, ok := emailVal.(string); ok {
-					email = emailStr
-				}
+	var errs []error
+	for _, notifier := range notifiers {
+		var err error
+		switch route {
+		case notificationDigest:
+			if err = ns.buffer(notifier.Name(), notification, models.NotificationStatusDigest, dueAt); err == nil {
+				log.Printf("[NOTIFY] Added %s notification for form %s to the digest due at %s", notifier.Name(), notification.FormID, dueAt.Format(time.RFC3339))
 			}
-			
-			if email != "" {
-				ntfyMsg.Actions = []NtfyAction{
-					{
-						Action: "http",
-						Label:  "Send Welcome Email",
-						URL:    "https://forms.pinepods.online/api/admin/send-welcome-email",
-						Method: "POST",
-						Body:   fmt.Sprintf(`{"submission_id": "%s", "email": "%s"}`, submission.ID, email),
-					},
-				}
+		case notificationHold:
+			if err = ns.buffer(notifier.Name(), notification, models.NotificationStatusHeld, dueAt); err == nil {
+				log.Printf("[NOTIFY] Holding %s notification until quiet hours end at %s", notifier.Name(), dueAt.Format(time.RFC3339))
 			}
+		default:
+			err = ns.enqueue(notifier.Name(), notification)
+		}
+		if err != nil {
+			log.Printf("[NOTIFY] %v", err)
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// Start runs the outbox worker and the scheduler that queues digests and releases held
+// notifications. The scheduler runs even with digests and quiet hours turned off, so entries
+// buffered under an earlier configuration are still delivered. Deliveries abandoned mid-send by a
+// stopped server are queued again.
+func (ns *NotificationService) Start() {
+	ns.requeueInterrupted()
+	ns.wg.Add(2)
+	go ns.outboxWorker()
+
+	go func() {
+		defer ns.wg.Done()
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
 
-	return ns.sendNtfyMessage(ntfyMsg)
+		ns.flush(time.Now())
+		for {
+			select {
+			case <-ns.stop:
+				return
+			case now := <-ticker.C:
+				ns.flush(now)
+			}
+		}
+	}()
 }
 
-func (ns *NotificationService) SendCustomNotification(title, message string, tags []string, priority int) error {
-	if !ns.config.Notifications.Ntfy.Enabled {
-		return nil
+// Stop ends the workers. Buffered notifications stay in the outbox and are delivered after a
+// restart.
+func (ns *NotificationService) Stop() {
+	close(ns.stop)
+	ns.wg.Wait()
+}
+
+// flush releases held notifications and queues the digests that are due, unless it is quiet
+// hours
+func (ns *NotificationService) flush(now time.Time) {
+	if ns.schedule.quiet(now) {
+		return
 	}
 
-	ntfyMsg := NtfyMessage{
-		Topic:    ns.config.Notifications.Ntfy.Topic,
-		Title:    title,
-		Message:  message,
-		Tags:     tags,
-		Priority: priority,
+	if released, err := ns.releaseHeld(now); err != nil {
+		log.Printf("[NOTIFY] Failed to release held notifications: %v", err)
+	} else if released > 0 {
+		log.Printf("[NOTIFY] Released %d notification(s) held for quiet hours", released)
+	}
+
+	entries, err := ns.dueDigestEntries(now)
+	if err != nil {
+		log.Printf("[NOTIFY] Failed to load digest entries: %v", err)
+		return
 	}
 
-	return ns.sendNtfyMessage(ntfyMsg)
+	// Each channel gets a digest per ntfy topic, so a form publishing to its own topic keeps its
+	// digest there
+	type digestKey struct{ channel, topic string }
+	groups := make(map[digestKey][]digestEntry)
+	var order []digestKey
+	for channel, channelEntries := range entries {
+		for _, entry := range channelEntries {
+			key := digestKey{channel: channel, topic: entry.notification.Topic}
+			if _, exists := groups[key]; !exists {
+				order = append(order, key)
+			}
+			groups[key] = append(groups[key], entry)
+		}
+	}
+
+	for _, key := range order {
+		queued, err := ns.queueDigest(key.channel, groups[key])
+		if err != nil {
+			log.Printf("[NOTIFY] Failed to queue %s digest: %v", key.channel, err)
+			continue
+		}
+		if queued > 0 {
+			log.Printf("[NOTIFY] Queued %s digest of %d notification(s)", key.channel, queued)
+		}
+	}
 }
 
-func (ns *NotificationService) sendNtfyMessage(msg NtfyMessage) error {
-	jsonData, err := json.Marshal(msg)
-	if err != nil {
-		return fmt.Errorf("failed to marshal ntfy message: %w", err)
+func (ns *NotificationService) SendSubmissionNotification(submission *models.FormSubmission, result *models.ProcessingResult) error {
+	notifiers := ns.channelsFor(submission.FormID)
+	if len(notifiers) == 0 {
+		return nil
 	}
 
-	req, err := http.NewRequest("POST", ns.config.Notifications.Ntfy.URL, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create ntfy request: %w", err)
+	formConfig, exists := ns.config.Forms.Forms[submission.FormID]
+	if !exists {
+		formConfig = config.FormConfig{Name: submission.FormID}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	
-	// Add authentication if token is provided
-	if ns.config.Notifications.Ntfy.Token != "" {
-		req.Header.Set("Authorization", "Bearer "+ns.config.Notifications.Ntfy.Token)
+	notification := &Notification{
+		Title:        fmt.Sprintf("Form Submission: %s", notificationFormName(submission, formConfig)),
+		Message:      defaultNotificationMessage(submission, formConfig, result),
+		Tags:         []string{"white_check_mark", "forms"},
+		Priority:     3,
+		Success:      result.Success,
+		FormID:       submission.FormID,
+		SubmissionID: submission.ID,
 	}
+	if !result.Success {
+		notification.Tags = []string{"x", "forms", "error"}
+		notification.Priority = 4
+	}
+	if ns.config.Server.PublicURL != "" {
+		notification.Click = ns.config.PublicLink("/admin-dashboard")
+	}
+	ns.applyFormNotification(notification, submission, formConfig, result)
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send ntfy notification: %w", err)
+	// Add an approve button for submissions waiting on an admin (Android internal testing
+	// signups; iOS gets its welcome email automatically)
+	if submission.Status == models.SubmissionStatusPending {
+		// Extract email from submission for the action button
+		email := ""
+		if emailVal, exists := submission.Data["email"]; exists {
+			if emailStr, ok := emailVal.(string); ok {
+				email = emailStr
+			}
+		}
+		
+		if email != "" {
+			// The endpoint is unauthenticated, so the button carries a signed single-use token
+			// tied to this submission and address
+			ttl := parseDurationOr(ns.config.Notifications.Ntfy.ActionTokenTTL, 72*time.Hour)
+			token, err := NewActionToken(ns.config.Server.SecretKey, ActionTokenWelcomeEmail, submission.ID, email, ttl)
+			if err != nil {
+				return err
+			}
+			body, err := json.Marshal(map[string]string{
+				"submission_id": submission.ID,
+				"email":         email,
+				"token":         token,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to marshal notification action body: %w", err)
+			}
+			
+			notification.Actions = []NotificationAction{
+				{
+					Label:  "Approve & Send Welcome Email",
+					URL:    ns.config.PublicLink("/api/admin/send-welcome-email"),
+					Method: "POST",
+					Body:   string(body),
+				},
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("ntfy server returned status %d", resp.StatusCode)
+	return ns.send(notifiers, notification)
+}
+
+// SendCustomNotification sends a message on every enabled channel
+func (ns *NotificationService) SendCustomNotification(title, message string, tags []string, priority int) error {
+	notifiers := ns.channelsFor("")
+	if len(notifiers) == 0 {
+		return nil
 	}
 
-	return nil
+	return ns.send(notifiers, &Notification{
+		Title:    title,
+		Message:  message,
+		Tags:     tags,
+		Priority: priority,
+		Success:  true,
+	})
 }
 
 func (ns *NotificationService) SendTestNotification() error {
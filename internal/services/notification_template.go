@@ -0,0 +1,192 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// NotificationTemplateData is the value notification title, body and click templates are
+// rendered against. Alongside the action template values it has the processing outcome, e.g.
+// {{if .Success}}…{{end}} or {{range .Results}}{{.ActionType}}{{end}}.
+type NotificationTemplateData struct {
+	ActionTemplateData
+	FormName  string
+	ShortID   string // First 8 characters of the submission ID
+	IPAddress string
+	Status    string
+	Success   bool
+	Results   []models.ActionResult
+}
+
+func newNotificationTemplateData(submission *models.FormSubmission, formConfig config.FormConfig, result *models.ProcessingResult, publicURL string) NotificationTemplateData {
+	return NotificationTemplateData{
+		ActionTemplateData: newActionTemplateData(submission, formConfig, publicURL),
+		FormName:           notificationFormName(submission, formConfig),
+		ShortID:            shortSubmissionID(submission.ID),
+		IPAddress:          submission.IPAddress,
+		Status:             submission.Status,
+		Success:            result.Success,
+		Results:            result.Actions,
+	}
+}
+
+// notificationFormName is the form's display name, or its ID when it has none
+func notificationFormName(submission *models.FormSubmission, formConfig config.FormConfig) string {
+	if formConfig.Name != "" {
+		return formConfig.Name
+	}
+	return submission.FormID
+}
+
+// defaultNotificationMessage is the body used when a form doesn't template its own: the
+// submission's details and data, plus every action's result when processing failed
+func defaultNotificationMessage(submission *models.FormSubmission, formConfig config.FormConfig, result *models.ProcessingResult) string {
+	status := "✅ Successfully processed"
+	if !result.Success {
+		status = "❌ Processing failed"
+	}
+
+	keys := make([]string, 0, len(submission.Data))
+	for key := range submission.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var data strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&data, "%s: %v\n", key, submission.Data[key])
+	}
+
+	message := fmt.Sprintf(`%s
+
+Form: %s
+Submission ID: %s
+Submitted: %s
+IP Address: %s
+
+Data:
+%s`,
+		status,
+		notificationFormName(submission, formConfig),
+		shortSubmissionID(submission.ID),
+		submission.SubmittedAt.Format("2006-01-02 15:04:05"),
+		submission.IPAddress,
+		data.String(),
+	)
+
+	if !result.Success {
+		message += "\nAction Results:\n"
+		for _, action := range result.Actions {
+			statusIcon := "✅"
+			if !action.Success {
+				statusIcon = "❌"
+			}
+			message += fmt.Sprintf("%s %s: %s\n", statusIcon, action.ActionType, action.Message)
+			if action.Error != "" {
+				message += fmt.Sprintf("   Error: %s\n", action.Error)
+			}
+		}
+	}
+
+	return message
+}
+
+func shortSubmissionID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+// applyFormNotification applies a form's notification settings on top of the defaults. Settings
+// for the outcome (success or failure) win over the form-wide ones. A template that fails to
+// render is logged and its default kept, so the notification still goes out.
+func (ns *NotificationService) applyFormNotification(notification *Notification, submission *models.FormSubmission, formConfig config.FormConfig, result *models.ProcessingResult) {
+	settings := formConfig.Notifications
+	outcome := settings.Success
+	if !result.Success {
+		outcome = settings.Failure
+	}
+
+	notification.Topic = settings.Topic
+	if settings.Priority != 0 {
+		notification.Priority = settings.Priority
+	}
+	if outcome.Priority != 0 {
+		notification.Priority = outcome.Priority
+	}
+	if len(settings.Tags) > 0 {
+		notification.Tags = settings.Tags
+	}
+	if len(outcome.Tags) > 0 {
+		notification.Tags = outcome.Tags
+	}
+
+	data := newNotificationTemplateData(submission, formConfig, result, ns.config.Server.PublicURL)
+
+	for _, field := range []struct {
+		name  string
+		text  string
+		value *string
+	}{
+		{"title", outcome.Title, &notification.Title},
+		{"body", outcome.Body, &notification.Message},
+		{"click", settings.Click, &notification.Click},
+	} {
+		if field.text == "" {
+			continue
+		}
+		rendered, err := ns.templates.execute(field.text, data)
+		if err != nil {
+			log.Printf("[NOTIFY] Failed to render notification %s for form %s: %v", field.name, submission.FormID, err)
+			continue
+		}
+		*field.value = strings.TrimSpace(rendered)
+	}
+}
+
+// compileNotificationTemplates parses every form's notification templates, including the admin
+// email subject, and checks their priorities so mistakes are caught at startup
+func compileNotificationTemplates(forms map[string]config.FormConfig) error {
+	for formID, form := range forms {
+		settings := form.Notifications
+
+		templates := map[string]string{
+			"click":         settings.Click,
+			"success.title": settings.Success.Title,
+			"success.body":  settings.Success.Body,
+			"failure.title": settings.Failure.Title,
+			"failure.body":  settings.Failure.Body,
+		}
+		for name, text := range templates {
+			if text == "" {
+				continue
+			}
+			if _, err := parseActionTemplate(text); err != nil {
+				return fmt.Errorf("form '%s' notifications.%s: %w", formID, name, err)
+			}
+		}
+		if subject := form.Email.Admin.Subject; subject != "" {
+			if _, err := parseActionTemplate(subject); err != nil {
+				return fmt.Errorf("form '%s' email.admin.subject: %w", formID, err)
+			}
+		}
+
+		priorities := map[string]int{
+			"priority":         settings.Priority,
+			"success.priority": settings.Success.Priority,
+			"failure.priority": settings.Failure.Priority,
+		}
+		for name, priority := range priorities {
+			if priority < 0 || priority > 5 {
+				return fmt.Errorf("form '%s' notifications.%s must be between 1 and 5", formID, name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+)
+
+// Notifier delivers admin notifications to one channel, such as ntfy or a Discord webhook
+type Notifier interface {
+	// Name returns the channel name forms refer to in notifications.channels (e.g. "discord")
+	Name() string
+	// Send delivers the notification, returning an error if the channel rejected it
+	Send(ctx context.Context, notification *Notification) error
+}
+
+// notifierNames lists the supported channels in the order they are notified
+var notifierNames = []string{"ntfy", "discord", "slack", "matrix", "gotify", "webhook"}
+
+// newNotifiers builds a notifier for every enabled channel, keyed by channel name
+func newNotifiers(cfg config.NotificationConfig) (map[string]Notifier, error) {
+	notifiers := make(map[string]Notifier)
+
+	for _, name := range notifierNames {
+		var notifier Notifier
+		var err error
+
+		switch name {
+		case "ntfy":
+			if !cfg.Ntfy.Enabled {
+				continue
+			}
+			notifier, err = NewNtfyNotifier(cfg.Ntfy)
+		case "discord":
+			if !cfg.Discord.Enabled {
+				continue
+			}
+			notifier, err = NewDiscordNotifier(cfg.Discord)
+		case "slack":
+			if !cfg.Slack.Enabled {
+				continue
+			}
+			notifier, err = NewSlackNotifier(cfg.Slack)
+		case "matrix":
+			if !cfg.Matrix.Enabled {
+				continue
+			}
+			notifier, err = NewMatrixNotifier(cfg.Matrix)
+		case "gotify":
+			if !cfg.Gotify.Enabled {
+				continue
+			}
+			notifier, err = NewGotifyNotifier(cfg.Gotify)
+		case "webhook":
+			if !cfg.Webhook.Enabled {
+				continue
+			}
+			notifier, err = NewWebhookNotifier(cfg.Webhook)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		notifiers[name] = notifier
+	}
+
+	return notifiers, nil
+}
+
+// notificationClient is shared by the HTTP based notifiers
+var notificationClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendNotificationRequest sends body to a channel and treats any 2xx response as delivered
+func sendNotificationRequest(ctx context.Context, channel, method, target string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create %s request: %w", channel, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := notificationClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s notification: %w", channel, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned status %d: %s", channel, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return nil
+}
+
+// ntfyNotifier publishes to an ntfy topic, including HTTP action buttons
+type ntfyNotifier struct {
+	cfg config.NtfyConfig
+}
+
+type NtfyMessage struct {
+	Topic    string       `json:"topic"`
+	Message  string       `json:"message"`
+	Title    string       `json:"title"`
+	Tags     []string     `json:"tags,omitempty"`
+	Priority int          `json:"priority,omitempty"`
+	Actions  []NtfyAction `json:"actions,omitempty"`
+	Click    string       `json:"click,omitempty"`
+	Attach   string       `json:"attach,omitempty"`
+	Filename string       `json:"filename,omitempty"`
+	Email    string       `json:"email,omitempty"`
+	Delay    string       `json:"delay,omitempty"`
+}
+
+type NtfyAction struct {
+	Action string `json:"action"`
+	Label  string `json:"label"`
+	URL    string `json:"url,omitempty"`
+	Method string `json:"method,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+// NewNtfyNotifier returns a notifier publishing to cfg.Topic on the ntfy server at cfg.URL
+func NewNtfyNotifier(cfg config.NtfyConfig) (Notifier, error) {
+	if cfg.URL == "" || cfg.Topic == "" {
+		return nil, fmt.Errorf("ntfy url and topic must be configured")
+	}
+	return &ntfyNotifier{cfg: cfg}, nil
+}
+
+func (n *ntfyNotifier) Name() string {
+	return "ntfy"
+}
+
+func (n *ntfyNotifier) Send(ctx context.Context, notification *Notification) error {
+	topic := n.cfg.Topic
+	if notification.Topic != "" {
+		topic = notification.Topic
+	}
+
+	msg := NtfyMessage{
+		Topic:    topic,
+		Title:    notification.Title,
+		Message:  notification.Message,
+		Tags:     notification.Tags,
+		Priority: notification.Priority,
+		Click:    notification.Click,
+	}
+	for _, action := range notification.Actions {
+		msg.Actions = append(msg.Actions, NtfyAction{
+			Action: "http",
+			Label:  action.Label,
+			URL:    action.URL,
+			Method: action.Method,
+			Body:   action.Body,
+		})
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ntfy message: %w", err)
+	}
+
+	headers := map[string]string{}
+	if n.cfg.Token != "" {
+		headers["Authorization"] = "Bearer " + n.cfg.Token
+	}
+	return sendNotificationRequest(ctx, "ntfy", http.MethodPost, n.cfg.URL, body, headers)
+}
+
+// discordNotifier posts an embed to a Discord channel webhook
+type discordNotifier struct {
+	cfg config.DiscordConfig
+}
+
+type discordMessage struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url,omitempty"`
+	Color       int    `json:"color"`
+}
+
+// NewDiscordNotifier returns a notifier posting to a Discord webhook URL
+func NewDiscordNotifier(cfg config.DiscordConfig) (Notifier, error) {
+	if cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("discord webhook_url must be configured")
+	}
+	return &discordNotifier{cfg: cfg}, nil
+}
+
+func (d *discordNotifier) Name() string {
+	return "discord"
+}
+
+func (d *discordNotifier) Send(ctx context.Context, notification *Notification) error {
+	color := 0x2ecc71
+	if !notification.Success {
+		color = 0xe74c3c
+	}
+
+	body, err := json.Marshal(discordMessage{
+		Username: d.cfg.Username,
+		Embeds: []discordEmbed{{
+			// Discord rejects embeds over its title and description limits
+			Title:       truncateText(notification.Title, 256),
+			Description: truncateText(notification.Message, 4096),
+			URL:         notification.Click,
+			Color:       color,
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal discord message: %w", err)
+	}
+	return sendNotificationRequest(ctx, "discord", http.MethodPost, d.cfg.WebhookURL, body, nil)
+}
+
+// slackNotifier posts to a Slack incoming webhook
+type slackNotifier struct {
+	cfg config.SlackConfig
+}
+
+// NewSlackNotifier returns a notifier posting to a Slack incoming webhook URL
+func NewSlackNotifier(cfg config.SlackConfig) (Notifier, error) {
+	if cfg.WebhookURL == "" {
+		return nil, fmt.Errorf("slack webhook_url must be configured")
+	}
+	return &slackNotifier{cfg: cfg}, nil
+}
+
+func (s *slackNotifier) Name() string {
+	return "slack"
+}
+
+func (s *slackNotifier) Send(ctx context.Context, notification *Notification) error {
+	// Slack reads &, < and > as markup, so they are escaped in user supplied text
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
+
+	text := fmt.Sprintf("*%s*\n%s", escape(notification.Title), escape(notification.Message))
+	if notification.Click != "" {
+		text += fmt.Sprintf("\n<%s|Open the admin dashboard>", notification.Click)
+	}
+
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("failed to marshal slack message: %w", err)
+	}
+	return sendNotificationRequest(ctx, "slack", http.MethodPost, s.cfg.WebhookURL, body, nil)
+}
+
+// matrixNotifier sends a message to a Matrix room through the client-server API
+type matrixNotifier struct {
+	cfg config.MatrixConfig
+}
+
+// NewMatrixNotifier returns a notifier sending to cfg.RoomID on the homeserver at
+// cfg.HomeserverURL. The access token's user must already have joined the room.
+func NewMatrixNotifier(cfg config.MatrixConfig) (Notifier, error) {
+	if cfg.HomeserverURL == "" || cfg.AccessToken == "" || cfg.RoomID == "" {
+		return nil, fmt.Errorf("matrix homeserver_url, access_token and room_id must be configured")
+	}
+	cfg.HomeserverURL = strings.TrimRight(cfg.HomeserverURL, "/")
+	return &matrixNotifier{cfg: cfg}, nil
+}
+
+func (m *matrixNotifier) Name() string {
+	return "matrix"
+}
+
+func (m *matrixNotifier) Send(ctx context.Context, notification *Notification) error {
+	plain := notification.Title + "\n\n" + notification.Message
+	formatted := fmt.Sprintf("<strong>%s</strong><br><br>%s",
+		html.EscapeString(notification.Title),
+		strings.ReplaceAll(html.EscapeString(notification.Message), "\n", "<br>"))
+	if notification.Click != "" {
+		plain += "\n" + notification.Click
+		formatted += fmt.Sprintf(`<br><a href="%s">Open the admin dashboard</a>`, html.EscapeString(notification.Click))
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"msgtype":        "m.text",
+		"body":           plain,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal matrix message: %w", err)
+	}
+
+	// The homeserver treats a repeated transaction ID as a retry of the same event, so outbox
+	// retries reuse the notification's key instead of posting it again
+	txnID := notification.IdempotencyKey
+	if txnID == "" {
+		txnID = uuid.New().String()
+	}
+	target := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		m.cfg.HomeserverURL, url.PathEscape(m.cfg.RoomID), url.PathEscape(txnID))
+	headers := map[string]string{"Authorization": "Bearer " + m.cfg.AccessToken}
+	return sendNotificationRequest(ctx, "matrix", http.MethodPut, target, body, headers)
+}
+
+// gotifyNotifier pushes a message to a Gotify server
+type gotifyNotifier struct {
+	cfg config.GotifyConfig
+}
+
+// NewGotifyNotifier returns a notifier pushing to the Gotify server at cfg.URL with an
+// application token
+func NewGotifyNotifier(cfg config.GotifyConfig) (Notifier, error) {
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil, fmt.Errorf("gotify url and token must be configured")
+	}
+	cfg.URL = strings.TrimRight(cfg.URL, "/")
+	return &gotifyNotifier{cfg: cfg}, nil
+}
+
+func (g *gotifyNotifier) Name() string {
+	return "gotify"
+}
+
+func (g *gotifyNotifier) Send(ctx context.Context, notification *Notification) error {
+	msg := map[string]interface{}{
+		"title":   notification.Title,
+		"message": notification.Message,
+		// Gotify priorities run from 0 to 10, ntfy's from 1 to 5
+		"priority": notification.Priority*2 - 1,
+	}
+	if notification.Click != "" {
+		msg["extras"] = map[string]interface{}{
+			"client::notification": map[string]interface{}{
+				"click": map[string]string{"url": notification.Click},
+			},
+		}
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal gotify message: %w", err)
+	}
+	headers := map[string]string{"X-Gotify-Key": g.cfg.Token}
+	return sendNotificationRequest(ctx, "gotify", http.MethodPost, g.cfg.URL+"/message", body, headers)
+}
+
+// webhookNotifier posts the notification as JSON to any endpoint
+type webhookNotifier struct {
+	cfg config.NotificationWebhookConfig
+}
+
+// NotificationWebhookPayload is the body posted by the webhook notification channel
+type NotificationWebhookPayload struct {
+	Event        string               `json:"event"`
+	Title        string               `json:"title"`
+	Message      string               `json:"message"`
+	Tags         []string             `json:"tags,omitempty"`
+	Priority     int                  `json:"priority"`
+	Success      bool                 `json:"success"`
+	FormID       string               `json:"form_id,omitempty"`
+	SubmissionID string               `json:"submission_id,omitempty"`
+	Click        string               `json:"click,omitempty"`
+	Actions      []NotificationAction `json:"actions,omitempty"`
+	SentAt       time.Time            `json:"sent_at"`
+}
+
+// NewWebhookNotifier returns a notifier posting JSON to cfg.URL, signed when cfg.Secret is set
+func NewWebhookNotifier(cfg config.NotificationWebhookConfig) (Notifier, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("notification webhook url must be configured")
+	}
+	return &webhookNotifier{cfg: cfg}, nil
+}
+
+func (w *webhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (w *webhookNotifier) Send(ctx context.Context, notification *Notification) error {
+	body, err := json.Marshal(NotificationWebhookPayload{
+		Event:        "notification",
+		Title:        notification.Title,
+		Message:      notification.Message,
+		Tags:         notification.Tags,
+		Priority:     notification.Priority,
+		Success:      notification.Success,
+		FormID:       notification.FormID,
+		SubmissionID: notification.SubmissionID,
+		Click:        notification.Click,
+		Actions:      notification.Actions,
+		SentAt:       time.Now().UTC(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook notification: %w", err)
+	}
+
+	headers := map[string]string{
+		"User-Agent":       "PinePods-Forms-Webhook/1.0",
+		"X-Pinepods-Event": "notification",
+	}
+	for key, value := range w.cfg.Headers {
+		headers[key] = value
+	}
+	if w.cfg.Secret != "" {
+		headers["X-Pinepods-Signature"] = "sha256=" + signPayload(w.cfg.Secret, body)
+	}
+	return sendNotificationRequest(ctx, "webhook", http.MethodPost, w.cfg.URL, body, headers)
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+)
+
+// recordedRequest is a request received by a notification channel stub
+type recordedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   map[string]interface{}
+	raw    []byte
+}
+
+// newNotifierStub returns a channel endpoint answering with status and the requests it received
+func newNotifierStub(t *testing.T, status int) (*httptest.Server, *[]recordedRequest) {
+	t.Helper()
+
+	var requests []recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		request := recordedRequest{method: r.Method, path: r.URL.EscapedPath(), header: r.Header, raw: raw}
+		if err := json.Unmarshal(raw, &request.body); err != nil {
+			t.Errorf("%s %s body isn't a JSON object: %v", r.Method, r.URL.Path, err)
+		}
+		requests = append(requests, request)
+
+		w.WriteHeader(status)
+		if status >= 300 {
+			io.WriteString(w, `{"error": "rejected"}`)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestNotification() *Notification {
+	return &Notification{
+		Title:          "New submission: Contact <form>",
+		Message:        "Name: Jane & co\nMessage: Hello",
+		Tags:           []string{"white_check_mark"},
+		Priority:       3,
+		Success:        false,
+		FormID:         "contact-form",
+		SubmissionID:   "sub-1",
+		Click:          "https://forms.example.com/admin",
+		Actions:        []NotificationAction{{Label: "Approve", URL: "https://forms.example.com/approve", Method: "POST"}},
+		IdempotencyKey: "outbox-1",
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	tests := []struct {
+		name     string
+		notifier func(url string) (Notifier, error)
+		check    func(t *testing.T, request recordedRequest)
+	}{
+		{
+			name: "ntfy",
+			notifier: func(url string) (Notifier, error) {
+				return NewNtfyNotifier(config.NtfyConfig{URL: url, Topic: "forms", Token: "ntfy-token"})
+			},
+			check: func(t *testing.T, request recordedRequest) {
+				if request.header.Get("Authorization") != "Bearer ntfy-token" {
+					t.Errorf("Authorization = %q, want the ntfy token", request.header.Get("Authorization"))
+				}
+				actions, _ := request.body["actions"].([]interface{})
+				if request.body["topic"] != "forms" || request.body["priority"] != 3.0 || len(actions) != 1 {
+					t.Errorf("body = %v, want the topic, priority and one action", request.body)
+				}
+			},
+		},
+		{
+			name: "discord",
+			notifier: func(url string) (Notifier, error) {
+				return NewDiscordNotifier(config.DiscordConfig{WebhookURL: url + "/api/webhooks/1/abc", Username: "Forms"})
+			},
+			check: func(t *testing.T, request recordedRequest) {
+				embeds, _ := request.body["embeds"].([]interface{})
+				if request.path != "/api/webhooks/1/abc" || request.body["username"] != "Forms" || len(embeds) != 1 {
+					t.Fatalf("request = %s %v, want one embed posted to the webhook", request.path, request.body)
+				}
+				embed := embeds[0].(map[string]interface{})
+				// Failures are red
+				if embed["color"] != float64(0xe74c3c) || embed["url"] != "https://forms.example.com/admin" {
+					t.Errorf("embed = %v, want a red embed linking to the dashboard", embed)
+				}
+			},
+		},
+		{
+			name: "slack",
+			notifier: func(url string) (Notifier, error) {
+				return NewSlackNotifier(config.SlackConfig{WebhookURL: url + "/services/T/B/X"})
+			},
+			check: func(t *testing.T, request recordedRequest) {
+				text, _ := request.body["text"].(string)
+				// User supplied text can't inject Slack markup
+				want := "*New submission: Contact &lt;form&gt;*\nName: Jane &amp; co\nMessage: Hello\n<https://forms.example.com/admin|Open the admin dashboard>"
+				if text != want {
+					t.Errorf("text = %q, want %q", text, want)
+				}
+			},
+		},
+		{
+			name: "matrix",
+			notifier: func(url string) (Notifier, error) {
+				return NewMatrixNotifier(config.MatrixConfig{HomeserverURL: url + "/", AccessToken: "matrix-token", RoomID: "!room:example.com"})
+			},
+			check: func(t *testing.T, request recordedRequest) {
+				// Retries reuse the outbox row's transaction ID, so the homeserver drops duplicates
+				if request.method != http.MethodPut || request.path != "/_matrix/client/v3/rooms/%21room:example.com/send/m.room.message/outbox-1" {
+					t.Errorf("request = %s %s, want a PUT with the idempotency key as transaction ID", request.method, request.path)
+				}
+				if request.header.Get("Authorization") != "Bearer matrix-token" {
+					t.Errorf("Authorization = %q, want the access token", request.header.Get("Authorization"))
+				}
+				formatted, _ := request.body["formatted_body"].(string)
+				if !strings.Contains(formatted, "Contact &lt;form&gt;") || !strings.Contains(formatted, "Jane &amp; co<br>Message") {
+					t.Errorf("formatted_body = %q, want escaped HTML with line breaks", formatted)
+				}
+			},
+		},
+		{
+			name: "gotify",
+			notifier: func(url string) (Notifier, error) {
+				return NewGotifyNotifier(config.GotifyConfig{URL: url + "/", Token: "gotify-token"})
+			},
+			check: func(t *testing.T, request recordedRequest) {
+				if request.path != "/message" || request.header.Get("X-Gotify-Key") != "gotify-token" {
+					t.Errorf("request = %s with key %q, want /message with the app token", request.path, request.header.Get("X-Gotify-Key"))
+				}
+				// ntfy's priority 3 of 5 is Gotify's 5 of 10
+				if request.body["priority"] != 5.0 || request.body["extras"] == nil {
+					t.Errorf("body = %v, want priority 5 and a click URL", request.body)
+				}
+			},
+		},
+		{
+			name: "webhook",
+			notifier: func(url string) (Notifier, error) {
+				return NewWebhookNotifier(config.NotificationWebhookConfig{URL: url + "/notify", Secret: "s3cret", Headers: map[string]string{"X-Token": "abc"}})
+			},
+			check: func(t *testing.T, request recordedRequest) {
+				if signature := request.header.Get("X-Pinepods-Signature"); signature != "sha256="+signPayload("s3cret", request.raw) {
+					t.Errorf("X-Pinepods-Signature = %q, want the HMAC of the body", signature)
+				}
+				if request.header.Get("X-Token") != "abc" || request.header.Get("X-Pinepods-Event") != "notification" {
+					t.Errorf("headers = %v, want the configured header and the event", request.header)
+				}
+				if request.body["submission_id"] != "sub-1" || request.body["form_id"] != "contact-form" || request.body["success"] != false {
+					t.Errorf("body = %v, want the submission and its outcome", request.body)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := newNotifierStub(t, http.StatusOK)
+			notifier, err := tt.notifier(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if notifier.Name() != tt.name {
+				t.Errorf("Name() = %q, want %q", notifier.Name(), tt.name)
+			}
+
+			if err := notifier.Send(context.Background(), newTestNotification()); err != nil {
+				t.Fatalf("Send failed: %v", err)
+			}
+			if len(*requests) != 1 {
+				t.Fatalf("channel received %d requests, want 1", len(*requests))
+			}
+			request := (*requests)[0]
+			if request.header.Get("Content-Type") != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", request.header.Get("Content-Type"))
+			}
+			tt.check(t, request)
+		})
+	}
+}
+
+func TestNotifierRejected(t *testing.T) {
+	server, _ := newNotifierStub(t, http.StatusForbidden)
+	notifier, err := NewDiscordNotifier(config.DiscordConfig{WebhookURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = notifier.Send(context.Background(), newTestNotification())
+	if err == nil || !strings.Contains(err.Error(), `discord returned status 403: {"error": "rejected"}`) {
+		t.Errorf("Send error = %v, want the status and response", err)
+	}
+}
+
+func TestNewNotifiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.NotificationConfig
+		want    []string
+		wantErr string
+	}{
+		{"none enabled", config.NotificationConfig{Discord: config.DiscordConfig{WebhookURL: "https://discord.example"}}, nil, ""},
+		{
+			name: "enabled channels",
+			cfg: config.NotificationConfig{
+				Slack:  config.SlackConfig{Enabled: true, WebhookURL: "https://hooks.slack.example"},
+				Gotify: config.GotifyConfig{Enabled: true, URL: "https://gotify.example", Token: "t"},
+			},
+			want: []string{"gotify", "slack"},
+		},
+		{"discord without url", config.NotificationConfig{Discord: config.DiscordConfig{Enabled: true}}, nil, "discord webhook_url"},
+		{"matrix without room", config.NotificationConfig{Matrix: config.MatrixConfig{Enabled: true, HomeserverURL: "https://matrix.example", AccessToken: "t"}}, nil, "room_id"},
+		{"gotify without token", config.NotificationConfig{Gotify: config.GotifyConfig{Enabled: true, URL: "https://gotify.example"}}, nil, "gotify url and token"},
+		{"webhook without url", config.NotificationConfig{Webhook: config.NotificationWebhookConfig{Enabled: true}}, nil, "webhook url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifiers, err := newNotifiers(tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("newNotifiers error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newNotifiers failed: %v", err)
+			}
+			if len(notifiers) != len(tt.want) {
+				t.Fatalf("built %d notifiers, want %v", len(notifiers), tt.want)
+			}
+			for _, name := range tt.want {
+				if _, exists := notifiers[name]; !exists {
+					t.Errorf("no %s notifier was built", name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+const quotaWindow = time.Hour
+
+// QuotaExceededError is returned when a form's hourly submission quota has been used up
+type QuotaExceededError struct {
+	FormID     string
+	Scope      string // "ip" or "email"
+	Limit      int
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("submission limit of %d per hour per %s reached for form '%s'", e.Limit, e.Scope, e.FormID)
+}
+
+// RetryAfterSeconds returns the wait time rounded up to whole seconds, as used in the Retry-After header
+func (e *QuotaExceededError) RetryAfterSeconds() int {
+	seconds := int((e.RetryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// sqlQueryer runs a query on a database or inside a transaction
+type sqlQueryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// storeSubmissionWithinQuota checks the form's quotas and stores the submission in one
+// transaction, so two concurrent submissions can't both take the last slot. Postgres has
+// nothing to serialise the count with the insert, so the transaction takes an advisory lock
+// per form first; SQLite runs on a single connection and already serialises them.
+func (fs *FormService) storeSubmissionWithinQuota(submission *models.FormSubmission, formConfig config.FormConfig) error {
+	tx, err := fs.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to store submission: %w", err)
+	}
+	defer tx.Rollback()
+
+	limited := formConfig.Validation.MaxSubmissionsPerHour > 0 || formConfig.Validation.MaxSubmissionsPerHourPerEmail > 0
+	if limited && fs.config.Database.Type == "postgres" {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, "submission_quota:"+submission.FormID); err != nil {
+			return fmt.Errorf("failed to lock submission quota: %w", err)
+		}
+	}
+
+	if err := fs.checkSubmissionQuota(tx, submission, formConfig); err != nil {
+		return err
+	}
+	if err := fs.storeSubmission(tx, submission); err != nil {
+		return fmt.Errorf("failed to store submission: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to store submission: %w", err)
+	}
+	return nil
+}
+
+// checkSubmissionQuota enforces the form's per-IP and per-email hourly limits. Counts come
+// from the form_submissions table so quotas survive restarts.
+func (fs *FormService) checkSubmissionQuota(query sqlQueryer, submission *models.FormSubmission, formConfig config.FormConfig) error {
+	since := submission.SubmittedAt.Add(-quotaWindow)
+
+	if limit := formConfig.Validation.MaxSubmissionsPerHour; limit > 0 && submission.IPAddress != "" {
+		where := `form_id = ? AND ip_address = ? AND submitted_at > ?`
+		if fs.config.Database.Type == "postgres" {
+			where = `form_id = $1 AND ip_address = $2 AND submitted_at > $3`
+		}
+
+		if err := checkQuota(query, where, submission, "ip", limit, submission.FormID, submission.IPAddress, since); err != nil {
+			return err
+		}
+	}
+
+	if limit := formConfig.Validation.MaxSubmissionsPerHourPerEmail; limit > 0 {
+		emailField := quotaEmailField(formConfig)
+		email, _ := submission.Data[emailField].(string)
+		email = strings.TrimSpace(email)
+		if email == "" {
+			return nil
+		}
+
+		where := `form_id = ? AND LOWER(json_extract(data, ?)) = LOWER(?) AND submitted_at > ?`
+		fieldArg := "$." + emailField
+		if fs.config.Database.Type == "postgres" {
+			where = `form_id = $1 AND LOWER(data->>$2) = LOWER($3) AND submitted_at > $4`
+			fieldArg = emailField
+		}
+
+		if err := checkQuota(query, where, submission, "email", limit, submission.FormID, fieldArg, email, since); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func checkQuota(query sqlQueryer, where string, submission *models.FormSubmission, scope string, limit int, args ...interface{}) error {
+	var count int
+	if err := query.QueryRow(`SELECT COUNT(*) FROM form_submissions WHERE `+where, args...).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check submission quota: %w", err)
+	}
+
+	if count < limit {
+		return nil
+	}
+
+	// The quota frees up once the oldest submission inside the window ages out
+	retryAfter := quotaWindow
+	var oldest sql.NullTime
+	err := query.QueryRow(`SELECT submitted_at FROM form_submissions WHERE `+where+` ORDER BY submitted_at ASC LIMIT 1`, args...).Scan(&oldest)
+	if err == nil && oldest.Valid {
+		retryAfter = oldest.Time.Add(quotaWindow).Sub(submission.SubmittedAt)
+	}
+
+	return &QuotaExceededError{
+		FormID:     submission.FormID,
+		Scope:      scope,
+		Limit:      limit,
+		RetryAfter: retryAfter,
+	}
+}
+
+// quotaEmailField returns the name of the form's first email field, defaulting to "email"
+func quotaEmailField(formConfig config.FormConfig) string {
+	for _, field := range formConfig.Fields {
+		if field.Type == "email" {
+			return field.Name
+		}
+	}
+	return "email"
+}
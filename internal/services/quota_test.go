@@ -0,0 +1,201 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// newSubmissionTestService returns a FormService with the submissions table in an in-memory
+// SQLite database
+func newSubmissionTestService(t *testing.T) *FormService {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{}
+	cfg.Database.Type = "sqlite"
+
+	fs := &FormService{config: cfg, db: db}
+	if err := fs.createTables(); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func newQuotaTestSubmission(ip, email string, submittedAt time.Time) *models.FormSubmission {
+	return &models.FormSubmission{
+		ID:          fmt.Sprintf("sub-%d", submittedAt.UnixNano()),
+		FormID:      "contact-form",
+		Data:        map[string]interface{}{"contact": email},
+		IPAddress:   ip,
+		SubmittedAt: submittedAt,
+	}
+}
+
+func TestStoreSubmissionWithinQuota(t *testing.T) {
+	formConfig := config.FormConfig{
+		Fields: []config.FieldConfig{{Name: "contact", Type: "email"}},
+		Validation: config.ValidationConfig{
+			MaxSubmissionsPerHour:         3,
+			MaxSubmissionsPerHourPerEmail: 2,
+		},
+	}
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		stored     []*models.FormSubmission
+		submission *models.FormSubmission
+		wantScope  string        // "" when the submission is accepted
+		wantRetry  time.Duration // Checked when the submission is rejected
+	}{
+		{
+			name:       "first submission",
+			submission: newQuotaTestSubmission("192.0.2.1", "a@example.com", now),
+		},
+		{
+			name: "ip limit reached",
+			stored: []*models.FormSubmission{
+				newQuotaTestSubmission("192.0.2.1", "a@example.com", now.Add(-50*time.Minute)),
+				newQuotaTestSubmission("192.0.2.1", "b@example.com", now.Add(-20*time.Minute)),
+				newQuotaTestSubmission("192.0.2.1", "c@example.com", now.Add(-10*time.Minute)),
+			},
+			submission: newQuotaTestSubmission("192.0.2.1", "d@example.com", now),
+			wantScope:  "ip",
+			wantRetry:  10 * time.Minute,
+		},
+		{
+			name: "other ip",
+			stored: []*models.FormSubmission{
+				newQuotaTestSubmission("192.0.2.1", "a@example.com", now.Add(-50*time.Minute)),
+				newQuotaTestSubmission("192.0.2.1", "b@example.com", now.Add(-20*time.Minute)),
+				newQuotaTestSubmission("192.0.2.1", "c@example.com", now.Add(-10*time.Minute)),
+			},
+			submission: newQuotaTestSubmission("192.0.2.2", "d@example.com", now),
+		},
+		{
+			name: "old submissions age out",
+			stored: []*models.FormSubmission{
+				newQuotaTestSubmission("192.0.2.1", "a@example.com", now.Add(-3*time.Hour)),
+				newQuotaTestSubmission("192.0.2.1", "b@example.com", now.Add(-2*time.Hour)),
+				newQuotaTestSubmission("192.0.2.1", "c@example.com", now.Add(-61*time.Minute)),
+			},
+			submission: newQuotaTestSubmission("192.0.2.1", "d@example.com", now),
+		},
+		{
+			name: "email limit ignores case",
+			stored: []*models.FormSubmission{
+				newQuotaTestSubmission("192.0.2.1", "Tester@Example.com", now.Add(-30*time.Minute)),
+				newQuotaTestSubmission("192.0.2.2", "tester@example.com", now.Add(-15*time.Minute)),
+			},
+			submission: newQuotaTestSubmission("192.0.2.3", " TESTER@example.com ", now),
+			wantScope:  "email",
+			wantRetry:  30 * time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newSubmissionTestService(t)
+			for _, submission := range tt.stored {
+				if err := fs.storeSubmission(fs.db, submission); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := fs.storeSubmissionWithinQuota(tt.submission, formConfig)
+
+			var count int
+			if err := fs.db.QueryRow(`SELECT COUNT(*) FROM form_submissions WHERE id = ?`, tt.submission.ID).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantScope == "" {
+				if err != nil {
+					t.Fatalf("storeSubmissionWithinQuota failed: %v", err)
+				}
+				if count != 1 {
+					t.Errorf("accepted submission stored %d times, want once", count)
+				}
+				return
+			}
+
+			var quotaErr *QuotaExceededError
+			if !errors.As(err, &quotaErr) {
+				t.Fatalf("storeSubmissionWithinQuota error = %v, want a QuotaExceededError", err)
+			}
+			if quotaErr.Scope != tt.wantScope || quotaErr.RetryAfter != tt.wantRetry {
+				t.Errorf("quota error = %s after %s, want %s after %s", quotaErr.Scope, quotaErr.RetryAfter, tt.wantScope, tt.wantRetry)
+			}
+			if count != 0 {
+				t.Errorf("rejected submission was stored")
+			}
+		})
+	}
+}
+
+func TestStoreSubmissionWithinQuotaConcurrent(t *testing.T) {
+	fs := newSubmissionTestService(t)
+	formConfig := config.FormConfig{Validation: config.ValidationConfig{MaxSubmissionsPerHour: 3}}
+	now := time.Now().UTC()
+
+	// The count and the insert share a transaction, so the last slot can only be taken once
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			submission := newQuotaTestSubmission("192.0.2.1", "", now.Add(time.Duration(i)*time.Millisecond))
+			errs[i] = fs.storeSubmissionWithinQuota(submission, formConfig)
+		}(i)
+	}
+	wg.Wait()
+
+	accepted, limited := 0, 0
+	for _, err := range errs {
+		var quotaErr *QuotaExceededError
+		switch {
+		case err == nil:
+			accepted++
+		case errors.As(err, &quotaErr):
+			limited++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if accepted != 3 || limited != 7 {
+		t.Errorf("accepted %d and limited %d submissions, want 3 and 7", accepted, limited)
+	}
+}
+
+func TestQuotaExceededErrorRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		want       int
+	}{
+		{10 * time.Minute, 600},
+		{1500 * time.Millisecond, 2},
+		{0, 1},
+		{-time.Second, 1},
+	}
+
+	for _, tt := range tests {
+		err := &QuotaExceededError{RetryAfter: tt.retryAfter}
+		if got := err.RetryAfterSeconds(); got != tt.want {
+			t.Errorf("RetryAfterSeconds() for %s = %d, want %d", tt.retryAfter, got, tt.want)
+		}
+	}
+}
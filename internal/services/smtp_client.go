@@ -0,0 +1,286 @@
+package services
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+)
+
+// smtpPool delivers messages over SMTP, keeping up to PoolSize idle connections open so bulk
+// sends such as admin notifications to several recipients don't repeat the TLS and AUTH
+// handshake for every message
+type smtpPool struct {
+	config      config.SMTPConfig
+	dialTimeout time.Duration
+	sendTimeout time.Duration
+	idleTimeout time.Duration
+
+	mu   sync.Mutex
+	idle []*smtpConn
+}
+
+// smtpConn is an authenticated connection ready for its next message
+type smtpConn struct {
+	client   *smtp.Client
+	conn     net.Conn
+	lastUsed time.Time
+}
+
+var (
+	smtpPoolsMu sync.Mutex
+	smtpPools   = make(map[config.SMTPConfig]*smtpPool)
+)
+
+// smtpPoolFor returns the pool for cfg. Pools are shared so every EmailService reuses the same
+// connections.
+func smtpPoolFor(cfg config.SMTPConfig) *smtpPool {
+	smtpPoolsMu.Lock()
+	defer smtpPoolsMu.Unlock()
+
+	pool, exists := smtpPools[cfg]
+	if !exists {
+		pool = &smtpPool{
+			config:      cfg,
+			dialTimeout: parseDurationOr(cfg.DialTimeout, 10*time.Second),
+			sendTimeout: parseDurationOr(cfg.SendTimeout, 30*time.Second),
+			idleTimeout: parseDurationOr(cfg.PoolIdleTimeout, 30*time.Second),
+		}
+		smtpPools[cfg] = pool
+	}
+	return pool
+}
+
+// send delivers msg from the envelope sender to the recipients
+func (p *smtpPool) send(from string, to []string, msg []byte) error {
+	conn, err := p.get()
+	if err != nil {
+		return err
+	}
+
+	err = p.deliver(conn, from, to, msg)
+	if err != nil {
+		// A rejected sender or recipient leaves the connection usable; anything else may not
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && conn.client.Reset() == nil {
+			p.put(conn)
+		} else {
+			conn.client.Close()
+		}
+		return err
+	}
+
+	p.put(conn)
+	return nil
+}
+
+func (p *smtpPool) deliver(conn *smtpConn, from string, to []string, msg []byte) error {
+	conn.conn.SetDeadline(time.Now().Add(p.sendTimeout))
+
+	if err := conn.client.Mail(from); err != nil {
+		return rejectedMessage(err)
+	}
+	for _, recipient := range to {
+		if err := conn.client.Rcpt(recipient); err != nil {
+			return rejectedMessage(err)
+		}
+	}
+	w, err := conn.client.Data()
+	if err != nil {
+		return rejectedMessage(err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return rejectedMessage(w.Close())
+}
+
+// smtpRejectedError is the server's answer refusing one message's sender, recipient or content,
+// as opposed to a failure to connect or authenticate that affects every message
+type smtpRejectedError struct {
+	reply *textproto.Error
+}
+
+func (e *smtpRejectedError) Error() string {
+	return e.reply.Error()
+}
+
+func (e *smtpRejectedError) Unwrap() error {
+	return e.reply
+}
+
+// rejectedMessage marks an SMTP reply to MAIL, RCPT or DATA as a rejection of the message
+func rejectedMessage(err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		return &smtpRejectedError{protoErr}
+	}
+	return err
+}
+
+// get returns an idle connection that still answers, or dials a new one
+func (p *smtpPool) get() (*smtpConn, error) {
+	for {
+		p.mu.Lock()
+		if len(p.idle) == 0 {
+			p.mu.Unlock()
+			return p.dial()
+		}
+		conn := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		p.mu.Unlock()
+
+		if time.Since(conn.lastUsed) > p.idleTimeout {
+			conn.client.Quit()
+			continue
+		}
+		// The server may have closed the connection since it was last used
+		conn.conn.SetDeadline(time.Now().Add(p.dialTimeout))
+		if err := conn.client.Noop(); err != nil {
+			conn.client.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// put returns a connection to the pool, closing it when the pool is full
+func (p *smtpPool) put(conn *smtpConn) {
+	conn.lastUsed = time.Now()
+
+	p.mu.Lock()
+	if len(p.idle) < p.config.PoolSize {
+		p.idle = append(p.idle, conn)
+		p.mu.Unlock()
+		return
+	}
+	p.mu.Unlock()
+	conn.client.Quit()
+}
+
+// dial connects to the server and completes the TLS and AUTH handshake
+func (p *smtpPool) dial() (*smtpConn, error) {
+	cfg := p.config
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	dialer := &net.Dialer{Timeout: p.dialTimeout}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, InsecureSkipVerify: cfg.InsecureSkipVerify}
+
+	mode := cfg.TLS
+	if mode == "" && cfg.Port == 465 {
+		mode = "implicit"
+	}
+
+	var conn net.Conn
+	var err error
+	if mode == "implicit" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(p.sendTimeout))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SMTP session with %s: %w", addr, err)
+	}
+
+	if mode == "" || mode == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				client.Close()
+				return nil, fmt.Errorf("SMTP STARTTLS failed: %w", err)
+			}
+		} else if mode == "starttls" {
+			client.Close()
+			return nil, fmt.Errorf("SMTP server %s does not support STARTTLS, which email.smtp.tls requires", addr)
+		}
+	}
+
+	auth, err := smtpAuth(cfg)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("SMTP server %s does not support authentication", addr)
+		}
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	return &smtpConn{client: client, conn: conn}, nil
+}
+
+// smtpAuth returns the configured auth mechanism, or nil when no username is set. MailHog and
+// other test servers need no authentication.
+func smtpAuth(cfg config.SMTPConfig) (smtp.Auth, error) {
+	if cfg.Username == "" || cfg.Password == "" {
+		return nil, nil
+	}
+	switch strings.ToLower(cfg.Auth) {
+	case "", "plain":
+		return smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host), nil
+	case "login":
+		return &loginAuth{username: cfg.Username, password: cfg.Password, host: cfg.Host}, nil
+	case "cram-md5":
+		return smtp.CRAMMD5Auth(cfg.Username, cfg.Password), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported SMTP auth mechanism: %s", cfg.Auth)
+	}
+}
+
+// loginAuth implements the LOGIN mechanism still required by some Microsoft and older servers.
+// Like smtp.PlainAuth it refuses to send the password over an unencrypted connection, except to
+// localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalSMTPHost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(string(fromServer))
+	switch {
+	case strings.Contains(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.Contains(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN prompt %q", fromServer)
+	}
+}
+
+func isLocalSMTPHost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// Score added by each spam signal. The default threshold is 1.0, so a filled honeypot field
+// is enough on its own while the softer signals need to be combined.
+const (
+	defaultSpamThreshold = 1.0
+
+	spamScoreHoneypot      = 1.0
+	spamScoreTooFast       = 0.6
+	spamScoreMissingRender = 0.3
+	spamScoreTooManyLinks  = 0.4
+	spamScoreKeyword       = 0.5
+	spamScoreRepeated      = 0.5
+
+	// Render tokens older than this are treated as invalid, so a token scraped once can't be
+	// reused to pass the min_submit_seconds check forever
+	renderTokenMaxAge = 24 * time.Hour
+)
+
+var linkPattern = regexp.MustCompile(`(?i)https?://|www\.`)
+var whitespacePattern = regexp.MustCompile(`\s+`)
+
+// spamVerdict is the outcome of scoring a submission
+type spamVerdict struct {
+	Score       float64
+	Reasons     []string
+	ContentHash string
+	Spam        bool
+}
+
+func (v *spamVerdict) add(score float64, reason string) {
+	v.Score += score
+	v.Reasons = append(v.Reasons, reason)
+}
+
+// scoreSpam combines the form's configured spam signals into a score. Honeypot fields are
+// removed from the submission data so they are never stored or forwarded to actions.
+func (fs *FormService) scoreSpam(submission *models.FormSubmission, formConfig config.FormConfig) (*spamVerdict, error) {
+	spamConfig := formConfig.Spam
+	verdict := &spamVerdict{}
+
+	if !spamConfig.Enabled {
+		return verdict, nil
+	}
+
+	// Honeypot fields are hidden from humans, so any value means a bot filled them in
+	for _, field := range spamConfig.HoneypotFields {
+		if value, exists := submission.Data[field]; exists {
+			if str := strings.TrimSpace(fmt.Sprintf("%v", value)); str != "" && str != "<nil>" {
+				verdict.add(spamScoreHoneypot, fmt.Sprintf("honeypot field '%s' was filled in", field))
+			}
+			delete(submission.Data, field)
+		}
+	}
+
+	verdict.ContentHash = contentHash(submission, formConfig)
+
+	// Time between the form being rendered and submitted
+	if spamConfig.MinSubmitSeconds > 0 {
+		renderedAt, err := fs.verifyRenderToken(submission.RenderToken, submission.FormID, submission.SubmittedAt)
+		if err != nil {
+			verdict.add(spamScoreMissingRender, "missing or invalid render token")
+		} else if elapsed := submission.SubmittedAt.Sub(renderedAt); elapsed < time.Duration(spamConfig.MinSubmitSeconds)*time.Second {
+			verdict.add(spamScoreTooFast, fmt.Sprintf("submitted %.1fs after the form was rendered", elapsed.Seconds()))
+		}
+	}
+
+	text := strings.ToLower(submissionText(submission))
+
+	if spamConfig.MaxLinks > 0 {
+		if links := len(linkPattern.FindAllString(text, -1)); links > spamConfig.MaxLinks {
+			verdict.add(spamScoreTooManyLinks, fmt.Sprintf("contains %d links (max %d)", links, spamConfig.MaxLinks))
+		}
+	}
+
+	for _, keyword := range spamConfig.BlockedKeywords {
+		if keyword != "" && strings.Contains(text, strings.ToLower(keyword)) {
+			verdict.add(spamScoreKeyword, fmt.Sprintf("contains blocked keyword '%s'", keyword))
+		}
+	}
+
+	if verdict.ContentHash != "" {
+		// repeat_window is checked by Config.Validate
+		window := parseDurationOr(spamConfig.RepeatWindow, 24*time.Hour)
+
+		repeats, err := fs.countRepeatedContent(submission.FormID, verdict.ContentHash, submission.SubmittedAt.Add(-window))
+		if err != nil {
+			return nil, err
+		}
+		if repeats > 0 {
+			verdict.add(spamScoreRepeated, fmt.Sprintf("same content submitted %d time(s) before", repeats))
+		}
+	}
+
+	threshold := spamConfig.Threshold
+	if threshold <= 0 {
+		threshold = defaultSpamThreshold
+	}
+	verdict.Spam = verdict.Score >= threshold
+
+	return verdict, nil
+}
+
+func (fs *FormService) countRepeatedContent(formID, hash string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM form_submissions WHERE form_id = ? AND content_hash = ? AND submitted_at > ?`
+	if fs.config.Database.Type == "postgres" {
+		query = `SELECT COUNT(*) FROM form_submissions WHERE form_id = $1 AND content_hash = $2 AND submitted_at > $3`
+	}
+
+	var count int
+	if err := fs.db.QueryRow(query, formID, hash, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to check for repeated content: %w", err)
+	}
+	return count, nil
+}
+
+// contentHash fingerprints the free-text fields of a submission, ignoring case and whitespace,
+// so the same message sent again with a different name or email is still recognised
+func contentHash(submission *models.FormSubmission, formConfig config.FormConfig) string {
+	var parts []string
+	for _, field := range formConfig.Fields {
+		if field.Type != "text" && field.Type != "textarea" {
+			continue
+		}
+		if str, ok := submission.Data[field.Name].(string); ok {
+			normalized := whitespacePattern.ReplaceAllString(strings.ToLower(strings.TrimSpace(str)), " ")
+			if normalized != "" {
+				parts = append(parts, field.Name+"="+normalized)
+			}
+		}
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+
+	sort.Strings(parts)
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// submissionText joins every string value of a submission for keyword and link checks
+func submissionText(submission *models.FormSubmission) string {
+	var parts []string
+	for _, value := range submission.Data {
+		if str, ok := value.(string); ok {
+			parts = append(parts, str)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// NewRenderToken returns a signed token recording when a form was rendered. Clients send it back
+// as render_token so the time taken to fill in the form can be checked.
+func (fs *FormService) NewRenderToken(formID string) string {
+	payload := fmt.Sprintf("%s.%d", formID, time.Now().UTC().Unix())
+	return payload + "." + signPayload(fs.config.Server.SecretKey, []byte(payload))
+}
+
+// verifyRenderToken returns when the form was rendered. Tokens rendered more than renderTokenMaxAge
+// before now, or in the future, are rejected.
+func (fs *FormService) verifyRenderToken(token, formID string, now time.Time) (time.Time, error) {
+	index := strings.LastIndex(token, ".")
+	if index < 0 {
+		return time.Time{}, fmt.Errorf("malformed render token")
+	}
+
+	payload, signature := token[:index], token[index+1:]
+	if !verifySignature(fs.config.Server.SecretKey, []byte(payload), signature) {
+		return time.Time{}, fmt.Errorf("invalid render token signature")
+	}
+
+	index = strings.LastIndex(payload, ".")
+	if index < 0 || payload[:index] != formID {
+		return time.Time{}, fmt.Errorf("render token is for a different form")
+	}
+
+	seconds, err := strconv.ParseInt(payload[index+1:], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed render token")
+	}
+
+	renderedAt := time.Unix(seconds, 0).UTC()
+	if now.Sub(renderedAt) > renderTokenMaxAge {
+		return time.Time{}, fmt.Errorf("render token expired")
+	}
+	// Allow a little clock skew between servers sharing the secret key
+	if renderedAt.After(now.Add(time.Minute)) {
+		return time.Time{}, fmt.Errorf("render token is from the future")
+	}
+
+	return renderedAt, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// newTestRenderToken signs a render token for a form rendered at renderedAt
+func newTestRenderToken(fs *FormService, formID string, renderedAt time.Time) string {
+	payload := fmt.Sprintf("%s.%d", formID, renderedAt.Unix())
+	return payload + "." + signPayload(fs.config.Server.SecretKey, []byte(payload))
+}
+
+func TestVerifyRenderToken(t *testing.T) {
+	fs := newSubmissionTestService(t)
+	fs.config.Server.SecretKey = testTokenSecret
+	now := time.Now().UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name    string
+		token   string
+		want    time.Time
+		wantErr string // "" when the token should be accepted
+	}{
+		{"fresh", fs.NewRenderToken("contact-form"), now, ""},
+		{"rendered an hour ago", newTestRenderToken(fs, "contact-form", now.Add(-time.Hour)), now.Add(-time.Hour), ""},
+		{"just inside the maximum age", newTestRenderToken(fs, "contact-form", now.Add(-renderTokenMaxAge)), now.Add(-renderTokenMaxAge), ""},
+		{"expired", newTestRenderToken(fs, "contact-form", now.Add(-renderTokenMaxAge-time.Second)), time.Time{}, "render token expired"},
+		{"from the future", newTestRenderToken(fs, "contact-form", now.Add(time.Hour)), time.Time{}, "from the future"},
+		{"other form", fs.NewRenderToken("feedback-form"), time.Time{}, "different form"},
+		{"tampered time", strings.Replace(newTestRenderToken(fs, "contact-form", now.Add(-48*time.Hour)), fmt.Sprint(now.Add(-48*time.Hour).Unix()), fmt.Sprint(now.Unix()), 1), time.Time{}, "invalid render token signature"},
+		{"missing", "", time.Time{}, "malformed render token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renderedAt, err := fs.verifyRenderToken(tt.token, "contact-form", now)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifyRenderToken failed: %v", err)
+				}
+				// NewRenderToken reads the clock itself, so allow for a second ticking over
+				if diff := renderedAt.Sub(tt.want); diff < 0 || diff > time.Second {
+					t.Errorf("rendered at %s, want %s", renderedAt, tt.want)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifyRenderToken error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScoreSpam(t *testing.T) {
+	formConfig := config.FormConfig{
+		Fields: []config.FieldConfig{
+			{Name: "name", Type: "text"},
+			{Name: "message", Type: "textarea"},
+		},
+		Spam: config.SpamConfig{
+			Enabled:          true,
+			HoneypotFields:   []string{"website"},
+			MinSubmitSeconds: 3,
+			MaxLinks:         1,
+			BlockedKeywords:  []string{"Casino"},
+		},
+	}
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name        string
+		data        map[string]interface{}
+		renderedAgo time.Duration // 0 for no render token
+		wantScore   float64
+		wantSpam    bool
+	}{
+		{"clean", map[string]interface{}{"name": "Jane", "message": "Hello there"}, time.Minute, 0, false},
+		{"honeypot", map[string]interface{}{"name": "Jane", "message": "Hello", "website": "http://spam.example"}, time.Minute, spamScoreHoneypot, true},
+		{"empty honeypot", map[string]interface{}{"name": "Jane", "message": "Hello", "website": " "}, time.Minute, 0, false},
+		{"too fast", map[string]interface{}{"name": "Jane", "message": "Hello"}, time.Second, spamScoreTooFast, false},
+		{"no render token", map[string]interface{}{"name": "Jane", "message": "Hello"}, 0, spamScoreMissingRender, false},
+		{"expired render token", map[string]interface{}{"name": "Jane", "message": "Hello"}, 25 * time.Hour, spamScoreMissingRender, false},
+		{"too many links", map[string]interface{}{"name": "Jane", "message": "see https://a.example and www.b.example"}, time.Minute, spamScoreTooManyLinks, false},
+		{"keyword ignores case", map[string]interface{}{"name": "Jane", "message": "best CASINO deals"}, time.Minute, spamScoreKeyword, false},
+		{"signals add up", map[string]interface{}{"name": "Jane", "message": "casino at https://a.example and https://b.example"}, time.Second, spamScoreTooFast + spamScoreTooManyLinks + spamScoreKeyword, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newSubmissionTestService(t)
+			fs.config.Server.SecretKey = testTokenSecret
+
+			submission := &models.FormSubmission{ID: "sub-1", FormID: "contact-form", Data: tt.data, SubmittedAt: now}
+			if tt.renderedAgo > 0 {
+				submission.RenderToken = newTestRenderToken(fs, "contact-form", now.Add(-tt.renderedAgo))
+			}
+
+			verdict, err := fs.scoreSpam(submission, formConfig)
+			if err != nil {
+				t.Fatalf("scoreSpam failed: %v", err)
+			}
+			if diff := verdict.Score - tt.wantScore; diff > 1e-9 || diff < -1e-9 || verdict.Spam != tt.wantSpam {
+				t.Errorf("verdict = %.2f spam %t %v, want %.2f spam %t", verdict.Score, verdict.Spam, verdict.Reasons, tt.wantScore, tt.wantSpam)
+			}
+			// Honeypot fields are never stored or passed on to actions
+			if _, exists := submission.Data["website"]; exists {
+				t.Error("honeypot field was left in the submission data")
+			}
+		})
+	}
+}
+
+func TestScoreSpamRepeatedContent(t *testing.T) {
+	fs := newSubmissionTestService(t)
+	formConfig := config.FormConfig{
+		Fields: []config.FieldConfig{
+			{Name: "email", Type: "email"},
+			{Name: "message", Type: "textarea"},
+		},
+		Spam: config.SpamConfig{Enabled: true, RepeatWindow: "1h"},
+	}
+	now := time.Now().UTC()
+
+	stored := 0
+	score := func(email, message string, submittedAt time.Time) *spamVerdict {
+		t.Helper()
+		stored++
+		submission := &models.FormSubmission{
+			ID:          fmt.Sprintf("sub-%d", stored),
+			FormID:      "contact-form",
+			Data:        map[string]interface{}{"email": email, "message": message},
+			SubmittedAt: submittedAt,
+		}
+		verdict, err := fs.scoreSpam(submission, formConfig)
+		if err != nil {
+			t.Fatalf("scoreSpam failed: %v", err)
+		}
+		submission.ContentHash = verdict.ContentHash
+		if err := fs.storeSubmission(fs.db, submission); err != nil {
+			t.Fatal(err)
+		}
+		return verdict
+	}
+
+	if verdict := score("a@example.com", "Buy   now", now.Add(-2*time.Hour)); verdict.Score != 0 {
+		t.Errorf("first submission scored %.2f, want 0", verdict.Score)
+	}
+	// The first submission is older than the one hour repeat window
+	if verdict := score("b@example.com", "buy now", now.Add(-30*time.Minute)); verdict.Score != 0 {
+		t.Errorf("repeat outside the window scored %.2f, want 0", verdict.Score)
+	}
+	// The same text with different spacing, case and email is still a repeat
+	if verdict := score("c@example.com", " BUY now ", now); verdict.Score != spamScoreRepeated {
+		t.Errorf("repeated submission scored %.2f %v, want %.2f", verdict.Score, verdict.Reasons, spamScoreRepeated)
+	}
+	if verdict := score("c@example.com", "something else", now); verdict.Score != 0 {
+		t.Errorf("different submission scored %.2f, want 0", verdict.Score)
+	}
+}
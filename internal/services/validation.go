@@ -0,0 +1,169 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+	"github.com/madeofpendletonwool/pinepods-admin/internal/models"
+)
+
+// ValidationError is returned when submission data fails one or more field rules
+type ValidationError struct {
+	Fields []models.FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var messages []string
+	for _, field := range e.Fields {
+		messages = append(messages, fmt.Sprintf("%s: %s", field.Field, field.Message))
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+// fieldValidator holds a field config together with its precompiled regex
+type fieldValidator struct {
+	field   config.FieldConfig
+	pattern *regexp.Regexp
+}
+
+// compileValidators builds validators for every configured form, compiling each
+// field's validation regex once so bad patterns are caught at startup
+func compileValidators(forms map[string]config.FormConfig) (map[string][]fieldValidator, error) {
+	validators := make(map[string][]fieldValidator)
+
+	for formID, form := range forms {
+		var fields []fieldValidator
+		for _, field := range form.Fields {
+			validator := fieldValidator{field: field}
+			if field.Validation != "" {
+				pattern, err := regexp.Compile(field.Validation)
+				if err != nil {
+					return nil, fmt.Errorf("form '%s' field '%s': invalid validation regex: %w", formID, field.Name, err)
+				}
+				validator.pattern = pattern
+			}
+			fields = append(fields, validator)
+		}
+		validators[formID] = fields
+	}
+
+	return validators, nil
+}
+
+// validate checks a single submitted value against the field's rules
+func (fv fieldValidator) validate(value interface{}, exists bool) string {
+	field := fv.field
+
+	if !exists || value == nil || value == "" {
+		if field.Required {
+			return "this field is required"
+		}
+		return ""
+	}
+
+	switch field.Type {
+	case "boolean":
+		if _, ok := parseBool(value); !ok {
+			return "must be true or false"
+		}
+		return ""
+	case "number":
+		number, ok := parseNumber(value)
+		if !ok {
+			return "must be a number"
+		}
+		if field.Min != nil && number < *field.Min {
+			return fmt.Sprintf("must be at least %v", *field.Min)
+		}
+		if field.Max != nil && number > *field.Max {
+			return fmt.Sprintf("must be at most %v", *field.Max)
+		}
+		return fv.validatePattern(strconv.FormatFloat(number, 'f', -1, 64))
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return "must be a string"
+	}
+
+	length := utf8.RuneCountInString(str)
+	if field.MinLength > 0 && length < field.MinLength {
+		return fmt.Sprintf("must be at least %d characters", field.MinLength)
+	}
+	if field.MaxLength > 0 && length > field.MaxLength {
+		return fmt.Sprintf("must be at most %d characters", field.MaxLength)
+	}
+
+	switch field.Type {
+	case "email":
+		if _, err := mail.ParseAddress(str); err != nil || strings.ContainsAny(str, " <>") {
+			return "must be a valid email address"
+		}
+	case "url":
+		if u, err := url.ParseRequestURI(str); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return "must be a valid http(s) URL"
+		}
+	case "select":
+		if len(field.Options) > 0 && !containsString(field.Options, str) {
+			return fmt.Sprintf("must be one of: %s", strings.Join(field.Options, ", "))
+		}
+	}
+
+	return fv.validatePattern(str)
+}
+
+func (fv fieldValidator) validatePattern(str string) string {
+	if fv.pattern != nil && !fv.pattern.MatchString(str) {
+		return "has an invalid format"
+	}
+	return ""
+}
+
+func parseBool(value interface{}) (bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	case string:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	}
+	return false, false
+}
+
+// parseNumber accepts finite numbers only: NaN would pass every min and max check
+func parseNumber(value interface{}) (float64, bool) {
+	var n float64
+	switch v := value.(type) {
+	case float64:
+		n = v
+	case int:
+		n = float64(v)
+	case string:
+		var err error
+		if n, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, false
+	}
+	return n, true
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"github.com/madeofpendletonwool/pinepods-admin/internal/config"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		want   float64
+		wantOK bool
+	}{
+		{"float", 2.5, 2.5, true},
+		{"int", 7, 7, true},
+		{"string", "42", 42, true},
+		{"padded string", " 1.5 ", 1.5, true},
+		{"negative string", "-3", -3, true},
+		{"exponent", "1e3", 1000, true},
+		{"NaN string", "NaN", 0, false},
+		{"lowercase nan", "nan", 0, false},
+		{"Inf string", "Inf", 0, false},
+		{"signed infinity", "-Infinity", 0, false},
+		{"overflow", "1e400", 0, false},
+		{"NaN float", math.NaN(), 0, false},
+		{"infinite float", math.Inf(1), 0, false},
+		{"empty string", "", 0, false},
+		{"word", "three", 0, false},
+		{"bool", true, 0, false},
+		{"nil", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseNumber(tt.value)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseNumber(%#v) = %v, %t, want %v, %t", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNumberFieldBounds(t *testing.T) {
+	min, max := 1.0, 10.0
+	validator := fieldValidator{field: config.FieldConfig{Name: "rating", Type: "number", Min: &min, Max: &max}}
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"in range", "5", ""},
+		{"lower bound", 1.0, ""},
+		{"below minimum", "0.5", "must be at least 1"},
+		{"above maximum", 11, "must be at most 10"},
+		// NaN compares false with everything, so it would pass both bounds if it were accepted
+		{"NaN", "NaN", "must be a number"},
+		{"infinity", "+Inf", "must be a number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validator.validate(tt.value, true); got != tt.want {
+				t.Errorf("validate(%#v) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}